@@ -0,0 +1,126 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// batchResult is the JSON output of batch for one image.
+type batchResult struct {
+	File         string                 `json:"file"`
+	PerfectMatch bool                   `json:"perfect_match"`
+	Match        *filmdetect.Difference `json:"match,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <image or dir>...",
+	Short: "Find the closest recipe of many images",
+	Long: `Find the closest recipe of every image given, and of every image in the
+directories given, sharing one exiftool process.  An image that can't be read
+doesn't stop the others.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+
+		recipes := loadRecipes()
+
+		var files []string
+		for _, arg := range args {
+			info, err := os.Stat(arg)
+			if err != nil {
+				fail(err)
+			}
+			if !info.IsDir() {
+				files = append(files, arg)
+				continue
+			}
+
+			found, err := filmdetect.GetImageFiles(arg)
+			if err != nil {
+				fail(err)
+			}
+			files = append(files, found...)
+		}
+		slog.Info("Found images", "count", len(files))
+
+		progress := newProgressBar(len(files))
+		opts := filmdetect.Options{Scorer: scorer(), Force: Force, Lenient: Lenient, Events: func(event filmdetect.Event) {
+			if event.Kind == filmdetect.FileDone {
+				progress.Update(*event.Record)
+				logRecord(*event.Record)
+			}
+		}}
+		records, err := filmdetect.DetectFilesWithOptions(recipes, files, opts)
+		progress.Finish()
+		if err != nil {
+			fail(err)
+		}
+
+		if Output == "json" {
+			results := []batchResult{}
+			for _, record := range records {
+				result := batchResult{File: record.Filename, PerfectMatch: record.PerfectMatch}
+				if record.Err != nil {
+					result.Error = record.Err.Error()
+				} else if best, ok := record.Best(); ok {
+					result.Match = &best
+				}
+				results = append(results, result)
+			}
+
+			if err := printJSON(results); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"File", "Recipe", "Score", "Match"})
+		for _, record := range records {
+			best, ok := record.Best()
+			switch {
+			case record.Err != nil:
+				table.Append([]string{record.Filename, "", "", record.Err.Error()})
+			case !ok:
+				table.Append([]string{record.Filename, "", "", "No recipes"})
+			default:
+				match := "No good match"
+				if record.PerfectMatch {
+					match = "Perfect"
+				} else if best.IsGoodMatch() {
+					match = "Close"
+				}
+				table.Append([]string{record.Filename, best.Candidate.FullName(), fmt.Sprintf("%.1f", best.Score()), match})
+			}
+		}
+		table.Render()
+	},
+}
+
+func init() {
+	batchCmd.Flags().BoolVar(&Force, "force", false, "Compare images of cameras other than Fujifilm ones too")
+	rootCmd.AddCommand(batchCmd)
+}
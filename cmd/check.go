@@ -0,0 +1,97 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+// checkReport is the JSON output of check.
+type checkReport struct {
+	File       string                `json:"file"`
+	RecipeFile string                `json:"recipe_file"`
+	Match      bool                  `json:"match"`
+	Difference filmdetect.Difference `json:"difference"`
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check <image> <recipe.json>",
+	Short: "Check whether an image was shot with a recipe",
+	Long: `Check whether an image was shot with a recipe, e.g. to make sure a custom
+setting on the camera is set up the way the recipe says.  Exits with 0 when
+it was, and 3 when it wasn't.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+		os.Exit(runCheck(args[0], args[1]))
+	},
+}
+
+// runCheck compares an image with a recipe file and returns the exit code
+// describing the outcome.
+func runCheck(filename, recipeFile string) int {
+	local, cleanup, err := localImage(filename)
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+	defer cleanup()
+
+	diff, err := filmdetect.CompareImageToRecipeWithOptions(local, recipeFile, filmdetect.Options{Scorer: scorer(), Overrides: overrides(), Force: Force, Lenient: Lenient})
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+
+	exitCode := ExitNoMatch
+	if diff.IsFullScore() {
+		exitCode = ExitPerfectMatch
+	}
+
+	if Output == "json" {
+		err = printJSON(checkReport{
+			File:       filename,
+			RecipeFile: recipeFile,
+			Match:      diff.IsFullScore(),
+			Difference: diff,
+		})
+		if err != nil {
+			printError(err)
+			return ExitError
+		}
+		return exitCode
+	}
+
+	if diff.IsFullScore() {
+		fmt.Println(green(fmt.Sprintf("PASS: %s was shot with %s", filename, diff.Candidate.Name)))
+		return exitCode
+	}
+
+	fmt.Println(red(fmt.Sprintf("FAIL: %s was not shot with %s", filename, diff.Candidate.Name)))
+	fmt.Println(renderDifference(diff))
+	return exitCode
+}
+
+func init() {
+	checkCmd.Flags().BoolVar(&Force, "force", false, "Compare images of cameras other than Fujifilm ones too")
+	checkCmd.Flags().StringArrayVar(&Overrides, "set", nil, "Compare Field=Value instead of the setting read from the image, e.g. DynamicRange=400")
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,91 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// How many candidates the consensus command shows
+const consensusCount = 5
+
+var consensusCmd = &cobra.Command{
+	Use:   "consensus <photo-dir>",
+	Short: "Find the one recipe all photos of a shoot were taken with",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+
+		recipes := loadRecipes()
+
+		files, err := filmdetect.GetImageFiles(args[0])
+		if err != nil {
+			fail(err)
+		}
+		slog.Info("Found images", "count", len(files), "dir", args[0])
+
+		progress := newProgressBar(len(files))
+		records, err := detectFiles(recipes, files, func(record filmdetect.DetectionRecord) {
+			progress.Update(record)
+			logRecord(record)
+		})
+		progress.Finish()
+		if err != nil {
+			fail(err)
+		}
+
+		result := filmdetect.ConsensusWithOptions(recipes, records, filmdetect.Options{Scorer: scorer()})
+		if len(result.Candidates) > consensusCount {
+			result.Candidates = result.Candidates[:consensusCount]
+		}
+
+		if Output == "json" {
+			if err := printJSON(result); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		best, ok := result.Best()
+		if !ok {
+			fail(fmt.Errorf("No recipe was a good match for any of the %d images.", result.Images))
+		}
+
+		fmt.Printf("%s was the best match for %d of %d images (%s confidence).\n",
+			best.Recipe.FullName(), best.Votes, result.Images, result.Confidence)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"Recipe", "Images", "Average score"})
+		for _, candidate := range result.Candidates {
+			table.Append([]string{candidate.Recipe.FullName(), strconv.Itoa(candidate.Votes),
+				fmt.Sprintf("%.1f", candidate.AverageScore)})
+		}
+		table.Render()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(consensusCmd)
+}
@@ -0,0 +1,182 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var ContactSheetOut string
+
+// contactSheetImage is one captioned thumbnail of a contact sheet.
+type contactSheetImage struct {
+	Filename   string
+	Thumbnail  template.URL
+	Score      string
+	Confidence string
+	Perfect    bool
+	Error      string
+}
+
+// contactSheetGroup holds the images of one recipe.
+type contactSheetGroup struct {
+	Recipe string
+	Images []contactSheetImage
+}
+
+var contactSheetTemplate = template.Must(template.New("contactsheet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.images { display: flex; flex-wrap: wrap; gap: 1em; }
+figure { margin: 0; width: 160px; }
+figure img, figure .missing { width: 160px; height: 120px; object-fit: cover; background: #ddd; display: block; }
+figcaption { font-size: 0.8em; word-wrap: break-word; }
+.perfect { color: #080; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Groups}}
+<h2>{{.Recipe}} ({{len .Images}})</h2>
+<div class="images">
+{{range .Images}}
+<figure>
+{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="{{.Filename}}">{{else}}<div class="missing"></div>{{end}}
+<figcaption>
+{{.Filename}}<br>
+{{if .Error}}<span class="error">{{.Error}}</span>{{else if .Perfect}}<span class="perfect">Perfect match</span>{{else}}Score {{.Score}}, {{.Confidence}} confidence{{end}}
+</figcaption>
+</figure>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+var contactSheetCmd = &cobra.Command{
+	Use:   "contactsheet <photo-dir>",
+	Short: "Write an HTML page of thumbnails captioned with their recipes",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+
+		recipes := loadRecipes()
+
+		files, err := filmdetect.GetImageFiles(args[0])
+		if err != nil {
+			fail(err)
+		}
+		slog.Info("Found images", "count", len(files), "dir", args[0])
+
+		progress := newProgressBar(len(files))
+		records, err := detectFiles(recipes, files, func(record filmdetect.DetectionRecord) {
+			progress.Update(record)
+			logRecord(record)
+		})
+		progress.Finish()
+		if err != nil {
+			fail(err)
+		}
+
+		out, err := os.Create(ContactSheetOut)
+		if err != nil {
+			fail(err)
+		}
+		defer out.Close()
+
+		err = contactSheetTemplate.Execute(out, map[string]interface{}{
+			"Title":  filepath.Base(filepath.Clean(args[0])),
+			"Groups": contactSheetGroups(args[0], records),
+		})
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Wrote %s.\n", ContactSheetOut)
+	},
+}
+
+// contactSheetGroups sorts the records into groups by their best good match.
+func contactSheetGroups(dir string, records []filmdetect.DetectionRecord) []contactSheetGroup {
+	const unmatched = "No good match"
+
+	groups := map[string]*contactSheetGroup{}
+	for _, record := range records {
+		image := contactSheetImage{Filename: record.Filename, Perfect: record.PerfectMatch}
+		if rel, err := filepath.Rel(dir, record.Filename); err == nil {
+			image.Filename = rel
+		}
+
+		thumbnail, err := filmdetect.ReadThumbnail(record.Filename)
+		if err != nil {
+			slog.Warn("Reading thumbnail failed", "file", record.Filename, "err", err)
+		} else if len(thumbnail) > 0 {
+			image.Thumbnail = template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumbnail))
+		}
+
+		name := unmatched
+		if record.Err != nil {
+			image.Error = record.Err.Error()
+		} else if best, ok := record.Best(); ok {
+			image.Score = fmt.Sprintf("%.1f", best.Score())
+			image.Confidence = best.Confidence.String()
+			if best.IsGoodMatch() {
+				name = best.Candidate.FullName()
+			}
+		}
+
+		group, ok := groups[name]
+		if !ok {
+			group = &contactSheetGroup{Recipe: name}
+			groups[name] = group
+		}
+		group.Images = append(group.Images, image)
+	}
+
+	var sorted []contactSheetGroup
+	for _, group := range groups {
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if (sorted[i].Recipe == unmatched) != (sorted[j].Recipe == unmatched) {
+			return sorted[j].Recipe == unmatched
+		}
+		return sorted[i].Recipe < sorted[j].Recipe
+	})
+
+	return sorted
+}
+
+func init() {
+	contactSheetCmd.Flags().StringVar(&ContactSheetOut, "out", "contactsheet.html", "Where to write the page")
+	rootCmd.AddCommand(contactSheetCmd)
+}
@@ -0,0 +1,114 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ConvertTarget string
+	ConvertOut    string
+)
+
+// convertReport is the JSON output of convert.
+type convertReport struct {
+	Camera  string                        `json:"camera"`
+	Recipe  filmdetect.Recipe             `json:"recipe"`
+	Changes []filmdetect.ConversionChange `json:"changes"`
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert <recipe.json>",
+	Short: "Convert a recipe to the nearest equivalent on an older camera",
+	Long: `Convert a recipe to the nearest equivalent on an older camera, or the
+cameras of an older sensor generation, and show what changes.  Film simulations the cameras don't
+have are replaced with the closest one they have, and settings they don't
+have, such as Clarity before X-Trans IV, are lost.
+
+The converted recipe is printed, or saved with --out.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		recipe, err := filmdetect.ParseRecipeFile(args[0])
+		if err != nil {
+			fail(err)
+		}
+
+		converted, changes, err := filmdetect.ConvertRecipe(recipe, ConvertTarget)
+		if err != nil {
+			fail(err)
+		}
+		camera := filmdetect.Capabilities(ConvertTarget).Camera
+
+		if Output == "json" {
+			err = printJSON(convertReport{Camera: camera, Recipe: converted, Changes: changes})
+			if err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		if ConvertOut == "" {
+			contents, err := filmdetect.EncodeRecipeFile(converted)
+			if err != nil {
+				fail(err)
+			}
+			fmt.Print(string(contents))
+			// Kept out of the recipe, which may be piped into a file
+			printChanges(os.Stderr, recipe, camera, changes)
+			return
+		}
+
+		if _, err := os.Stat(ConvertOut); err == nil {
+			fail(fmt.Errorf("%s already exists.", ConvertOut))
+		}
+		err = filmdetect.WriteRecipeFile(ConvertOut, converted)
+		if err != nil {
+			fail(err)
+		}
+		printChanges(os.Stdout, recipe, camera, changes)
+	},
+}
+
+// printChanges describes what converting a recipe changed.
+func printChanges(out *os.File, recipe filmdetect.Recipe, camera string, changes []filmdetect.ConversionChange) {
+	if slices.Contains(filmdetect.Generations, camera) {
+		camera += " cameras"
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "%s works as it is on %s.\n", recipe.Name, camera)
+		return
+	}
+
+	fmt.Fprintf(out, "Converting %s for %s:\n", recipe.Name, camera)
+	for _, change := range changes {
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+}
+
+func init() {
+	convertCmd.Flags().StringVar(&ConvertTarget, "target", "", "The camera or sensor generation to convert for, e.g. X-T2 or x-trans3")
+	convertCmd.Flags().StringVar(&ConvertOut, "out", "", "Save the converted recipe to this file")
+	convertCmd.MarkFlagRequired("target")
+	rootCmd.AddCommand(convertCmd)
+}
@@ -0,0 +1,108 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var CoverageSince string
+
+// coverageReport is the JSON output of the coverage command.
+type coverageReport struct {
+	Images  int      `json:"images"`
+	Recipes int      `json:"recipes"`
+	Unused  []string `json:"unused"`
+}
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage <photo-dir>",
+	Short: "Show which recipes weren't used for any photo",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var since time.Time
+		if CoverageSince != "" {
+			var err error
+			since, err = time.Parse("2006-01-02", CoverageSince)
+			if err != nil {
+				fail(fmt.Errorf("Invalid date '%s', expected YYYY-MM-DD.", CoverageSince))
+			}
+		}
+
+		requireDependencies()
+
+		recipes := loadRecipes()
+
+		files, err := filmdetect.GetImageFiles(args[0])
+		if err != nil {
+			fail(err)
+		}
+		slog.Info("Found images", "count", len(files), "dir", args[0])
+
+		progress := newProgressBar(len(files))
+		records, err := detectFiles(recipes, files, func(record filmdetect.DetectionRecord) {
+			progress.Update(record)
+			logRecord(record)
+		})
+		progress.Finish()
+		if err != nil {
+			fail(err)
+		}
+
+		if !since.IsZero() {
+			var recent []filmdetect.DetectionRecord
+			for _, record := range records {
+				if !record.Extraction.CaptureTime.Before(since) {
+					recent = append(recent, record)
+				}
+			}
+			records = recent
+		}
+
+		unused := filmdetect.UnusedRecipes(recipes, records)
+
+		report := coverageReport{Images: len(records), Recipes: len(recipes), Unused: []string{}}
+		for _, recipe := range unused {
+			report.Unused = append(report.Unused, recipe.FullName())
+		}
+
+		if Output == "json" {
+			if err := printJSON(report); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		fmt.Printf("%d of %d recipes were used across %d images.\n", report.Recipes-len(report.Unused), report.Recipes, report.Images)
+		if len(report.Unused) > 0 {
+			fmt.Println("Never used:")
+			for _, name := range report.Unused {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+	},
+}
+
+func init() {
+	coverageCmd.Flags().StringVar(&CoverageSince, "since", "", "Only count photos taken on or after this date (YYYY-MM-DD)")
+	rootCmd.AddCommand(coverageCmd)
+}
@@ -0,0 +1,494 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of detection, for scripts
+const (
+	ExitPerfectMatch = 0
+	ExitError        = 1
+	ExitNearMatch    = 2
+	ExitNoMatch      = 3
+)
+
+var (
+	WriteKeywords bool
+	Sidecar       bool
+	Quiet         bool
+	ShowSource    bool
+	WriteComment  []string
+	Explain       bool
+	Suggest       string
+	Overrides     []string
+	Top           int
+	RecordUsage   bool
+	Pick          string
+)
+
+// How many candidates --explain describes
+const explainCount = 3
+
+// The value of --pick without a recipe name
+const pickAsk = "ask"
+
+// detectionReport is the JSON output of detection.
+type detectionReport struct {
+	File         string                      `json:"file"`
+	PerfectMatch bool                        `json:"perfect_match"`
+	Extraction   filmdetect.ExtractionResult `json:"extraction"`
+	Matches      []filmdetect.Difference     `json:"matches"`
+	Notes        []string                    `json:"notes,omitempty"`
+	Explanation  string                      `json:"explanation,omitempty"`
+	Suggestion   string                      `json:"suggestion,omitempty"`
+	Picked       string                      `json:"picked,omitempty"`
+}
+
+// diffPatch is the diffpatch output of detection: a JSON Patch that turns the
+// recipe file of the closest recipe into the settings of the image.
+type diffPatch struct {
+	File         string                      `json:"file"`
+	Recipe       string                      `json:"recipe"`
+	PerfectMatch bool                        `json:"perfect_match"`
+	Patch        []filmdetect.PatchOperation `json:"patch"`
+}
+
+var detectCmd = &cobra.Command{
+	Use:   "detect <image>",
+	Short: "Find the recipes matching the settings of an image",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+		os.Exit(runDetect(args[0]))
+	},
+}
+
+// overrides parses the --set flags, exiting when one doesn't name a setting
+// or its value is invalid.
+func overrides() map[string]string {
+	fields := map[string]string{}
+	for _, override := range Overrides {
+		field, value, ok := strings.Cut(override, "=")
+		if !ok {
+			fail(fmt.Errorf("Expected --set Field=Value, got '%s'", override))
+		}
+
+		// Checked up front, so that a typo doesn't go unnoticed
+		if err := filmdetect.SetField(&filmdetect.Recipe{}, strings.TrimSpace(field), strings.TrimSpace(value)); err != nil {
+			fail(err)
+		}
+		fields[strings.TrimSpace(field)] = strings.TrimSpace(value)
+	}
+
+	return fields
+}
+
+// runDetect prints the recipes matching an image, which may be a URL, and
+// returns the exit code describing the outcome.
+func runDetect(filename string) int {
+	if isImageURL(filename) && (WriteKeywords || len(WriteComment) > 0) {
+		printError(fmt.Errorf("Can't write to an image downloaded from a URL."))
+		return ExitError
+	}
+
+	allRecipes := loadRecipes()
+
+	local, cleanup, err := localImage(filename)
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+	defer cleanup()
+
+	extraction, err := extract(local)
+	if errors.Is(err, filmdetect.ErrNoFujiMetadata) {
+		if VisualFallback {
+			return runVisualFallback(filename, local)
+		}
+		err = fmt.Errorf("%w  Pass --visual-fallback to guess the film simulation from its colors.", err)
+	}
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+	slog.Debug("Extracted settings", "file", filename, "make", extraction.Make, "model", extraction.Model,
+		"custom_slot", extraction.CustomSlot, "recipe", extraction.Recipe.String())
+
+	opts := filmdetect.Options{Scorer: scorer(), Camera: extraction.Model, Overrides: overrides(), Top: Top}
+	diffs, havePerfectMatch, err := filmdetect.DetectFromRecipesWithOptions(allRecipes, extraction.Recipe, opts)
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+
+	picked := ""
+	if Pick != "" {
+		diffs, picked, err = pickCandidate(diffs, filmdetect.RankRecipes(allRecipes, extraction.Recipe, opts))
+		if err != nil {
+			printError(err)
+			return ExitError
+		}
+	}
+
+	explanation := ""
+	if Explain {
+		ranked := filmdetect.RankRecipes(allRecipes, extraction.Recipe, opts)
+		explanation = filmdetect.ExplainRanking(ranked, opts, explainCount)
+	}
+
+	slog.Info("Compared recipes", "file", filename, "candidates", len(allRecipes), "perfect", havePerfectMatch)
+
+	exitCode := ExitNearMatch
+	if havePerfectMatch {
+		exitCode = ExitPerfectMatch
+	} else if len(diffs) == 0 || !diffs[0].IsGoodMatch() {
+		exitCode = ExitNoMatch
+	}
+
+	if exitCode != ExitNoMatch && (RecordUsage || os.Getenv(filmdetect.RecordUsageEnv) != "") {
+		recordUsage(filename, extraction, diffs[0], havePerfectMatch)
+	}
+
+	var notes []string
+	if havePerfectMatch {
+		if WriteKeywords {
+			err = filmdetect.WriteKeywords(filename, diffs[0].Candidate.Name, Sidecar)
+			if err != nil {
+				printError(err)
+				return ExitError
+			}
+		}
+
+		if len(WriteComment) > 0 {
+			err = filmdetect.WriteComment(filename, diffs[0].Candidate, WriteComment)
+			if err != nil {
+				printError(err)
+				return ExitError
+			}
+		}
+
+		notes, err = filmdetect.CheckSuggestions(diffs[0].Candidate, extraction)
+		if err != nil {
+			printError(err)
+			return ExitError
+		}
+	}
+
+	// A close match that differs in a critical setting is a different recipe
+	// too
+	suggestion := ""
+	if Suggest != "" && (exitCode == ExitNoMatch || (exitCode == ExitNearMatch && diffs[0].Confidence == filmdetect.LowConfidence)) {
+		if _, err := os.Stat(Suggest); err == nil {
+			printError(fmt.Errorf("%s already exists.", Suggest))
+			return ExitError
+		}
+
+		err = filmdetect.WriteRecipeFile(Suggest, filmdetect.SuggestRecipe(extraction, filename))
+		if err != nil {
+			printError(err)
+			return ExitError
+		}
+		suggestion = Suggest
+	}
+
+	if ShowSource && len(diffs) > 0 && diffs[0].IsGoodMatch() {
+		if diffs[0].Candidate.Url == "" {
+			fmt.Printf("%s doesn't have a source URL.\n", diffs[0].Candidate.FullName())
+		} else if err := openURL(diffs[0].Candidate.Url); err != nil {
+			printError(err)
+			return ExitError
+		}
+	}
+
+	if Output == "diffpatch" {
+		report := diffPatch{File: filename, PerfectMatch: havePerfectMatch, Patch: []filmdetect.PatchOperation{}}
+		if len(diffs) > 0 {
+			report.Recipe = diffs[0].Candidate.FullName()
+			report.Patch = diffs[0].Patch()
+		}
+		if err := printJSON(report); err != nil {
+			printError(err)
+			return ExitError
+		}
+		return exitCode
+	}
+
+	if Output == "json" {
+		err = printJSON(detectionReport{
+			File:         filename,
+			PerfectMatch: havePerfectMatch,
+			Extraction:   extraction,
+			Matches:      diffs,
+			Notes:        notes,
+			Explanation:  explanation,
+			Suggestion:   suggestion,
+			Picked:       picked,
+		})
+		if err != nil {
+			printError(err)
+			return ExitError
+		}
+		return exitCode
+	}
+
+	if Quiet {
+		if exitCode != ExitNoMatch {
+			for _, diff := range diffs {
+				fmt.Println(diff.Candidate.FullName())
+			}
+		}
+		return exitCode
+	}
+
+	if Explain {
+		defer fmt.Printf("\n%s", explanation)
+	}
+
+	if havePerfectMatch {
+		if extraction.CustomSlot != "" {
+			fmt.Printf("%s (%s)\n", green(diffs[0].Candidate.FullName()), extraction.CustomSlot)
+		} else {
+			fmt.Println(green(diffs[0].Candidate.FullName()))
+		}
+		printSource(diffs[0].Candidate)
+		printRecipeNotes(diffs[0].Candidate)
+		printCamera(extraction)
+		printFieldErrors(extraction)
+		if diffs[0].Confidence != filmdetect.HighConfidence {
+			fmt.Printf("%s confidence: other recipes are almost as close.\n", diffs[0].Confidence)
+		}
+
+		for _, note := range notes {
+			fmt.Println(note)
+		}
+
+		if len(diffs) > 1 {
+			fmt.Println("The next closest recipes:")
+			printDifferences(diffs[1:])
+		}
+
+		return exitCode
+	}
+
+	printCamera(extraction)
+	printFieldErrors(extraction)
+	if extraction.CustomSlot != "" {
+		fmt.Printf("Shot with custom setting %s.\n", extraction.CustomSlot)
+	}
+
+	if suggestion != "" {
+		defer fmt.Printf("Saved the settings of the image as a new recipe in %s.\n", suggestion)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("There are no recipes to compare with.")
+		return exitCode
+	}
+
+	if exitCode == ExitNoMatch {
+		fmt.Println("We were not able to find a usable match.  These recipes are the closest:")
+	} else {
+		fmt.Printf("We were not able to find a perfect match.  These recipes are the closest (%s confidence):\n", diffs[0].Confidence)
+	}
+
+	printDifferences(diffs)
+	if exitCode == ExitNearMatch && diffs[0].Candidate.Notes != "" {
+		fmt.Printf("Notes on %s: %s\n", diffs[0].Candidate.FullName(), diffs[0].Candidate.Notes)
+	}
+
+	return exitCode
+}
+
+// pickCandidate moves the tied candidate chosen with --pick to the front of
+// diffs, so that keywords, comments and usage record it.  --pick without a
+// name asks which one was used.
+func pickCandidate(diffs []filmdetect.Difference, ranked []filmdetect.Difference) ([]filmdetect.Difference, string, error) {
+	tied := filmdetect.TiedDifferences(ranked)
+	if len(tied) < 2 {
+		return diffs, "", nil
+	}
+
+	choice := -1
+	if Pick != pickAsk {
+		for i, diff := range tied {
+			if diff.Candidate.FullName() == Pick || diff.Candidate.Name == Pick {
+				choice = i
+				break
+			}
+		}
+		if choice < 0 {
+			return diffs, "", fmt.Errorf("'%s' isn't one of the tied recipes", Pick)
+		}
+	}
+
+	if choice < 0 {
+		fmt.Fprintf(os.Stderr, "%d recipes are equally close:\n%s", len(tied), renderSideBySide(tied, true))
+	}
+	for choice < 0 {
+		fmt.Fprintf(os.Stderr, "Which one was used? [1-%d] ", len(tied))
+
+		answer, err := stdin.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(answer)); convErr == nil && n >= 1 && n <= len(tied) {
+			choice = n - 1
+		} else if err != nil {
+			return diffs, "", fmt.Errorf("No recipe picked")
+		}
+	}
+
+	picked := []filmdetect.Difference{tied[choice]}
+	for i, diff := range tied {
+		if i != choice {
+			picked = append(picked, diff)
+		}
+	}
+
+	slog.Info("Picked a tied recipe", "recipe", tied[choice].Candidate.FullName(), "tied", len(tied))
+	return picked, tied[choice].Candidate.FullName(), nil
+}
+
+// recordUsage adds the detection of the recipe of diff to the usage file.
+// Failing to is only worth a warning, since detection itself worked.
+func recordUsage(filename string, extraction filmdetect.ExtractionResult, diff filmdetect.Difference, perfect bool) {
+	usageFile, err := filmdetect.UsageFile()
+	if err != nil {
+		slog.Warn("Can't record usage", "err", err)
+		return
+	}
+
+	if !isImageURL(filename) {
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+	}
+
+	err = filmdetect.RecordUsage(usageFile, filmdetect.UsageRecord{
+		Time:    time.Now(),
+		File:    filename,
+		Recipe:  diff.Candidate.FullName(),
+		Camera:  extraction.Model,
+		Perfect: perfect,
+	})
+	if err != nil {
+		slog.Warn("Can't record usage", "file", usageFile, "err", err)
+	}
+}
+
+// printDifferences prints candidates, several of them side by side unless
+// --compact is given.
+func printDifferences(diffs []filmdetect.Difference) {
+	if !Compact && len(diffs) > 1 {
+		fmt.Println(renderSideBySide(diffs, false))
+		return
+	}
+
+	for _, diff := range diffs {
+		if Compact {
+			fmt.Println(compactDifference(diff))
+		} else {
+			fmt.Println(renderDifference(diff))
+		}
+	}
+}
+
+// printSource prints who made a recipe and where it was published.
+func printSource(recipe filmdetect.Recipe) {
+	if recipe.Author != "" {
+		fmt.Printf("by %s\n", recipe.Author)
+	}
+	if recipe.Url != "" {
+		fmt.Println(recipe.Url)
+	}
+}
+
+// printRecipeNotes prints the notes of a matching recipe, e.g. a reminder of
+// the exposure it's meant for.
+func printRecipeNotes(recipe filmdetect.Recipe) {
+	if recipe.Notes != "" {
+		fmt.Printf("Notes: %s\n", recipe.Notes)
+	}
+}
+
+// openURL opens url in the default browser.
+func openURL(url string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Opening %s failed: %v", url, err)
+	}
+
+	return nil
+}
+
+func init() {
+	detectCmd.Flags().BoolVar(&WriteKeywords, "write-keywords", false, "Add the name of a perfectly matching recipe to the image keywords")
+	detectCmd.Flags().StringSliceVar(&WriteComment, "write-comment", nil, "Write a perfectly matching recipe into these tags: UserComment, ImageDescription or XPComment")
+	detectCmd.Flags().Lookup("write-comment").NoOptDefVal = "UserComment"
+	detectCmd.Flags().BoolVar(&Sidecar, "sidecar", false, "Write keywords to an XMP sidecar instead of the image")
+	detectCmd.Flags().BoolVar(&ShowSource, "show-source", false, "Open the web page of the matching recipe")
+	detectCmd.Flags().BoolVarP(&Quiet, "quiet", "q", false, "Only print the names of the matching recipes")
+	detectCmd.Flags().BoolVar(&Explain, "explain", false, "Show how the closest recipes were scored")
+	detectCmd.Flags().BoolVar(&Force, "force", false, "Compare images of cameras other than Fujifilm ones too")
+	detectCmd.Flags().StringArrayVar(&Overrides, "set", nil, "Compare Field=Value instead of the setting read from the image, e.g. DynamicRange=400")
+	detectCmd.Flags().IntVar(&Top, "top", 0, "Show this many of the closest recipes, even next to a perfect match")
+	detectCmd.Flags().BoolVar(&RecordUsage, "record-usage", false, "Record the detected recipe for filmdetect stats recipes, also turned on by $"+filmdetect.RecordUsageEnv)
+	detectCmd.Flags().StringVar(&Pick, "pick", "", "When several recipes are equally close, use this one, or ask which one without a name")
+	detectCmd.Flags().Lookup("pick").NoOptDefVal = pickAsk
+	detectCmd.Flags().StringVar(&Suggest, "suggest", "", "When no recipe comes close, save the settings of the image as a new recipe file")
+	rootCmd.AddCommand(detectCmd)
+}
+
+// printCamera names the camera of the image, and the converter of a JPEG
+// converted from RAW.
+func printCamera(extraction filmdetect.ExtractionResult) {
+	fmt.Printf("Camera: %s\n", extraction.Camera())
+	if extraction.RAWConverter != "" {
+		fmt.Printf("Converted from RAW with %s.\n", extraction.RAWConverter)
+	}
+	if extraction.Video {
+		fmt.Println("A movie, so only the settings movies have were compared.")
+	}
+}
+
+// printFieldErrors lists the settings --lenient left out of the comparison.
+func printFieldErrors(extraction filmdetect.ExtractionResult) {
+	for _, failed := range extraction.FieldErrors {
+		fmt.Printf("Couldn't read %s '%s', so %s wasn't compared.\n", failed.Tag, failed.Value, strings.Join(failed.Fields, " and "))
+	}
+}
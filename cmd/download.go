@@ -0,0 +1,89 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The largest image downloaded from a URL
+const maxDownloadSize = 100 << 20
+
+// How long downloading an image may take, all of it, so that a server that
+// stops responding doesn't hang detection
+const downloadTimeout = 2 * time.Minute
+
+var downloadClient = &http.Client{Timeout: downloadTimeout}
+
+// isImageURL reports whether an image argument is an http(s) URL rather than
+// a file name.
+func isImageURL(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+// localImage returns a file to read an image argument from.  URLs are
+// downloaded to a temporary file, which cleanup removes.
+func localImage(arg string) (string, func(), error) {
+	if !isImageURL(arg) {
+		return arg, func() {}, nil
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	slog.Info("Downloading image", "url", arg)
+
+	resp, err := downloadClient.Get(arg)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("Downloading %s failed: %s", arg, resp.Status)
+	}
+
+	file, err := os.CreateTemp("", "filmdetect-*"+path.Ext(u.Path))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	n, err := io.Copy(file, io.LimitReader(resp.Body, maxDownloadSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxDownloadSize {
+		err = fmt.Errorf("%s is larger than %d MB", arg, maxDownloadSize>>20)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return file.Name(), cleanup, nil
+}
@@ -0,0 +1,105 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// Codes of the errors printed with --output json, so that wrappers can tell
+// them apart without parsing the message
+const (
+	ErrorCodeUsage             = "usage"
+	ErrorCodeExiftoolMissing   = "exiftool_missing"
+	ErrorCodeNoFujiMetadata    = "no_fuji_metadata"
+	ErrorCodeUnsupportedCamera = "unsupported_camera"
+	ErrorCodeInvalidSettings   = "invalid_settings"
+	ErrorCodeUnsigned          = "unsigned"
+	ErrorCodeOther             = "error"
+)
+
+// errorReport is the JSON output of an error.
+type errorReport struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// usageError is an error in the command line itself, such as an unknown
+// flag.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// errorCode returns the code of err for errorReport.
+func errorCode(err error) string {
+	var usage usageError
+	var unsupported *filmdetect.UnsupportedCameraError
+	var fieldErrors filmdetect.FieldErrors
+	var parseError *filmdetect.ParseError
+
+	switch {
+	case errors.As(err, &usage):
+		return ErrorCodeUsage
+	case errors.Is(err, filmdetect.ErrExiftoolMissing):
+		return ErrorCodeExiftoolMissing
+	case errors.Is(err, filmdetect.ErrNoFujiMetadata):
+		return ErrorCodeNoFujiMetadata
+	case errors.As(err, &unsupported):
+		return ErrorCodeUnsupportedCamera
+	case errors.As(err, &fieldErrors), errors.As(err, &parseError):
+		return ErrorCodeInvalidSettings
+	case errors.Is(err, filmdetect.ErrUnsigned):
+		return ErrorCodeUnsigned
+	}
+
+	return ErrorCodeOther
+}
+
+// printError prints err, as an errorReport with --output json.
+func printError(err error) {
+	if Output != "json" {
+		fmt.Println(err)
+		return
+	}
+
+	var report errorReport
+	report.Error.Code = errorCode(err)
+	report.Error.Message = err.Error()
+	if err := printJSON(report); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// fail prints err and exits.
+func fail(err error) {
+	printError(err)
+	os.Exit(ExitError)
+}
@@ -0,0 +1,81 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var ImportOut string
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Turn the presets of other tools into recipe files",
+}
+
+var importCostyleCmd = &cobra.Command{
+	Use:   "costyle <style-dir>",
+	Short: "Turn a folder of Capture One styles into recipe stubs",
+	Long: `Turn the Capture One styles (.costyle) in a folder and its subfolders into
+recipe stubs, written to --out.  A stub only has the film simulation of the
+ICC profile the style uses, or else the one in its name, and leaves out every
+other setting, so it matches any image of that film simulation.  Keep them out
+of your simulation dirs, and compare them to your recipes with e.g.
+filmdetect --simulation-dir <out> recipes list.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if ImportOut == "" {
+			fail(fmt.Errorf("Pass the directory to write the recipes to with --out."))
+		}
+
+		recipes, err := filmdetect.CaptureOneStyles{Dir: args[0]}.Fetch(context.Background())
+		if err != nil {
+			fail(err)
+		}
+		if len(recipes) == 0 {
+			fail(fmt.Errorf("There are no Capture One styles in %s.", args[0]))
+		}
+
+		files, err := filmdetect.WriteRecipeFiles(recipes, ImportOut)
+		if err != nil {
+			fail(err)
+		}
+
+		var unknown []string
+		for _, recipe := range recipes {
+			if recipe.FilmSimulation == "" {
+				unknown = append(unknown, recipe.Name)
+			}
+		}
+
+		fmt.Printf("Imported %d styles into %s.\n", len(files), ImportOut)
+		if len(unknown) > 0 {
+			fmt.Printf("No film simulation found for: %s\n", strings.Join(unknown, ", "))
+		}
+	},
+}
+
+func init() {
+	importCostyleCmd.Flags().StringVar(&ImportOut, "out", "", "Directory to write the recipe stubs to")
+	importCmd.AddCommand(importCostyleCmd)
+	rootCmd.AddCommand(importCmd)
+}
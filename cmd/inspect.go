@@ -0,0 +1,110 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <image>",
+	Short: "Show the settings extracted from an image without matching them",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+
+		local, cleanup, err := localImage(args[0])
+		if err != nil {
+			fail(err)
+		}
+
+		extraction, err := extract(local)
+		cleanup()
+		if err != nil {
+			fail(err)
+		}
+
+		if Output == "json" {
+			err = printJSON(extraction)
+			if err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		printExtraction(extraction)
+	},
+}
+
+func printExtraction(extraction filmdetect.ExtractionResult) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Setting", "Value"})
+
+	table.Append([]string{"Camera", extraction.Camera()})
+	if !extraction.CaptureTime.IsZero() {
+		table.Append([]string{"Captured", extraction.CaptureTime.Format("2006-01-02 15:04:05")})
+	}
+	if extraction.CustomSlot != "" {
+		table.Append([]string{"Custom setting", extraction.CustomSlot})
+	}
+	if extraction.RAWConverter != "" {
+		table.Append([]string{"Converted from RAW with", extraction.RAWConverter})
+	}
+	if extraction.Video {
+		table.Append([]string{"Movie", "Settings of stills left out"})
+	}
+	if extraction.Lens != "" {
+		table.Append([]string{"Lens", extraction.Lens})
+	}
+	if extraction.ShutterSpeed != "" {
+		table.Append([]string{"Shutter speed", extraction.ShutterSpeed})
+	}
+	if extraction.Aperture > 0 {
+		table.Append([]string{"Aperture", fmt.Sprintf("f/%g", extraction.Aperture)})
+	}
+	table.Append([]string{"ISO", fmt.Sprintf("%d", extraction.ISO)})
+	table.Append([]string{"Exposure compensation", fmt.Sprintf("%+.1f", extraction.ExposureCompensation)})
+
+	v := reflect.ValueOf(extraction.Recipe)
+	for _, name := range filmdetect.ScoringFields() {
+		if extraction.Video && !slices.Contains(filmdetect.VideoFields, name) {
+			continue
+		}
+		value := fmt.Sprintf("%v", v.FieldByName(name).Interface())
+		for _, failed := range extraction.FieldErrors {
+			if slices.Contains(failed.Fields, name) {
+				value = fmt.Sprintf("unreadable: '%s'", failed.Value)
+			}
+		}
+		table.Append([]string{name, value})
+	}
+
+	table.Render()
+}
+
+func init() {
+	inspectCmd.Flags().BoolVar(&Force, "force", false, "Read images of cameras other than Fujifilm ones too")
+	rootCmd.AddCommand(inspectCmd)
+}
@@ -0,0 +1,50 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+var (
+	Verbose bool
+	Debug   bool
+)
+
+// setupLogging sends log messages to stderr.  By default only warnings are
+// shown, --verbose adds what filmdetect is doing and --debug adds the details.
+func setupLogging() {
+	level := slog.LevelWarn
+	if Verbose {
+		level = slog.LevelInfo
+	}
+	if Debug {
+		level = slog.LevelDebug
+	}
+
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(handler))
+	filmdetect.Logger = slog.Default()
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "Log what filmdetect is doing to stderr")
+	rootCmd.PersistentFlags().BoolVar(&Debug, "debug", false, "Log details useful for debugging to stderr")
+}
@@ -0,0 +1,152 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/honza/filmdetect/pkg/photoserver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	PhotoServerToken string
+	DryRun           bool
+)
+
+var photoServerCmd = &cobra.Command{
+	Use:   "photoserver <server> <url>",
+	Short: "Label the photos on a PhotoPrism or immich server with their recipes",
+	Long: `Download the Fujifilm photos of a PhotoPrism or immich server, and label the
+ones that perfectly match a recipe with its name.  Servers: ` + strings.Join(photoserver.Names(), ", ") + `.
+
+The token is a PhotoPrism app password or an immich API key, given with
+--token or $FILMDETECT_PHOTOSERVER_TOKEN.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		token := PhotoServerToken
+		if token == "" {
+			token = os.Getenv("FILMDETECT_PHOTOSERVER_TOKEN")
+		}
+		if token == "" {
+			fail(fmt.Errorf("The photo server needs a token, pass one with --token."))
+		}
+
+		client, err := photoserver.New(args[0], args[1], token)
+		if err != nil {
+			fail(err)
+		}
+
+		requireDependencies()
+
+		detector, err := filmdetect.NewDetector(filmdetect.DetectorOptions{Options: filmdetect.Options{Scorer: scorer(), Force: Force, Lenient: Lenient}, Load: readRecipes})
+		if err != nil {
+			fail(err)
+		}
+		defer detector.Close()
+
+		if err := labelPhotos(context.Background(), client, detector); err != nil {
+			fail(err)
+		}
+	},
+}
+
+// labelPhotos runs detection on every photo of a server, and labels the ones
+// that perfectly match a recipe.
+func labelPhotos(ctx context.Context, client photoserver.Client, detector *filmdetect.Detector) error {
+	photos, err := client.Photos(ctx)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Found photos", "count", len(photos))
+
+	progress := newProgressBar(len(photos))
+
+	var labeled []string
+	for _, photo := range photos {
+		record := detectPhoto(ctx, client, detector, photo)
+		progress.Update(record)
+		logRecord(record)
+
+		if record.Err != nil || !record.PerfectMatch {
+			continue
+		}
+
+		name := record.Differences[0].Candidate.Name
+		if !DryRun {
+			if err := client.AddLabel(ctx, photo, name); err != nil {
+				progress.Finish()
+				return err
+			}
+		}
+		labeled = append(labeled, fmt.Sprintf("%s: %s", photo.Name, name))
+	}
+	progress.Finish()
+
+	if DryRun {
+		for _, line := range labeled {
+			fmt.Println(line)
+		}
+		fmt.Printf("Would label %d of %d photos.\n", len(labeled), len(photos))
+		return nil
+	}
+
+	fmt.Printf("Labeled %d of %d photos.\n", len(labeled), len(photos))
+	return nil
+}
+
+// detectPhoto downloads a photo to a temporary file and runs detection on it.
+func detectPhoto(ctx context.Context, client photoserver.Client, detector *filmdetect.Detector, photo photoserver.Photo) filmdetect.DetectionRecord {
+	record := filmdetect.DetectionRecord{Filename: photo.Name}
+
+	file, err := os.CreateTemp("", "filmdetect-*"+path.Ext(photo.Name))
+	if err != nil {
+		record.Err = err
+		return record
+	}
+	defer os.Remove(file.Name())
+
+	err = client.Download(ctx, photo, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		record.Err = err
+		return record
+	}
+
+	record.Extraction, record.Err = detector.Extract(file.Name())
+	if record.Err != nil {
+		return record
+	}
+
+	record.Differences, record.PerfectMatch, record.Err = detector.DetectExtraction(record.Extraction)
+	return record
+}
+
+func init() {
+	photoServerCmd.Flags().StringVar(&PhotoServerToken, "token", "", "PhotoPrism app password or immich API key")
+	photoServerCmd.Flags().BoolVar(&DryRun, "dry-run", false, "Only show which photos would be labeled")
+	rootCmd.AddCommand(photoServerCmd)
+}
@@ -0,0 +1,201 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+)
+
+var (
+	NoColor bool
+	Compact bool
+)
+
+// colorEnabled reports whether output should be colored: not when asked
+// otherwise with --no-color or $NO_COLOR, or when it's not going to a
+// terminal.
+func colorEnabled() bool {
+	return !NoColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+func colorize(code string, s string) string {
+	if !colorEnabled() {
+		return s
+	}
+
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+func green(s string) string  { return colorize("32", s) }
+func yellow(s string) string { return colorize("33", s) }
+func red(s string) string    { return colorize("31", s) }
+
+// renderDifference draws the differing settings of a candidate as a table,
+// with critical ones in red and minor ones in yellow.
+func renderDifference(d filmdetect.Difference) string {
+	if !colorEnabled() {
+		return d.String()
+	}
+
+	out := &strings.Builder{}
+	table := tablewriter.NewWriter(out)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoMergeCellsByColumnIndex([]int{0})
+	table.SetHeader([]string{"", d.Candidate.FullName(), "Input", "Candidate"})
+
+	lines := d.GetLines()
+	for i, field := range d.GroupedMismatches() {
+		group, color := "Minor", tablewriter.FgYellowColor
+		if filmdetect.IsCriticalField(field.Field) {
+			group, color = "Critical", tablewriter.FgRedColor
+		}
+
+		row := append([]string{group}, lines[i]...)
+		colors := make([]tablewriter.Colors, len(row))
+		for i := range colors {
+			colors[i] = tablewriter.Colors{color}
+		}
+		table.Rich(row, colors)
+	}
+
+	table.Render()
+	return out.String()
+}
+
+// renderSideBySide draws candidates next to each other and to the image, with
+// the settings any of them differs in, critical ones in red and minor ones in
+// yellow.  Numbered candidates can be picked by their number.
+func renderSideBySide(diffs []filmdetect.Difference, numbered bool) string {
+	out := &strings.Builder{}
+	table := tablewriter.NewWriter(out)
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	header := []string{"", "Image"}
+	scores := []string{"Score", ""}
+	authors := []string{"Author", ""}
+	haveAuthors := false
+	for i, diff := range diffs {
+		name := diff.Candidate.FullName()
+		if numbered {
+			name = fmt.Sprintf("%d. %s", i+1, name)
+		}
+		header = append(header, name)
+		scores = append(scores, fmt.Sprintf("%.1f", diff.Score()))
+		authors = append(authors, diff.Candidate.Author)
+		haveAuthors = haveAuthors || diff.Candidate.Author != ""
+	}
+	table.SetHeader(header)
+
+	// Candidates may compare different settings, e.g. when one leaves some
+	// out, so they're looked up by name
+	compared := make([]map[string]filmdetect.FieldDiff, len(diffs))
+	for i, diff := range diffs {
+		compared[i] = map[string]filmdetect.FieldDiff{}
+		for _, field := range diff.GroupedFields() {
+			compared[i][field.Field] = field
+		}
+	}
+
+	rows := 0
+	for _, name := range filmdetect.ScoringFields() {
+		switch name {
+		case "WhiteBalanceRed":
+			name = filmdetect.WhiteBalanceShiftField
+		case "WhiteBalanceBlue":
+			continue
+		}
+
+		color := tablewriter.FgYellowColor
+		if filmdetect.IsCriticalField(name) {
+			color = tablewriter.FgRedColor
+		}
+
+		row := []string{filmdetect.FieldLabel(name), ""}
+		colors := []tablewriter.Colors{{}, {}}
+		differs := false
+		for i := range diffs {
+			field, ok := compared[i][name]
+			if !ok {
+				row = append(row, "")
+				colors = append(colors, tablewriter.Colors{})
+				continue
+			}
+
+			row[1] = filmdetect.FormatValue(name, field.Input)
+			row = append(row, filmdetect.FormatValue(name, field.Candidate))
+			if field.Matched {
+				colors = append(colors, tablewriter.Colors{})
+			} else {
+				colors = append(colors, tablewriter.Colors{color})
+				differs = true
+			}
+		}
+
+		if !differs {
+			continue
+		}
+		if colorEnabled() {
+			table.Rich(row, colors)
+		} else {
+			table.Append(row)
+		}
+		rows++
+	}
+	table.Append(scores)
+	if haveAuthors {
+		table.Append(authors)
+	}
+
+	table.Render()
+	if rows == 0 {
+		out.WriteString("They share every setting with the image.\n")
+	}
+
+	return out.String()
+}
+
+// compactDifference describes a candidate on a single line, e.g.
+// "K64 (score 21.0, Medium confidence): Clarity +3 vs -2".
+func compactDifference(d filmdetect.Difference) string {
+	var fields []string
+	for _, field := range d.GroupedMismatches() {
+		text := filmdetect.FormatMismatch(field)
+		if filmdetect.IsCriticalField(field.Field) {
+			fields = append(fields, red(text))
+		} else {
+			fields = append(fields, yellow(text))
+		}
+	}
+
+	summary := fmt.Sprintf("%s (score %.1f, %s confidence)", d.Candidate.FullName(), d.Score(), d.Confidence)
+	if len(fields) == 0 {
+		return green(summary)
+	}
+
+	return summary + ": " + strings.Join(fields, "; ")
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&NoColor, "no-color", false, "Don't color the output")
+	detectCmd.Flags().BoolVar(&Compact, "compact", false, "Print every close recipe on a single line")
+}
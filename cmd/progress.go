@@ -0,0 +1,90 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// progressBar shows how far along a batch of images is, on one line of a
+// terminal.
+type progressBar struct {
+	out     io.Writer
+	total   int
+	done    int
+	matches int
+	start   time.Time
+}
+
+const progressWidth = 30
+
+// newProgressBar returns a progress bar for total files, or nil when stderr
+// isn't a terminal, or logging would interleave with it.
+func newProgressBar(total int) *progressBar {
+	if Verbose || Debug || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	return &progressBar{out: os.Stderr, total: total, start: time.Now()}
+}
+
+// Update records a finished file and redraws the bar.
+func (p *progressBar) Update(record filmdetect.DetectionRecord) {
+	if p == nil {
+		return
+	}
+
+	p.done++
+	if best, ok := record.Best(); ok && record.Err == nil && best.IsGoodMatch() {
+		p.matches++
+	}
+
+	filled := progressWidth * p.done / p.total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+
+	fmt.Fprintf(p.out, "\r[%s] %d/%d files, %d matches, ETA %s ", bar, p.done, p.total, p.matches, p.eta())
+}
+
+// Finish moves past the line of the bar.
+func (p *progressBar) Finish() {
+	if p == nil {
+		return
+	}
+
+	fmt.Fprintln(p.out)
+}
+
+func (p *progressBar) eta() string {
+	elapsed := time.Since(p.start)
+	remaining := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+	return remaining.Round(time.Second).String()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
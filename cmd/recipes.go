@@ -0,0 +1,481 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var recipesCmd = &cobra.Command{
+	Use:   "recipes",
+	Short: "Work with recipe files",
+}
+
+var recipesNewCmd = &cobra.Command{
+	Use:   "new [file]",
+	Short: "Interactively create a new recipe file",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			if _, err := os.Stat(args[0]); err == nil {
+				fail(fmt.Errorf("%s already exists.", args[0]))
+			}
+		}
+
+		recipe, err := promptRecipe(os.Stdin, os.Stdout)
+		if err != nil {
+			fail(err)
+		}
+
+		if len(args) == 0 {
+			contents, err := filmdetect.EncodeRecipeFile(recipe)
+			if err != nil {
+				fail(err)
+			}
+			fmt.Print(string(contents))
+			return
+		}
+
+		err = filmdetect.WriteRecipeFile(args[0], recipe)
+		if err != nil {
+			fail(err)
+		}
+	},
+}
+
+var recipesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recipes in the simulation dirs",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		recipes := loadRecipes()
+		sort.Slice(recipes, func(i, j int) bool {
+			return recipes[i].FullName() < recipes[j].FullName()
+		})
+
+		if Output == "json" {
+			if err := printJSON(recipes); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"Recipe", "Film simulation", "Author", "Tags"})
+		for _, recipe := range recipes {
+			table.Append([]string{recipe.FullName(), recipe.FilmSimulation, recipe.Author, strings.Join(recipe.Tags, ", ")})
+		}
+		table.Render()
+	},
+}
+
+// lintReport is an issue found by recipes lint, with the file it's in.
+type lintReport struct {
+	File string `json:"file"`
+	filmdetect.LintIssue
+}
+
+var recipesLintCmd = &cobra.Command{
+	Use:   "lint [file...]",
+	Short: "Find recipe settings that no camera would record",
+	Long: `Find recipe settings that no camera would record, such as a "Medium" grain
+effect or DR300, and variants using film simulations or settings their
+cameras don't have.  Checks the given files, or all recipes in the simulation
+dirs.  Exits with 1 when it finds anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		files := args
+		if len(files) == 0 {
+			for _, dir := range simulationDirs() {
+				dirFiles, err := filmdetect.GetRecipeFiles(dir)
+				if err != nil {
+					fail(err)
+				}
+				files = append(files, dirFiles...)
+			}
+		}
+
+		reports := []lintReport{}
+		for _, file := range files {
+			recipes, err := filmdetect.ParseRecipesFile(file)
+			if err != nil {
+				fail(err)
+			}
+
+			for _, recipe := range recipes {
+				for _, issue := range filmdetect.LintRecipe(recipe) {
+					reports = append(reports, lintReport{File: file, LintIssue: issue})
+				}
+			}
+		}
+
+		if Output == "json" {
+			if err := printJSON(reports); err != nil {
+				fail(err)
+			}
+		} else {
+			for _, report := range reports {
+				fmt.Printf("%s: %s\n", report.File, report.LintIssue)
+			}
+		}
+
+		if len(reports) > 0 {
+			fail(fmt.Errorf("Found %d issues in the recipes.", len(reports)))
+		}
+	},
+}
+
+var ClusterMaxDistance float64
+var ClusterTree bool
+
+// clusterReport is a group of similar recipes found by recipes cluster.
+type clusterReport struct {
+	Distance float64  `json:"distance"`
+	Recipes  []string `json:"recipes"`
+}
+
+var recipesClusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Group the recipes in the simulation dirs by similarity",
+	Long: `Group the recipes in the simulation dirs by similarity.  Two recipes are as
+far apart as the weight of the settings they differ in, e.g. 3 for a film
+simulation and 1 for the color.  Recipes join a group when they are on
+average no farther than --max-distance from its recipes.  --tree prints every
+join instead.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		recipes := loadRecipes()
+
+		if ClusterTree {
+			if root := filmdetect.ClusterRecipes(recipes); root != nil {
+				printClusterTree(os.Stdout, root, "")
+			}
+			return
+		}
+
+		reports := []clusterReport{}
+		for _, group := range filmdetect.ClusterGroups(recipes, ClusterMaxDistance) {
+			report := clusterReport{Distance: group.Distance}
+			for _, recipe := range group.Recipes() {
+				report.Recipes = append(report.Recipes, recipe.FullName())
+			}
+			reports = append(reports, report)
+		}
+
+		if Output == "json" {
+			if err := printJSON(reports); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		var loners []string
+		for i, report := range reports {
+			if len(report.Recipes) == 1 {
+				loners = append(loners, report.Recipes[0])
+				continue
+			}
+
+			fmt.Printf("Group %d: %d recipes, %.1f apart\n", i+1, len(report.Recipes), report.Distance)
+			for _, name := range report.Recipes {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+
+		if len(loners) > 0 {
+			fmt.Printf("Unlike any other: %d recipes\n", len(loners))
+			for _, name := range loners {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+	},
+}
+
+// recipeSetFlags maps the flags of recipes set to the Recipe fields they set.
+var recipeSetFlags = map[string]string{}
+
+var recipesSetCmd = &cobra.Command{
+	Use:   "set <recipe>",
+	Short: "Change settings of a recipe in its file",
+	Long: `Change settings of a recipe, given by its name, in the file it's read from,
+e.g. recipes set "Kodachrome 64" --clarity -2 --shadows +1.  The new values
+are checked like the ones of recipes new, and the rest of the file is kept
+as it is.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fields := map[string]string{}
+		cmd.Flags().Visit(func(flag *pflag.Flag) {
+			if field, ok := recipeSetFlags[flag.Name]; ok {
+				fields[field] = flag.Value.String()
+			}
+		})
+		if len(fields) == 0 {
+			fail(fmt.Errorf("Nothing to set, see --help for the settings."))
+		}
+
+		file, err := filmdetect.FindRecipeFile(simulationDirs(), args[0])
+		if err != nil {
+			fail(err)
+		}
+
+		if err := filmdetect.EditRecipeFile(file, args[0], fields); err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Updated %s\n", file)
+	},
+}
+
+// recipeFindFlags maps the flags of recipes find to the settings they search
+// for.
+var recipeFindFlags = map[string]string{}
+
+var FindLimit int
+
+var recipesFindCmd = &cobra.Command{
+	Use:   "find",
+	Short: "Find the recipes with the given settings",
+	Long: `Find the recipes with the given settings, e.g. recipes find --film-simulation
+"Classic Neg" --highlights -2.  Recipes satisfying the most of them come first,
+then the closest ones.  Film simulations and other named values can be given
+in part, as long as only one value contains them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		constraints := map[string]string{}
+		var err error
+		cmd.Flags().Visit(func(flag *pflag.Flag) {
+			field, ok := recipeFindFlags[flag.Name]
+			if !ok || err != nil {
+				return
+			}
+
+			value := flag.Value.String()
+			if completions := filmdetect.CompleteValue(field, value); len(completions) == 1 {
+				value = completions[0]
+			} else if len(completions) > 1 {
+				err = fmt.Errorf("'%s' could be any of: %s", value, strings.Join(completions, ", "))
+			}
+			constraints[field] = value
+		})
+		if err != nil {
+			fail(err)
+		}
+		if len(constraints) == 0 {
+			fail(fmt.Errorf("Nothing to search for, see --help for the settings."))
+		}
+
+		matches, err := filmdetect.FindRecipes(loadRecipes(), constraints)
+		if err != nil {
+			fail(err)
+		}
+		if FindLimit > 0 && len(matches) > FindLimit {
+			matches = matches[:FindLimit]
+		}
+
+		if Output == "json" {
+			if matches == nil {
+				matches = []filmdetect.RecipeMatch{}
+			}
+			if err := printJSON(matches); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		if len(matches) == 0 {
+			fmt.Println("No recipe has any of these settings.")
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"Recipe", "Matches", "Differs in"})
+		for _, match := range matches {
+			var differs []string
+			for _, field := range match.Mismatches {
+				differs = append(differs, fmt.Sprintf("%s %s", filmdetect.FieldLabel(field.Field), filmdetect.FormatValue(field.Field, field.Candidate)))
+			}
+			table.Append([]string{match.Recipe.FullName(), fmt.Sprintf("%d/%d", match.Satisfied, match.Constraints), strings.Join(differs, ", ")})
+		}
+		table.Render()
+	},
+}
+
+// flagName turns the name of a Recipe field into a flag name, e.g.
+// "d-range-priority" for DRangePriority.
+func flagName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := rune(field[i-1])
+			next := ' '
+			if i+1 < len(field) {
+				next = rune(field[i+1])
+			}
+			if unicode.IsLower(previous) || unicode.IsLower(next) {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// printClusterTree prints a node of a cluster tree and everything under it,
+// the distance of every join next to it.
+func printClusterTree(out io.Writer, node *filmdetect.ClusterNode, indent string) {
+	if node.IsLeaf() {
+		fmt.Fprintf(out, "─ %s\n", node.Recipe.FullName())
+		return
+	}
+
+	fmt.Fprintf(out, "┬ %.1f\n", node.Distance)
+	fmt.Fprintf(out, "%s├─", indent)
+	printClusterTree(out, node.Left, indent+"│ ")
+	fmt.Fprintf(out, "%s└─", indent)
+	printClusterTree(out, node.Right, indent+"  ")
+}
+
+// promptRecipe asks for every field of Recipe in turn until it gets a valid
+// value.  Enum fields accept any unambiguous part of a known value.
+func promptRecipe(in io.Reader, out io.Writer) (filmdetect.Recipe, error) {
+	recipe := filmdetect.Recipe{}
+	scanner := bufio.NewScanner(in)
+	t := reflect.TypeOf(recipe)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i).Name
+		values := filmdetect.EnumValues[field]
+
+		// Collections come from the directory a recipe is in
+		if field == "Collection" {
+			continue
+		}
+
+		if field == "Created" {
+			recipe.Created = time.Now().Format("2006-01-02")
+			continue
+		}
+
+		// The recipe is a Fujifilm one, and the rest can't be typed in
+		if field == "Updated" || field == "Dialect" || !filmdetect.CanSetField(field) {
+			continue
+		}
+
+		defaultValue := ""
+		if len(values) > 0 {
+			defaultValue = values[0]
+			fmt.Fprintf(out, "%s\n", strings.Join(values, " | "))
+		} else if t.Field(i).Type.Kind() == reflect.Int {
+			defaultValue = "0"
+		}
+
+		for {
+			if defaultValue != "" {
+				fmt.Fprintf(out, "%s (%s): ", field, defaultValue)
+			} else {
+				fmt.Fprintf(out, "%s: ", field)
+			}
+
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return recipe, err
+				}
+				return recipe, io.ErrUnexpectedEOF
+			}
+
+			input := strings.TrimSpace(scanner.Text())
+			if input == "" {
+				input = defaultValue
+			}
+
+			if input == "" && field == "Name" {
+				fmt.Fprintln(out, "A recipe needs a name.")
+				continue
+			}
+
+			if len(values) > 0 {
+				completions := filmdetect.CompleteValue(field, input)
+				if len(completions) > 1 {
+					fmt.Fprintf(out, "Did you mean: %s?\n", strings.Join(completions, ", "))
+					continue
+				}
+				if len(completions) == 1 {
+					input = completions[0]
+				}
+			}
+
+			err := filmdetect.SetField(&recipe, field, input)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+
+			break
+		}
+	}
+
+	return recipe, nil
+}
+
+func init() {
+	recipesListCmd.Flags().StringSliceVar(&Tags, "tag", nil, "Only list recipes with one of these tags")
+	recipesCmd.AddCommand(recipesNewCmd)
+	recipesCmd.AddCommand(recipesListCmd)
+	recipesClusterCmd.Flags().Float64Var(&ClusterMaxDistance, "max-distance", 3, "How far apart recipes of a group may be")
+	recipesClusterCmd.Flags().BoolVar(&ClusterTree, "tree", false, "Print the tree of all joins instead of groups")
+	recipesCmd.AddCommand(recipesLintCmd)
+	recipesCmd.AddCommand(recipesClusterCmd)
+	t := reflect.TypeOf(filmdetect.Recipe{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// Collections come from the directory, and the rest aren't single
+		// values
+		if field.Tag.Get("json") == "-" || field.Name == "Collection" || field.Name == "Variants" || field.Name == "Dialect" || field.Name == "Settings" {
+			continue
+		}
+		name := flagName(field.Name)
+		// --tags is the global filter
+		if field.Name == "Tags" {
+			name = "tag"
+		}
+		recipeSetFlags[name] = field.Name
+		recipesSetCmd.Flags().String(name, "", "Set "+filmdetect.FieldLabel(field.Name))
+	}
+	recipesCmd.AddCommand(recipesSetCmd)
+	for _, field := range filmdetect.ScoringFields() {
+		recipeFindFlags[flagName(field)] = field
+		recipesFindCmd.Flags().String(flagName(field), "", "Find recipes with this "+filmdetect.FieldLabel(field))
+	}
+	recipesFindCmd.Flags().IntVar(&FindLimit, "limit", 10, "Show at most this many recipes, 0 for all")
+	recipesCmd.AddCommand(recipesFindCmd)
+	rootCmd.AddCommand(recipesCmd)
+}
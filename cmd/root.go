@@ -17,34 +17,274 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/honza/filmdetect/pkg/filmdetect"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-var SimulationDir string
+var (
+	SimulationDirs   []string
+	Collections      []string
+	Tags             []string
+	NoBuiltin        bool
+	Output           string
+	Force            bool
+	Lenient          bool
+	OnInvalid        string
+	OnConflict       string
+	WBShiftThreshold float64
+)
 
+// rootCmd detects the recipe of an image when given one, as a shorthand for
+// filmdetect detect.
 var rootCmd = &cobra.Command{
-	Use:  "filmdetect",
+	Use:   "filmdetect [image]",
+	Short: "Find the film simulation recipe of a Fujifilm photo",
+	Long: `Find the film simulation recipe of a Fujifilm photo.
+
+filmdetect <image> is short for filmdetect detect <image>, and takes the same
+flags.`,
 	Args: cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		if SimulationDir == "" {
-			fmt.Println("Simulation dir can't be empty.")
-			os.Exit(1)
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		setupLogging()
+
+		if Output != "table" && Output != "json" && Output != "diffpatch" {
+			fail(fmt.Errorf("Unknown output format '%s'.", Output))
+		}
+
+		if Output == "diffpatch" && cmd.HasParent() && cmd != detectCmd {
+			fail(fmt.Errorf("--output diffpatch only works when detecting the recipe of an image."))
+		}
+
+		if _, err := filmdetect.ParseLoadPolicy(OnInvalid); err != nil {
+			fail(err)
+		}
+
+		if _, err := filmdetect.ParseConflictPolicy(OnConflict); err != nil {
+			fail(err)
+		}
+
+		if WBShiftThreshold < 0 {
+			fail(fmt.Errorf("--wb-shift-threshold can't be negative."))
 		}
-		filmdetect.Run(SimulationDir, args[0])
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+		os.Exit(runDetect(args[0]))
 	},
 }
 
 func Execute() {
+	// The flags of detect are only complete once every init has run
+	rootCmd.Flags().AddFlagSet(detectCmd.Flags())
+
+	// With --output json, errors in the command line are reported as JSON
+	// too, without cobra printing them and the usage first
+	if jsonOutput(os.Args[1:]) {
+		rootCmd.SilenceErrors = true
+		rootCmd.SilenceUsage = true
+	}
+
+	// The commands handle their own errors, so these are about the command
+	// line
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fail(usageError{err})
+	}
+}
+
+// jsonOutput reports whether args ask for --output json, before cobra parses
+// them, which fails on the very errors that have to be reported as JSON.
+func jsonOutput(args []string) bool {
+	flags := pflag.NewFlagSet("output", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	output := flags.String("output", "", "")
+	flags.Parse(args)
+
+	return *output == "json"
+}
+
+// scorer returns the Scorer of --wb-shift-threshold, or nil for the
+// default one.
+func scorer() filmdetect.Scorer {
+	if WBShiftThreshold == 0 {
+		return nil
+	}
+
+	return filmdetect.WeightedScorer{WhiteBalanceShiftThreshold: WBShiftThreshold}
+}
+
+// detectFiles is filmdetect.DetectFilesWithProgress with the scorer of
+// --wb-shift-threshold, and reading images like --force and --lenient say.
+func detectFiles(recipes []filmdetect.Recipe, files []string, progress func(filmdetect.DetectionRecord)) ([]filmdetect.DetectionRecord, error) {
+	opts := filmdetect.Options{Scorer: scorer(), Force: Force, Lenient: Lenient}
+	if progress != nil {
+		opts.Events = func(event filmdetect.Event) {
+			if event.Kind == filmdetect.FileDone {
+				progress(*event.Record)
+			}
+		}
+	}
+
+	return filmdetect.DetectFilesWithOptions(recipes, files, opts)
+}
+
+// simulationDirs returns the simulation directories in the order they were
+// given.  Each --simulation-dir may itself be a list, like $PATH.
+func simulationDirs() []string {
+	var dirs []string
+
+	for _, value := range SimulationDirs {
+		for _, dir := range strings.Split(value, string(filepath.ListSeparator)) {
+			if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	return dirs
+}
+
+// requireDependencies exits with an explanation when exiftool is missing.
+func requireDependencies() {
+	if err := filmdetect.CheckDependencies(); err != nil {
+		fail(err)
 	}
 }
 
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
+
+// extract reads the settings of an image, of any camera with --force, and
+// leaving out the ones that can't be parsed with --lenient.
+func extract(filename string) (filmdetect.ExtractionResult, error) {
+	e, err := filmdetect.NewExtractor()
+	if err != nil {
+		return filmdetect.ExtractionResult{}, err
+	}
+	defer e.Close()
+	e.Force = Force
+	e.Lenient = Lenient
+
+	extraction, err := e.Extract(filename)
+	var unsupported *filmdetect.UnsupportedCameraError
+	if errors.As(err, &unsupported) {
+		err = fmt.Errorf("%w  Pass --force to compare it anyway.", err)
+	}
+	var fieldErrors filmdetect.FieldErrors
+	if errors.As(err, &fieldErrors) {
+		err = fmt.Errorf("%w  Pass --lenient to compare the other settings.", err)
+	}
+
+	return extraction, err
+}
+
+// loadRecipes reads the recipes, or exits if that fails or there are none.
+func loadRecipes() []filmdetect.Recipe {
+	recipes, err := readRecipes()
+	if err != nil {
+		fail(err)
+	}
+
+	return recipes
+}
+
+// readRecipes reads the builtin recipes, updated by the installed recipe
+// database, and the recipes of all simulation directories on top of them,
+// filtered by --collection and --tags.
+func readRecipes() ([]filmdetect.Recipe, error) {
+	dirs := simulationDirs()
+	if len(dirs) == 0 && NoBuiltin {
+		return nil, fmt.Errorf("Simulation dir can't be empty.")
+	}
+
+	var builtin []filmdetect.Recipe
+	if !NoBuiltin {
+		var err error
+		builtin, err = filmdetect.BuiltinRecipes()
+		if err != nil {
+			return nil, err
+		}
+
+		database, err := databaseRecipes()
+		if err != nil {
+			return nil, err
+		}
+		builtin = filmdetect.MergeRecipes(builtin, database)
+	}
+
+	policy, err := filmdetect.ParseLoadPolicy(OnInvalid)
+	if err != nil {
+		return nil, err
+	}
+	onConflict, err := filmdetect.ParseConflictPolicy(OnConflict)
+	if err != nil {
+		return nil, err
+	}
+	recipes, _, err := filmdetect.GetRecipesFromDirsWithOptions(dirs, filmdetect.LoadOptions{
+		Policy:     policy,
+		Ask:        askSkip,
+		OnConflict: onConflict,
+	})
+	if err != nil {
+		return nil, err
+	}
+	recipes = filmdetect.MergeRecipes(builtin, recipes)
+	slog.Info("Loaded recipes", "count", len(recipes), "builtin", len(builtin), "dirs", dirs)
+
+	if len(Collections) > 0 {
+		recipes = filmdetect.FilterByCollection(recipes, Collections)
+		slog.Debug("Filtered recipes by collection", "count", len(recipes), "collections", Collections)
+	}
+
+	if len(Tags) > 0 {
+		recipes = filmdetect.FilterByTags(recipes, Tags)
+		slog.Debug("Filtered recipes by tag", "count", len(recipes), "tags", Tags)
+	}
+
+	return recipes, nil
+}
+
+// stdin is shared by the questions asked on the terminal, so that the
+// answers one buffers aren't lost to the next.
+var stdin = bufio.NewReader(os.Stdin)
+
+// askSkip asks on the terminal whether to leave out a recipe file that can't
+// be read, for --on-invalid ask.
+func askSkip(file string, err error) bool {
+	fmt.Fprintf(os.Stderr, "%v\nSkip %s and continue? [y/N] ", err, file)
+
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
 func init() {
-	rootCmd.PersistentFlags().StringVar(&SimulationDir, "simulation-dir", "", "Where are the simulation files?")
+	rootCmd.PersistentFlags().StringArrayVar(&SimulationDirs, "simulation-dir", nil, "Where are the simulation files? Can be repeated, later directories override recipes of the same name")
+	rootCmd.PersistentFlags().StringVar(&Output, "output", "table", "Output format: table or json, or diffpatch for the changes that turn the closest recipe into the settings of the image")
+	rootCmd.PersistentFlags().StringSliceVar(&Collections, "collection", nil, "Only use recipes from these collections (subdirectories of the simulation dir)")
+	rootCmd.PersistentFlags().BoolVar(&NoBuiltin, "no-builtin", false, "Don't use the recipes compiled into filmdetect")
+	rootCmd.PersistentFlags().StringSliceVar(&Tags, "tags", nil, "Only use recipes with one of these tags")
+	rootCmd.PersistentFlags().StringVar(&OnConflict, "on-conflict", "keep-last", "What to do about recipes of several simulation dirs that share a name but not their settings: keep-last, keep-first, rename or error")
+	rootCmd.PersistentFlags().BoolVar(&Lenient, "lenient", false, "Leave out settings of an image that can't be parsed, rather than failing")
+	rootCmd.PersistentFlags().Float64Var(&WBShiftThreshold, "wb-shift-threshold", 0, "Score the white balance shift as one setting, matching when the red and blue shifts are no further apart than this, e.g. 1.5")
+	rootCmd.PersistentFlags().StringVar(&OnInvalid, "on-invalid", "strict", "What to do about recipe files that can't be read: strict (fail), skip (warn and leave them out) or ask")
 }
@@ -0,0 +1,224 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/honza/filmdetect/pkg/scandb"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ScanDB string
+
+	QueryRecipe    string
+	QueryCamera    string
+	QueryYear      int
+	QuerySince     string
+	QueryUntil     string
+	QueryPerfect   bool
+	QueryUnmatched bool
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan --db <results.sqlite> <photo-dir>",
+	Short: "Store the recipes of a photo library in a database, for query",
+	Long: `Store the recipes of a photo library in a SQLite database, for query.  Only
+images that are new, or changed since the last scan, are read again, and the
+results of deleted images are removed.  When the recipes change, all images
+are read again.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := openScanDB()
+		defer db.Close()
+
+		files, err := filmdetect.GetImageFiles(args[0])
+		if err != nil {
+			fail(err)
+		}
+
+		recipes := loadRecipes()
+		hash, err := filmdetect.RecipesHash(recipes)
+		if err != nil {
+			fail(err)
+		}
+
+		var changed []string
+		for _, file := range files {
+			isChanged, err := db.Changed(file, hash)
+			if err != nil {
+				fail(err)
+			}
+			if isChanged {
+				changed = append(changed, file)
+			}
+		}
+		slog.Info("Found images", "count", len(files), "changed", len(changed), "dir", args[0])
+
+		if len(changed) > 0 {
+			requireDependencies()
+
+			var saveErr error
+			progress := newProgressBar(len(changed))
+			_, err = detectFiles(recipes, changed, func(record filmdetect.DetectionRecord) {
+				progress.Update(record)
+				logRecord(record)
+				if saveErr == nil {
+					saveErr = db.Save(record, hash)
+				}
+			})
+			progress.Finish()
+			if err == nil {
+				err = saveErr
+			}
+			if err != nil {
+				fail(err)
+			}
+		}
+
+		removed, err := db.Prune(args[0], files)
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Scanned %d of %d images, removed %d deleted ones.\n", len(changed), len(files), removed)
+	},
+}
+
+var queryCmd = &cobra.Command{
+	Use:   "query --db <results.sqlite>",
+	Short: "Find photos in a database made by scan",
+	Long: `Find photos in a database made by scan, e.g. all photos shot with
+Kodachrome 64 in 2023:
+
+  filmdetect query --db results.sqlite --recipe "Kodachrome 64" --year 2023`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		q := scandb.Query{
+			Recipe:    QueryRecipe,
+			Camera:    QueryCamera,
+			Perfect:   QueryPerfect,
+			Unmatched: QueryUnmatched,
+		}
+
+		if QueryYear != 0 {
+			q.Since = time.Date(QueryYear, 1, 1, 0, 0, 0, 0, time.UTC)
+			q.Until = q.Since.AddDate(1, 0, 0)
+		}
+		for _, date := range []struct {
+			value string
+			t     *time.Time
+		}{{QuerySince, &q.Since}, {QueryUntil, &q.Until}} {
+			if date.value == "" {
+				continue
+			}
+			t, err := time.Parse("2006-01-02", date.value)
+			if err != nil {
+				fail(fmt.Errorf("Invalid date '%s', expected YYYY-MM-DD.", date.value))
+			}
+			*date.t = t
+		}
+
+		db := openScanDB()
+		defer db.Close()
+
+		results, err := db.Query(q)
+		if err != nil {
+			fail(err)
+		}
+
+		if Output == "json" {
+			if err := printJSON(results); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"Photo", "Captured", "Camera", "Lens", "Exposure", "Recipe", "Score"})
+		for _, result := range results {
+			captured := ""
+			if !result.CapturedAt.IsZero() {
+				captured = result.CapturedAt.Format("2006-01-02 15:04")
+			}
+			recipe := result.Recipe
+			if result.Error != "" {
+				recipe = result.Error
+			} else if !result.GoodMatch {
+				recipe = "no match"
+			}
+			table.Append([]string{result.Path, captured, result.Camera, result.Lens, exposureSummary(result), recipe,
+				strconv.FormatFloat(result.Score, 'f', 1, 64)})
+		}
+		table.Render()
+	},
+}
+
+// openScanDB opens the database given with --db, or exits.
+func openScanDB() *scandb.DB {
+	if ScanDB == "" {
+		fail(fmt.Errorf("Pass the database with --db."))
+	}
+
+	db, err := scandb.Open(ScanDB)
+	if err != nil {
+		fail(err)
+	}
+
+	return db
+}
+
+// exposureSummary describes the exposure of a photo, e.g. "1/250 f/2.8 ISO
+// 640", leaving out what wasn't recorded.
+func exposureSummary(result scandb.Result) string {
+	var parts []string
+	if result.ShutterSpeed != "" {
+		parts = append(parts, result.ShutterSpeed)
+	}
+	if result.Aperture > 0 {
+		parts = append(parts, "f/"+strconv.FormatFloat(result.Aperture, 'f', -1, 64))
+	}
+	if result.ISO > 0 {
+		parts = append(parts, "ISO "+strconv.Itoa(result.ISO))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{scanCmd, queryCmd} {
+		cmd.Flags().StringVar(&ScanDB, "db", "", "The SQLite database of results")
+		rootCmd.AddCommand(cmd)
+	}
+
+	queryCmd.Flags().StringVar(&QueryRecipe, "recipe", "", "Only photos matching this recipe")
+	queryCmd.Flags().StringVar(&QueryCamera, "camera", "", "Only photos taken with this camera model")
+	queryCmd.Flags().IntVar(&QueryYear, "year", 0, "Only photos taken in this year")
+	queryCmd.Flags().StringVar(&QuerySince, "since", "", "Only photos taken on or after this date (YYYY-MM-DD)")
+	queryCmd.Flags().StringVar(&QueryUntil, "until", "", "Only photos taken before this date (YYYY-MM-DD)")
+	queryCmd.Flags().BoolVar(&QueryPerfect, "perfect", false, "Only perfect matches")
+	queryCmd.Flags().BoolVar(&QueryUnmatched, "unmatched", false, "Include photos no recipe matches")
+}
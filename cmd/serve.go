@@ -0,0 +1,102 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/honza/filmdetect/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ServeAddr      string
+	ServeBatchDirs []string
+	ServeWatch     bool
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve detection over HTTP and gRPC",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+
+		detector, err := filmdetect.NewDetector(filmdetect.DetectorOptions{Options: filmdetect.Options{Scorer: scorer(), Force: Force, Lenient: Lenient}, Load: readRecipes})
+		if err != nil {
+			fail(err)
+		}
+		defer detector.Close()
+
+		go reloadOnHangup(detector)
+		if ServeWatch {
+			go reloadOnChange(detector)
+		}
+
+		fmt.Printf("Listening on %s\n", ServeAddr)
+
+		srv := server.New(detector)
+		srv.BatchDirs = ServeBatchDirs
+		err = srv.ListenAndServe(ServeAddr)
+		if err != nil {
+			fail(err)
+		}
+	},
+}
+
+// reloadOnChange reloads the recipes of detector whenever a recipe file in the
+// simulation dirs changes.
+func reloadOnChange(detector *filmdetect.Detector) {
+	err := filmdetect.WatchDirs(context.Background(), simulationDirs(), func() {
+		reloadRecipes(detector)
+	})
+	if err != nil {
+		slog.Error("Watching the simulation dirs failed", "err", err)
+	}
+}
+
+// reloadOnHangup reloads the recipes of detector whenever the process gets
+// SIGHUP.
+func reloadOnHangup(detector *filmdetect.Detector) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		reloadRecipes(detector)
+	}
+}
+
+func reloadRecipes(detector *filmdetect.Detector) {
+	if err := detector.ReloadRecipes(); err != nil {
+		slog.Error("Reloading recipes failed", "err", err)
+		return
+	}
+	slog.Info("Reloaded recipes", "count", detector.Recipes().Len())
+}
+
+func init() {
+	serveCmd.Flags().BoolVar(&ServeWatch, "watch", true, "Reload the recipes when a file in the simulation dirs changes")
+	serveCmd.Flags().StringVar(&ServeAddr, "addr", "localhost:8080", "Address to listen on")
+	serveCmd.Flags().StringArrayVar(&ServeBatchDirs, "batch-dir", nil, "A directory whose images clients may detect in one batch request; can be repeated")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,260 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	StatsGroupBy string
+	UsageGroupBy string
+	UsageSince   string
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <photo-dir>",
+	Short: "Show which recipes were used across a photo library",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		groupBy, ok := statsGroupings[StatsGroupBy]
+		if !ok {
+			fail(fmt.Errorf("Can't group by '%s'.", StatsGroupBy))
+		}
+
+		requireDependencies()
+
+		recipes := loadRecipes()
+
+		files, err := filmdetect.GetImageFiles(args[0])
+		if err != nil {
+			fail(err)
+		}
+
+		slog.Info("Found images", "count", len(files), "dir", args[0])
+
+		progress := newProgressBar(len(files))
+		records, err := detectFiles(recipes, files, func(record filmdetect.DetectionRecord) {
+			progress.Update(record)
+			logRecord(record)
+		})
+		progress.Finish()
+		if err != nil {
+			fail(err)
+		}
+
+		printSummaries(filmdetect.Summarize(records, groupBy))
+	},
+}
+
+var statsRecipesCmd = &cobra.Command{
+	Use:   "recipes",
+	Short: "Show how often each recipe was detected, as recorded by --record-usage",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		groupBy, ok := usageGroupings[UsageGroupBy]
+		if !ok {
+			fail(fmt.Errorf("Can't group by '%s'.", UsageGroupBy))
+		}
+
+		var since time.Time
+		if UsageSince != "" {
+			var err error
+			since, err = time.ParseInLocation(time.DateOnly, UsageSince, time.Local)
+			if err != nil {
+				fail(fmt.Errorf("Expected --since YYYY-MM-DD, got '%s'", UsageSince))
+			}
+		}
+
+		usageFile, err := filmdetect.UsageFile()
+		if err != nil {
+			fail(err)
+		}
+
+		records, err := filmdetect.ReadUsage(usageFile)
+		if err != nil {
+			fail(err)
+		}
+
+		var recent []filmdetect.UsageRecord
+		for _, record := range records {
+			if !record.Time.Before(since) {
+				recent = append(recent, record)
+			}
+		}
+
+		summaries := filmdetect.SummarizeUsage(recent, groupBy)
+
+		if Output == "json" {
+			if err := printJSON(summaries); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		if len(records) == 0 {
+			fmt.Printf("No detections recorded in %s yet, detect with --record-usage to record them.\n", usageFile)
+			return
+		}
+		if len(recent) == 0 {
+			fmt.Printf("No detections recorded since %s.\n", UsageSince)
+			return
+		}
+
+		printUsage(summaries)
+	},
+}
+
+var statsGroupings = map[string]func(filmdetect.DetectionRecord) string{
+	"none": func(r filmdetect.DetectionRecord) string {
+		return "All images"
+	},
+	"month": func(r filmdetect.DetectionRecord) string {
+		if r.Extraction.CaptureTime.IsZero() {
+			return "Unknown date"
+		}
+		return r.Extraction.CaptureTime.Format("2006-01")
+	},
+	"camera": func(r filmdetect.DetectionRecord) string {
+		if r.Extraction.Model == "" {
+			return "Unknown camera"
+		}
+		return r.Extraction.Model
+	},
+}
+
+var usageGroupings = map[string]func(filmdetect.UsageRecord) string{
+	"none": func(r filmdetect.UsageRecord) string {
+		return "All detections"
+	},
+	"month": func(r filmdetect.UsageRecord) string {
+		return r.Time.Local().Format("2006-01")
+	},
+	"camera": func(r filmdetect.UsageRecord) string {
+		if r.Camera == "" {
+			return "Unknown camera"
+		}
+		return r.Camera
+	},
+}
+
+// logRecord logs the outcome of detection on one image of a batch.
+func logRecord(record filmdetect.DetectionRecord) {
+	if record.Err != nil {
+		slog.Warn("Detection failed", "file", record.Filename, "err", record.Err)
+		return
+	}
+
+	best, ok := record.Best()
+	if !ok {
+		slog.Info("No recipes to compare with", "file", record.Filename)
+		return
+	}
+
+	slog.Info("Detected", "file", record.Filename, "recipe", best.Candidate.FullName(),
+		"perfect", record.PerfectMatch, "score", best.Score())
+}
+
+func printSummaries(summaries map[string]*filmdetect.Summary) {
+	var groups []string
+	for group := range summaries {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for _, group := range groups {
+		summary := summaries[group]
+
+		var names []string
+		for name := range summary.RecipeCounts {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if summary.RecipeCounts[names[i]] != summary.RecipeCounts[names[j]] {
+				return summary.RecipeCounts[names[i]] > summary.RecipeCounts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		fmt.Printf("%s: %d images, average score %.1f\n", group, summary.Images, summary.AverageScore())
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"Recipe", "Images"})
+		for _, name := range names {
+			table.Append([]string{name, strconv.Itoa(summary.RecipeCounts[name])})
+		}
+		table.Render()
+
+		if len(summary.Unmatched) > 0 {
+			fmt.Printf("No good match for %d images:\n", len(summary.Unmatched))
+			for _, filename := range summary.Unmatched {
+				fmt.Printf("  %s\n", filename)
+			}
+		}
+
+		fmt.Println()
+	}
+}
+
+func printUsage(summaries map[string][]filmdetect.RecipeUsage) {
+	var groups []string
+	for group := range summaries {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for _, group := range groups {
+		detections := 0
+		for _, usage := range summaries[group] {
+			detections += usage.Detections
+		}
+		fmt.Printf("%s: %d detections\n", group, detections)
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"Recipe", "Detections", "Perfect", "Last detected"})
+		for _, usage := range summaries[group] {
+			table.Append([]string{
+				usage.Recipe,
+				strconv.Itoa(usage.Detections),
+				strconv.Itoa(usage.Perfect),
+				usage.Last.Local().Format(time.DateOnly),
+			})
+		}
+		table.Render()
+
+		fmt.Println()
+	}
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&StatsGroupBy, "group-by", "none", "Group results by none, month or camera")
+	statsRecipesCmd.Flags().StringVar(&UsageGroupBy, "group-by", "none", "Group detections by none, month or camera")
+	statsRecipesCmd.Flags().StringVar(&UsageSince, "since", "", "Only count detections since this date, YYYY-MM-DD")
+	statsCmd.AddCommand(statsRecipesCmd)
+	rootCmd.AddCommand(statsCmd)
+}
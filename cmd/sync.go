@@ -0,0 +1,96 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var (
+	SyncURL      string
+	TrustedKeys  []string
+	SyncInsecure bool
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync <collection> --url <dump>",
+	Short: "Download a published recipe collection into the simulation dir",
+	Long: "Download a published recipe collection, a JSON array of recipes at --url, into the\n" +
+		"<collection> subdirectory of the first simulation dir.  The recipes have to be signed with\n" +
+		"minisign by a trusted key, with the signature next to them at <url>.minisig.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		collection := args[0]
+		if collection == "" || collection != filepath.Base(collection) {
+			fail(fmt.Errorf("Invalid collection '%s', expected the name of a directory.", collection))
+		}
+
+		dirs := simulationDirs()
+		if len(dirs) == 0 {
+			fail(fmt.Errorf("Simulation dir can't be empty."))
+		}
+
+		keys, err := trustedKeys()
+		if err != nil {
+			fail(err)
+		}
+		source := filmdetect.Source{DumpURL: SyncURL, Keys: keys, Insecure: SyncInsecure}
+
+		files, err := filmdetect.SyncRecipes(context.Background(), source, filepath.Join(dirs[0], collection))
+		if errors.Is(err, filmdetect.ErrUnsigned) {
+			err = fmt.Errorf("%w\nTrust the key of the collection with --trusted-key, or pass --insecure to sync it anyway.", err)
+		}
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Synced %d recipes into %s.\n", len(files), filepath.Join(dirs[0], collection))
+	},
+}
+
+// trustedKeys reads the keys of --trusted-key and of the trusted keys dir.
+func trustedKeys() ([]filmdetect.PublicKey, error) {
+	keys, err := filmdetect.ReadPublicKeys(TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := filmdetect.TrustedKeysDir()
+	if err != nil {
+		return keys, nil
+	}
+	dirKeys, err := filmdetect.TrustedKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keys, dirKeys...), nil
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&SyncURL, "url", "", "Download the recipes from this URL, a JSON array of recipes")
+	syncCmd.MarkFlagRequired("url")
+	syncCmd.Flags().StringArrayVar(&TrustedKeys, "trusted-key", nil, "Trust recipes signed by this minisign public key file, on top of the keys in the trusted keys dir")
+	syncCmd.Flags().BoolVar(&SyncInsecure, "insecure", false, "Sync recipes that aren't signed by a trusted key")
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,302 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [image]",
+	Short: "Browse the recipes, and the closest recipes of an image",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		model := tuiModel{recipes: loadRecipes()}
+
+		if len(args) == 1 {
+			requireDependencies()
+
+			local, cleanup, err := localImage(args[0])
+			if err != nil {
+				fail(err)
+			}
+
+			extraction, err := extract(local)
+			cleanup()
+			if err != nil {
+				fail(err)
+			}
+
+			model.image = args[0]
+			model.extraction = extraction
+			model.ranked = filmdetect.RankRecipes(model.recipes, extraction.Recipe,
+				filmdetect.Options{Scorer: scorer(), Camera: extraction.Model, Overrides: overrides()})
+			model.view = tuiCandidates
+		}
+
+		if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+			fail(err)
+		}
+	},
+}
+
+// The screens of the TUI, switched between with tab
+const (
+	tuiRecipes = iota
+	tuiPhoto
+	tuiCandidates
+)
+
+var (
+	tuiTitle    = lipgloss.NewStyle().Bold(true)
+	tuiSelected = lipgloss.NewStyle().Reverse(true)
+	tuiMatch    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	tuiMismatch = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	tuiFaint    = lipgloss.NewStyle().Faint(true)
+)
+
+type tuiModel struct {
+	recipes    []filmdetect.Recipe
+	image      string
+	extraction filmdetect.ExtractionResult
+	ranked     []filmdetect.Difference
+
+	view      int
+	recipe    int
+	candidate int
+	// Whether the selected recipe is shown instead of the list
+	details bool
+	height  int
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "tab":
+			m.view = m.nextView()
+		case "up", "k":
+			if m.view == tuiRecipes && !m.details && m.recipe > 0 {
+				m.recipe--
+			}
+		case "down", "j":
+			if m.view == tuiRecipes && !m.details && m.recipe < len(m.recipes)-1 {
+				m.recipe++
+			}
+		case "enter":
+			if m.view == tuiRecipes {
+				m.details = !m.details
+			}
+		case "esc":
+			m.details = false
+		case "left", "h", "p":
+			if m.view == tuiCandidates && m.candidate > 0 {
+				m.candidate--
+			}
+		case "right", "l", "n":
+			if m.view == tuiCandidates && m.candidate < len(m.ranked)-1 {
+				m.candidate++
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// nextView cycles through the screens; the photo screens need an image.
+func (m tuiModel) nextView() int {
+	if m.image == "" {
+		return tuiRecipes
+	}
+
+	return (m.view + 1) % 3
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+
+	tabs := []string{"Recipes"}
+	if m.image != "" {
+		tabs = append(tabs, "Photo", "Candidates")
+	}
+	for i, tab := range tabs {
+		if i == m.view {
+			tab = tuiSelected.Render(" " + tab + " ")
+		} else {
+			tab = " " + tab + " "
+		}
+		b.WriteString(tab)
+	}
+	b.WriteString("\n\n")
+
+	switch m.view {
+	case tuiRecipes:
+		if m.details && len(m.recipes) > 0 {
+			m.viewRecipe(&b, m.recipes[m.recipe])
+		} else {
+			m.viewRecipeList(&b)
+		}
+	case tuiPhoto:
+		m.viewPhoto(&b)
+	case tuiCandidates:
+		m.viewCandidate(&b)
+	}
+
+	b.WriteString("\n" + tuiFaint.Render(m.help()))
+	return b.String()
+}
+
+func (m tuiModel) help() string {
+	help := "q quit"
+	if m.image != "" {
+		help += " · tab switch screen"
+	}
+
+	switch {
+	case m.view == tuiRecipes && m.details:
+		help += " · enter/esc back"
+	case m.view == tuiRecipes:
+		help += " · ↑/↓ select · enter show"
+	case m.view == tuiCandidates:
+		help += " · ←/→ previous/next candidate"
+	}
+
+	return help
+}
+
+func (m tuiModel) viewRecipeList(b *strings.Builder) {
+	if len(m.recipes) == 0 {
+		b.WriteString("There are no recipes.\n")
+		return
+	}
+
+	// Keep the selection on screen, leaving room for the tabs and help
+	rows := m.height - 5
+	if rows < 1 {
+		rows = len(m.recipes)
+	}
+	first := 0
+	if m.recipe >= rows {
+		first = m.recipe - rows + 1
+	}
+
+	width := 0
+	for _, recipe := range m.recipes {
+		if len(recipe.FullName()) > width {
+			width = len(recipe.FullName())
+		}
+	}
+
+	for i := first; i < len(m.recipes) && i < first+rows; i++ {
+		line := fmt.Sprintf("%-*s  %s", width, m.recipes[i].FullName(), m.recipes[i].FilmSimulation)
+		if i == m.recipe {
+			line = tuiSelected.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+}
+
+func (m tuiModel) viewRecipe(b *strings.Builder, recipe filmdetect.Recipe) {
+	b.WriteString(tuiTitle.Render(recipe.FullName()) + "\n")
+	if recipe.Author != "" {
+		b.WriteString("by " + recipe.Author + "\n")
+	}
+	if recipe.Url != "" {
+		b.WriteString(recipe.Url + "\n")
+	}
+	if recipe.Notes != "" {
+		b.WriteString(recipe.Notes + "\n")
+	}
+	if len(recipe.Tags) > 0 {
+		b.WriteString("Tags: " + strings.Join(recipe.Tags, ", ") + "\n")
+	}
+	b.WriteString("\n")
+
+	v := reflect.ValueOf(recipe)
+	for _, name := range filmdetect.ScoringFields() {
+		fmt.Fprintf(b, "%-22s %v\n", name, v.FieldByName(name).Interface())
+	}
+}
+
+func (m tuiModel) viewPhoto(b *strings.Builder) {
+	e := m.extraction
+
+	b.WriteString(tuiTitle.Render(m.image) + "\n")
+	fmt.Fprintf(b, "%-22s %s\n", "Camera", e.Camera())
+	if !e.CaptureTime.IsZero() {
+		fmt.Fprintf(b, "%-22s %s\n", "Captured", e.CaptureTime.Format("2006-01-02 15:04:05"))
+	}
+	if e.CustomSlot != "" {
+		fmt.Fprintf(b, "%-22s %s\n", "Custom setting", e.CustomSlot)
+	}
+	fmt.Fprintf(b, "%-22s %d\n", "ISO", e.ISO)
+	fmt.Fprintf(b, "%-22s %+.1f\n\n", "Exposure compensation", e.ExposureCompensation)
+
+	v := reflect.ValueOf(e.Recipe)
+	for _, name := range filmdetect.ScoringFields() {
+		fmt.Fprintf(b, "%-22s %v\n", name, v.FieldByName(name).Interface())
+	}
+}
+
+func (m tuiModel) viewCandidate(b *strings.Builder) {
+	if len(m.ranked) == 0 {
+		b.WriteString("There are no recipes to compare with.\n")
+		return
+	}
+
+	d := m.ranked[m.candidate]
+	title := fmt.Sprintf("%d/%d  %s", m.candidate+1, len(m.ranked), d.Candidate.FullName())
+	b.WriteString(tuiTitle.Render(title) + "\n")
+
+	summary := fmt.Sprintf("Score %.1f, %d settings differ", d.Score(), len(d.Mismatches()))
+	if d.Confidence != filmdetect.UnknownConfidence {
+		summary += fmt.Sprintf(", %s confidence", d.Confidence)
+	}
+	b.WriteString(summary + "\n\n")
+
+	fmt.Fprintf(b, "  %-22s %-24s %s\n", "", "Photo", "Recipe")
+	for _, field := range d.Fields() {
+		line := fmt.Sprintf("%-22s %-24s %s", filmdetect.FieldLabel(field.Field), filmdetect.FormatValue(field.Field, field.Input),
+			filmdetect.FormatValue(field.Field, field.Candidate))
+		if field.Matched {
+			b.WriteString("  " + tuiMatch.Render(line) + "\n")
+		} else {
+			b.WriteString("≠ " + tuiMismatch.Render(line) + "\n")
+		}
+	}
+}
+
+func init() {
+	tuiCmd.Flags().BoolVar(&Force, "force", false, "Compare images of cameras other than Fujifilm ones too")
+	tuiCmd.Flags().StringArrayVar(&Overrides, "set", nil, "Compare Field=Value instead of the setting read from the image, e.g. DynamicRange=400")
+	rootCmd.AddCommand(tuiCmd)
+}
@@ -0,0 +1,115 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/spf13/cobra"
+)
+
+var (
+	UpdateURL      string
+	UpdateCheck    bool
+	UpdateInsecure bool
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Install the latest release of the recipe database",
+	Long: "Check the release manifest for a new release of the recipe database, verify its checksum\n" +
+		"and install it into the config dir, where it updates the builtin recipes.  The manifest\n" +
+		"URL is read from --url or $" + filmdetect.UpdateURLEnv + ".  The manifest has to be signed with\n" +
+		"minisign by a trusted key, with the signature next to it at <url>.minisig.  This doesn't\n" +
+		"update filmdetect itself.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		manifestURL := UpdateURL
+		if manifestURL == "" {
+			manifestURL = os.Getenv(filmdetect.UpdateURLEnv)
+		}
+		if manifestURL == "" {
+			fail(fmt.Errorf("No release manifest configured, pass one with --url or set $%s.", filmdetect.UpdateURLEnv))
+		}
+
+		dir, err := filmdetect.DatabaseDir()
+		if err != nil {
+			fail(err)
+		}
+
+		installed, ok, err := filmdetect.InstalledRelease(dir)
+		if err != nil {
+			fail(err)
+		}
+
+		keys, err := trustedKeys()
+		if err != nil {
+			fail(err)
+		}
+
+		release, err := filmdetect.FetchRelease(context.Background(), manifestURL, keys, UpdateInsecure)
+		if errors.Is(err, filmdetect.ErrUnsigned) {
+			err = fmt.Errorf("%w\nTrust the key of the release with --trusted-key, or pass --insecure to update anyway.", err)
+		}
+		if err != nil {
+			fail(err)
+		}
+
+		if ok && installed.Version == release.Version {
+			fmt.Printf("The recipe database is up to date, version %s.\n", installed.Version)
+			return
+		}
+
+		if UpdateCheck {
+			if ok {
+				fmt.Printf("Version %s of the recipe database is available, %s is installed.\n", release.Version, installed.Version)
+			} else {
+				fmt.Printf("Version %s of the recipe database is available.\n", release.Version)
+			}
+			return
+		}
+
+		recipes, err := filmdetect.InstallRelease(context.Background(), release, dir)
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Installed version %s of the recipe database, %d recipes, into %s.\n", release.Version, len(recipes), dir)
+	},
+}
+
+// databaseRecipes returns the recipes of the installed recipe database.
+func databaseRecipes() ([]filmdetect.Recipe, error) {
+	dir, err := filmdetect.DatabaseDir()
+	if err != nil {
+		// Without a config dir, nothing can have been installed
+		return nil, nil
+	}
+	return filmdetect.DatabaseRecipes(dir)
+}
+
+func init() {
+	updateCmd.Flags().StringVar(&UpdateURL, "url", "", "URL of the release manifest of the recipe database")
+	updateCmd.Flags().BoolVar(&UpdateCheck, "check", false, "Only report whether there's a new release")
+	updateCmd.Flags().StringArrayVar(&TrustedKeys, "trusted-key", nil, "Trust releases signed by this minisign public key file, on top of the keys in the trusted keys dir")
+	updateCmd.Flags().BoolVar(&UpdateInsecure, "insecure", false, "Install releases that aren't signed by a trusted key")
+	rootCmd.AddCommand(updateCmd)
+}
@@ -0,0 +1,152 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// versionReport is what filmdetect version prints, to be included when
+// reporting results that differ from someone else's.
+type versionReport struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit,omitempty"`
+	Go             string `json:"go"`
+	Exiftool       string `json:"exiftool"`
+	Database       string `json:"database,omitempty"`
+	DatabaseSHA256 string `json:"database_sha256,omitempty"`
+	Recipes        int    `json:"recipes"`
+	RecipesHash    string `json:"recipes_hash,omitempty"`
+	RecipesError   string `json:"recipes_error,omitempty"`
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version of filmdetect, exiftool and the recipes",
+	Long: `Print the version and commit filmdetect was built from, the Go version it was
+built with, the version of exiftool, the version of the installed recipe
+database, and a hash of the recipes loaded with the other flags given.  Two
+installations printing the same detect the same recipes.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		report := versionReport{Version: version(), Commit: commit(), Go: runtime.Version()}
+
+		if exiftool, err := filmdetect.ExiftoolVersion(); err != nil {
+			report.Exiftool = "not found"
+		} else {
+			report.Exiftool = strconv.FormatFloat(exiftool, 'f', -1, 64)
+		}
+
+		if dir, err := filmdetect.DatabaseDir(); err == nil {
+			if release, ok, err := filmdetect.InstalledRelease(dir); err == nil && ok {
+				report.Database = release.Version
+				report.DatabaseSHA256 = release.SHA256
+			}
+		}
+
+		recipes, err := readRecipes()
+		if err == nil {
+			report.Recipes = len(recipes)
+			report.RecipesHash, err = filmdetect.RecipesHash(recipes)
+		}
+		if err != nil {
+			report.RecipesError = err.Error()
+		}
+
+		if Output == "json" {
+			if err := printJSON(report); err != nil {
+				fail(err)
+			}
+			return
+		}
+
+		database := "not installed"
+		if report.Database != "" {
+			database = fmt.Sprintf("%s (sha256 %s)", report.Database, report.DatabaseSHA256)
+		}
+		recipesRow := fmt.Sprintf("%d (hash %s)", report.Recipes, report.RecipesHash)
+		if report.RecipesError != "" {
+			recipesRow = report.RecipesError
+		}
+		commitRow := report.Commit
+		if commitRow == "" {
+			commitRow = "unknown"
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAutoWrapText(false)
+		table.AppendBulk([][]string{
+			{"filmdetect", report.Version},
+			{"Commit", commitRow},
+			{"Go", report.Go},
+			{"exiftool", report.Exiftool},
+			{"Recipe database", database},
+			{"Recipes", recipesRow},
+		})
+		table.Render()
+	},
+}
+
+// version returns the version filmdetect was built as, which is "(devel)"
+// when it wasn't built from a tagged module.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+
+	return info.Main.Version
+}
+
+// commit returns the revision of the repository filmdetect was built from,
+// marked dirty when it had uncommitted changes, or "" when it wasn't built
+// from a repository.
+func commit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+
+	return revision
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,171 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	VisualFallback bool
+	VisualModel    string
+	VisualOut      string
+)
+
+// How many families the visual fallback shows
+const visualGuessCount = 3
+
+// visualReport is the JSON output of the visual fallback.
+type visualReport struct {
+	File     string                    `json:"file"`
+	Visual   bool                      `json:"visual"`
+	Model    string                    `json:"model,omitempty"`
+	Features filmdetect.VisualFeatures `json:"features"`
+	Guesses  []filmdetect.VisualGuess  `json:"guesses"`
+}
+
+// visualModel returns the model of --visual-model, or the builtin one.
+func visualModel() (filmdetect.VisualModel, error) {
+	if VisualModel == "" {
+		return filmdetect.DefaultVisualModel(), nil
+	}
+	return filmdetect.ReadVisualModel(VisualModel)
+}
+
+// runVisualFallback guesses the film simulation family of an image without
+// camera settings from its colors, for --visual-fallback.
+func runVisualFallback(filename, local string) int {
+	model, err := visualModel()
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+
+	features, err := filmdetect.ReadVisualFeatures(local)
+	if err != nil {
+		printError(err)
+		return ExitError
+	}
+
+	guesses := model.Classify(features)
+	guesses = guesses[:min(visualGuessCount, len(guesses))]
+	slog.Info("Guessed from colors", "file", filename, "family", guesses[0].Family, "confidence", guesses[0].Confidence)
+
+	if Output == "json" {
+		err := printJSON(visualReport{File: filename, Visual: true, Model: model.Source, Features: features, Guesses: guesses})
+		if err != nil {
+			printError(err)
+			return ExitError
+		}
+		return ExitNoMatch
+	}
+
+	fmt.Println("The image has no camera settings.  Judging by its colors alone, the film simulation may be:")
+
+	uncalibrated := false
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Family", "Film simulations", "Confidence"})
+	for _, guess := range guesses {
+		confidence := fmt.Sprintf("%.0f%%", guess.Confidence*100)
+		if !guess.Calibrated {
+			confidence += " (uncalibrated)"
+			uncalibrated = true
+		}
+		table.Append([]string{guess.Family, strings.Join(guess.Simulations, ", "), confidence})
+	}
+	table.Render()
+
+	if uncalibrated {
+		fmt.Println("Uncalibrated guesses come from hand-set colors, not from photos.  Fit them to your own with train-visual.")
+	}
+
+	return ExitNoMatch
+}
+
+var trainVisualCmd = &cobra.Command{
+	Use:   "train-visual <photo-dir>",
+	Short: "Fit the model of --visual-fallback to photos that still have their camera settings",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDependencies()
+
+		base, err := visualModel()
+		if err != nil {
+			fail(err)
+		}
+
+		files, err := filmdetect.GetImageFiles(args[0])
+		if err != nil {
+			fail(err)
+		}
+
+		var samples []filmdetect.VisualSample
+		counts := map[string]int{}
+		for _, file := range files {
+			extraction, err := extract(file)
+			if err != nil || extraction.Recipe.FilmSimulation == "" {
+				slog.Warn("Skipping image without camera settings", "file", file, "err", err)
+				continue
+			}
+
+			features, err := filmdetect.ReadVisualFeatures(file)
+			if err != nil {
+				slog.Warn("Skipping image that can't be decoded", "file", file, "err", err)
+				continue
+			}
+
+			samples = append(samples, filmdetect.VisualSample{FilmSimulation: extraction.Recipe.FilmSimulation, Features: features})
+			counts[extraction.Recipe.FilmSimulation]++
+		}
+
+		if len(samples) == 0 {
+			fail(fmt.Errorf("No images with camera settings to train on."))
+		}
+
+		model := filmdetect.TrainVisualModel(base, samples)
+		contents, err := json.MarshalIndent(model, "", "  ")
+		if err != nil {
+			fail(err)
+		}
+		if err := os.WriteFile(VisualOut, append(contents, '\n'), 0644); err != nil {
+			fail(err)
+		}
+
+		for _, family := range model.Families {
+			if family.Samples > 0 {
+				fmt.Printf("%s: %d images\n", family.Name, family.Samples)
+			}
+		}
+		fmt.Printf("Saved the model to %s, use it with --visual-model %s.\n", VisualOut, VisualOut)
+	},
+}
+
+func init() {
+	detectCmd.Flags().BoolVar(&VisualFallback, "visual-fallback", false, "Guess the film simulation family from the colors of images without camera settings")
+	rootCmd.PersistentFlags().StringVar(&VisualModel, "visual-model", "", "Model for --visual-fallback, as saved by train-visual")
+	trainVisualCmd.Flags().StringVar(&VisualOut, "out", "visual-model.json", "Where to save the model")
+	rootCmd.AddCommand(trainVisualCmd)
+}
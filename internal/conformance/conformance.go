@@ -0,0 +1,207 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package conformance checks metadata backends against sample images with
+// known settings.  Every image in testdata has a golden file next to it,
+// e.g. X-T4_classic_chrome.jpg and X-T4_classic_chrome.jpg.golden.json, with
+// what extracting it has to give.  A backend, e.g. a native parser replacing
+// exiftool, has to give the same for every image before it can be trusted:
+// its tests call ExtractorConformance.
+package conformance
+
+//go:generate go run samples.go
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// GoldenSuffix is appended to the name of an image for its golden file.
+const GoldenSuffix = ".golden.json"
+
+// Dir is the directory of the sample images.
+var Dir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}()
+
+// Golden is what extracting a sample image has to give.  Recipe files leave
+// out the settings they don't set, so the ones the image doesn't have are
+// listed in Unset.
+type Golden struct {
+	Make   string            `json:"make"`
+	Model  string            `json:"model"`
+	Recipe filmdetect.Recipe `json:"recipe"`
+	Unset  []string          `json:"unset,omitempty"`
+}
+
+// Fixtures returns the sample images in dir that have a golden file.
+func Fixtures(dir string) ([]string, error) {
+	images, err := sampleImages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(images, func(image string) bool {
+		_, err := os.Stat(image + GoldenSuffix)
+		return err != nil
+	}), nil
+}
+
+// ExtractorConformance extracts every sample image with backend, and fails
+// t for every setting that doesn't match the golden file.
+func ExtractorConformance(t *testing.T, backend filmdetect.MetadataBackend) {
+	t.Helper()
+
+	images, err := Fixtures(Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) == 0 {
+		t.Fatalf("%s has no sample images with golden files", Dir)
+	}
+
+	extractor := filmdetect.NewExtractorWithBackend(backend)
+
+	for _, image := range images {
+		t.Run(filepath.Base(image), func(t *testing.T) {
+			want, err := readGolden(image + GoldenSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := extractor.Extract(image)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, problem := range compare(want, got) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// compare lists the differences between what an image has to give and what
+// it gave.  Every field of the recipe is compared, whether it's scored or
+// not.
+func compare(want Golden, got filmdetect.ExtractionResult) []string {
+	var problems []string
+
+	if got.Make != want.Make {
+		problems = append(problems, fmt.Sprintf("Make is '%s', expected '%s'", got.Make, want.Make))
+	}
+	if got.Model != want.Model {
+		problems = append(problems, fmt.Sprintf("Model is '%s', expected '%s'", got.Model, want.Model))
+	}
+
+	gotRecipe := reflect.ValueOf(got.Recipe)
+	wantRecipe := reflect.ValueOf(want.Recipe)
+	for i := 0; i < gotRecipe.NumField(); i++ {
+		field := gotRecipe.Type().Field(i).Name
+		if field == "Unset" {
+			continue
+		}
+
+		g, w := gotRecipe.Field(i).Interface(), wantRecipe.Field(i).Interface()
+		if !reflect.DeepEqual(g, w) {
+			problems = append(problems, fmt.Sprintf("%s is %#v, expected %#v", field, g, w))
+		}
+	}
+
+	gotUnset := slices.Sorted(slices.Values(got.Recipe.Unset))
+	wantUnset := slices.Sorted(slices.Values(want.Unset))
+	if !slices.Equal(gotUnset, wantUnset) {
+		problems = append(problems, fmt.Sprintf("Unset is %v, expected %v", gotUnset, wantUnset))
+	}
+
+	return problems
+}
+
+// UpdateGoldens writes the golden file of every image in dir from what
+// backend extracts, for new sample images.  Check them by hand: they are
+// only as right as the backend.
+func UpdateGoldens(backend filmdetect.MetadataBackend, dir string) ([]string, error) {
+	images, err := sampleImages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	extractor := filmdetect.NewExtractorWithBackend(backend)
+
+	var written []string
+	for _, image := range images {
+		got, err := extractor.Extract(image)
+		if err != nil {
+			return written, err
+		}
+
+		golden := Golden{Make: got.Make, Model: got.Model, Recipe: got.Recipe, Unset: got.Recipe.Unset}
+		contents, err := json.MarshalIndent(golden, "", "  ")
+		if err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(image+GoldenSuffix, append(contents, '\n'), 0644); err != nil {
+			return written, err
+		}
+		written = append(written, image+GoldenSuffix)
+	}
+
+	return written, nil
+}
+
+// sampleImages returns the images in dir.
+func sampleImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, entry := range entries {
+		if entry.IsDir() || !filmdetect.HasExtension(entry.Name(), filmdetect.ImageExtensions...) {
+			continue
+		}
+		images = append(images, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(images)
+
+	return images, nil
+}
+
+func readGolden(filename string) (Golden, error) {
+	var golden Golden
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return golden, err
+	}
+
+	if err := json.Unmarshal(contents, &golden); err != nil {
+		return golden, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return golden, nil
+}
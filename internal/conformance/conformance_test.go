@@ -0,0 +1,56 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conformance
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+var (
+	backendName = flag.String("backend", filmdetect.DefaultBackend, "The metadata backend to check")
+	update      = flag.Bool("update", false, "Write the golden files from what the backend reads")
+)
+
+func TestExtractorConformance(t *testing.T) {
+	backend, err := filmdetect.OpenBackend(*backendName)
+	if errors.Is(err, filmdetect.ErrExiftoolMissing) {
+		t.Skip("exiftool isn't installed")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closer, ok := backend.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if *update {
+		written, err := UpdateGoldens(backend, Dir)
+		for _, golden := range written {
+			t.Logf("Wrote %s", golden)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ExtractorConformance(t, backend)
+}
@@ -0,0 +1,369 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build ignore
+
+// samples writes the sample images of testdata: small JPEGs carrying the
+// EXIF and Fujifilm maker notes of a camera set to a known recipe, laid out
+// the way the cameras write them.  Run it with go generate after changing a
+// sample, then update and check the golden files.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeSByte     = 6
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+)
+
+var order = binary.LittleEndian
+
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func ascii(tag uint16, s string) entry {
+	return entry{tag, typeASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func short(tag uint16, v uint16) entry {
+	return entry{tag, typeShort, 1, order.AppendUint16(nil, v)}
+}
+
+func slong(tag uint16, values ...int32) entry {
+	var data []byte
+	for _, v := range values {
+		data = order.AppendUint32(data, uint32(v))
+	}
+	return entry{tag, typeSLong, uint32(len(values)), data}
+}
+
+func sbyte(tag uint16, v int8) entry {
+	return entry{tag, typeSByte, 1, []byte{byte(v)}}
+}
+
+func long(tag uint16, v uint32) entry {
+	return entry{tag, typeLong, 1, order.AppendUint32(nil, v)}
+}
+
+func rational(tag uint16, typ uint16, numerator, denominator int32) entry {
+	data := order.AppendUint32(nil, uint32(numerator))
+	return entry{tag, typ, 1, order.AppendUint32(data, uint32(denominator))}
+}
+
+func undefined(tag uint16, data []byte) entry {
+	return entry{tag, typeUndefined, uint32(len(data)), data}
+}
+
+// ifd lays out entries, sorted by tag, as an IFD starting at offset, with
+// the values that don't fit in an entry right after it.
+func ifd(offset int, entries []entry) []byte {
+	size := 2 + 12*len(entries) + 4
+	var table, values []byte
+
+	table = order.AppendUint16(table, uint16(len(entries)))
+	for _, e := range entries {
+		table = order.AppendUint16(table, e.tag)
+		table = order.AppendUint16(table, e.typ)
+		table = order.AppendUint32(table, e.count)
+		if len(e.data) <= 4 {
+			table = append(table, e.data...)
+			table = append(table, make([]byte, 4-len(e.data))...)
+			continue
+		}
+		table = order.AppendUint32(table, uint32(offset+size+len(values)))
+		values = append(values, e.data...)
+		if len(values)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	table = order.AppendUint32(table, 0)
+
+	return append(table, values...)
+}
+
+// makerNote is a Fujifilm maker note, whose offsets count from its start.
+func makerNote(entries []entry) []byte {
+	note := []byte("FUJIFILM")
+	note = order.AppendUint32(note, 12)
+	return append(note, ifd(12, entries)...)
+}
+
+// exif is the TIFF structure of an APP1 segment: IFD0 with the camera, and
+// the EXIF IFD with the exposure and the maker note.
+func exif(cameraMake, model string, exposure, note []entry) []byte {
+	ifd0 := func(exifOffset uint32) []entry {
+		return []entry{ascii(0x010f, cameraMake), ascii(0x0110, model), long(0x8769, exifOffset)}
+	}
+
+	header := []byte("II")
+	header = order.AppendUint16(header, 42)
+	header = order.AppendUint32(header, 8)
+
+	exifOffset := 8 + len(ifd(8, ifd0(0)))
+	tiff := append(header, ifd(8, ifd0(uint32(exifOffset)))...)
+
+	exposure = append(exposure, undefined(0x9000, []byte("0232")), undefined(0x927c, makerNote(note)))
+	return append(tiff, ifd(exifOffset, sorted(exposure))...)
+}
+
+func sorted(entries []entry) []entry {
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && entries[j].tag < entries[j-1].tag; j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+		}
+	}
+	return entries
+}
+
+// jpegWithExif encodes a small gray image, with an APP1 segment holding
+// tiff right after the start of image marker.
+func jpegWithExif(tiff []byte) []byte {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = color.Gray{Y: 128}.Y
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 50}); err != nil {
+		log.Fatal(err)
+	}
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	b := encoded.Bytes()
+	return append(append(append([]byte{}, b[:2]...), segment...), b[2:]...)
+}
+
+// box is an ISO base media file format box.
+func box(kind string, contents ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(bytes.Join(contents, nil))))
+	b = append(b, kind...)
+	return append(b, bytes.Join(contents, nil)...)
+}
+
+// fullBox is a box with a version and flags.
+func fullBox(kind string, version byte, contents ...[]byte) []byte {
+	return box(kind, append([][]byte{{version, 0, 0, 0}}, contents...)...)
+}
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// heifWithExif is a HEIF file with tiff in its Exif item, the way the
+// cameras store it.  The primary image item has no image data, which
+// reading metadata doesn't need.
+func heifWithExif(tiff []byte) []byte {
+	const imageItem, exifItem = 1, 2
+
+	ftyp := box("ftyp", []byte("heic"), u32(0), []byte("mif1heic"))
+
+	// The Exif item starts with the offset of the TIFF header
+	exifData := append(u32(6), "Exif\x00\x00"...)
+	exifData = append(exifData, tiff...)
+
+	meta := func(mdatOffset uint32) []byte {
+		iloc := fullBox("iloc", 0,
+			[]byte{0x44, 0x00}, u16(1),
+			u16(exifItem), u16(0), u16(1), u32(mdatOffset+8), u32(uint32(len(exifData))),
+		)
+		return fullBox("meta", 0,
+			fullBox("hdlr", 0, u32(0), []byte("pict"), make([]byte, 12), []byte{0}),
+			fullBox("pitm", 0, u16(imageItem)),
+			fullBox("iinf", 0, u16(2),
+				fullBox("infe", 2, u16(imageItem), u16(0), []byte("hvc1"), []byte{0}),
+				fullBox("infe", 2, u16(exifItem), u16(0), []byte("Exif"), []byte{0}),
+			),
+			fullBox("iref", 0, box("cdsc", u16(exifItem), u16(1), u16(imageItem))),
+			iloc,
+		)
+	}
+
+	mdatOffset := uint32(len(ftyp) + len(meta(0)))
+	return bytes.Join([][]byte{ftyp, meta(mdatOffset), box("mdat", exifData)}, nil)
+}
+
+// A sample is a camera set to a recipe.  The maker note values are the raw
+// ones; the comments say what the camera menus show.
+type sample struct {
+	file     string
+	make     string
+	model    string
+	exposure []entry
+	note     []entry
+}
+
+var samples = []sample{
+	{
+		file:  "X-T4_classic_chrome.jpg",
+		make:  "FUJIFILM",
+		model: "X-T4",
+		exposure: []entry{
+			rational(0x829a, typeRational, 1, 250),
+			rational(0x829d, typeRational, 56, 10),
+			short(0x8827, 640),
+			ascii(0x9003, "2023:05:14 10:22:31"),
+			rational(0x9204, typeSRational, 1, 3),
+		},
+		note: []entry{
+			undefined(0x0000, []byte("0130")),
+			short(0x1001, 0x82),     // Sharpness -1
+			short(0x1002, 0x100),    // Daylight
+			short(0x1003, 0x100),    // Color +2
+			slong(0x100a, 40, -100), // WB shift R+2 B-5
+			short(0x100e, 0x2e0),    // Noise reduction -4
+			slong(0x100f, -2000),    // Clarity -2
+			slong(0x1040, -16),      // Shadows +1
+			slong(0x1041, 16),       // Highlights -1
+			slong(0x1047, 32),       // Grain Weak
+			slong(0x1048, 64),       // Color Chrome Effect Strong
+			short(0x104c, 16),       // Grain Small
+			slong(0x104e, 0),        // Color Chrome FX Blue Off
+			short(0x1401, 0x600),    // Classic Chrome
+			short(0x1402, 0x1),      // DR Manual
+			short(0x1403, 200),      // DR200
+		},
+	},
+	{
+		file:  "X-T3_acros_yellow.jpg",
+		make:  "FUJIFILM",
+		model: "X-T3",
+		exposure: []entry{
+			rational(0x829a, typeRational, 1, 60),
+			rational(0x829d, typeRational, 8, 1),
+			short(0x8827, 3200),
+			ascii(0x9003, "2022:11:02 17:48:05"),
+			rational(0x9204, typeSRational, -2, 3),
+		},
+		note: []entry{
+			undefined(0x0000, []byte("0130")),
+			short(0x1001, 0x84),  // Sharpness +1
+			short(0x1002, 0x0),   // Auto
+			short(0x1003, 0x502), // Acros, Yellow filter
+			slong(0x100a, 0, 0),  // No WB shift
+			short(0x100e, 0x0),   // Noise reduction 0
+			slong(0x1040, -32),   // Shadows +2
+			slong(0x1041, -32),   // Highlights +2
+			slong(0x1047, 64),    // Grain Strong
+			slong(0x1048, 32),    // Color Chrome Effect Weak
+			sbyte(0x1049, 2),     // Toning Warm +2
+			sbyte(0x104b, -1),    // Toning Magenta -1
+			short(0x1402, 0x1),   // DR Manual
+			short(0x1403, 100),   // DR100
+		},
+	},
+	{
+		file:  "X100V_classic_negative.jpg",
+		make:  "FUJIFILM",
+		model: "X100V",
+		exposure: []entry{
+			rational(0x829a, typeRational, 1, 1000),
+			rational(0x829d, typeRational, 2, 1),
+			short(0x8827, 160),
+			ascii(0x9003, "2021:08:21 12:05:44"),
+			rational(0x9204, typeSRational, 0, 1),
+		},
+		note: []entry{
+			undefined(0x0000, []byte("0130")),
+			short(0x1001, 0x82),    // Sharpness -1
+			short(0x1002, 0x200),   // Cloudy
+			short(0x1003, 0x180),   // Color -1
+			slong(0x100a, -20, 60), // WB shift R-1 B+3
+			short(0x100e, 0x200),   // Noise reduction -2
+			slong(0x100f, 3000),    // Clarity +3
+			slong(0x1040, 32),      // Shadows -2
+			slong(0x1041, -32),     // Highlights +2
+			slong(0x1047, 0),       // Grain Off
+			slong(0x1048, 0),       // Color Chrome Effect Off
+			short(0x104c, 0),       // Grain size Off
+			slong(0x104e, 32),      // Color Chrome FX Blue Weak
+			short(0x1401, 0x800),   // Classic Negative
+			short(0x1402, 0x1),     // DR Manual
+			short(0x1403, 400),     // DR400
+		},
+	},
+	{
+		file:  "X-H2S_eterna.hif",
+		make:  "FUJIFILM",
+		model: "X-H2S",
+		exposure: []entry{
+			rational(0x829a, typeRational, 1, 125),
+			rational(0x829d, typeRational, 4, 1),
+			short(0x8827, 800),
+			ascii(0x9003, "2024:02:10 15:30:12"),
+			rational(0x9204, typeSRational, -1, 3),
+		},
+		note: []entry{
+			undefined(0x0000, []byte("0130")),
+			short(0x1001, 0x84),    // Sharpness +1
+			short(0x1002, 0x100),   // Daylight
+			short(0x1003, 0x180),   // Color -1
+			slong(0x100a, 60, -40), // WB shift R+3 B-2
+			short(0x100e, 0x280),   // Noise reduction -1
+			slong(0x100f, 1000),    // Clarity +1
+			slong(0x1040, 16),      // Shadows -1
+			slong(0x1041, -16),     // Highlights +1
+			slong(0x1047, 32),      // Grain Weak
+			slong(0x1048, 32),      // Color Chrome Effect Weak
+			short(0x104c, 32),      // Grain Large
+			slong(0x104e, 64),      // Color Chrome FX Blue Strong
+			short(0x1401, 0x700),   // Eterna
+			short(0x1402, 0x1),     // DR Manual
+			short(0x1403, 400),     // DR400
+		},
+	},
+}
+
+func main() {
+	for _, s := range samples {
+		tiff := exif(s.make, s.model, s.exposure, s.note)
+		contents := jpegWithExif(tiff)
+		if filepath.Ext(s.file) == ".hif" {
+			contents = heifWithExif(tiff)
+		}
+		if err := os.WriteFile(filepath.Join("testdata", s.file), contents, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
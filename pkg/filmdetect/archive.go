@@ -0,0 +1,240 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// IsRecipeArchive reports whether filename is an archive GetRecipes reads
+// recipes from: a .zip, .tar, .tar.gz or .tgz file.
+func IsRecipeArchive(filename string) bool {
+	lower := strings.ToLower(filename)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetRecipesFromArchive reads the recipes of a bundle, without extracting
+// it.  The archive is laid out like a simulation dir, except that a single
+// directory holding everything else, as in the archives GitHub makes, isn't
+// taken to be a collection.
+func GetRecipesFromArchive(filename string) ([]Recipe, error) {
+	return getRecipesFromArchive(filename, LoadOptions{}, &LoadReport{})
+}
+
+func getRecipesFromArchive(filename string, opts LoadOptions, report *LoadReport) ([]Recipe, error) {
+	files, err := readArchive(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	files = withoutTopDir(files)
+
+	var names []string
+	for name := range files {
+		if HasExtension(name, ".json") && path.Base(name) != DefaultsFile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var recipes []Recipe
+	for _, name := range names {
+		fileRecipes, err := parseArchiveRecipes(files, name, nil)
+
+		var chain []Recipe
+		for dir := path.Dir(name); err == nil; dir = path.Dir(dir) {
+			if contents, ok := files[path.Join(dir, DefaultsFile)]; ok {
+				defaults, decodeErr := decodeRecipe(contents, nil)
+				if decodeErr != nil {
+					err = fmt.Errorf("%s: %v", path.Join(dir, DefaultsFile), decodeErr)
+					break
+				}
+				chain = append(chain, defaults)
+			}
+			if dir == "." {
+				break
+			}
+		}
+
+		if err != nil {
+			// Named like a file in the archive, e.g. bundle.zip/classic.json
+			file := filename + "/" + name
+			if opts.skip(report, file, fmt.Errorf("%s/%v", filename, err)) {
+				continue
+			}
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+
+		for _, recipe := range fileRecipes {
+			if dir := path.Dir(name); dir != "." {
+				recipe.Collection = dir
+			}
+			for _, defaults := range chain {
+				recipe = recipe.WithDefaults(defaults)
+			}
+			recipes = append(recipes, recipe)
+		}
+	}
+
+	return recipes, nil
+}
+
+// parseArchiveRecipes is parseRecipesFile for a file in an archive.
+func parseArchiveRecipes(files map[string][]byte, name string, chain []string) ([]Recipe, error) {
+	for _, seen := range chain {
+		if seen == name {
+			return nil, fmt.Errorf("Recipe inheritance cycle: %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+
+	contents, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %v", name, os.ErrNotExist)
+	}
+
+	recipes, err := decodeRecipes(contents, func(extends string) (Recipe, error) {
+		base := path.Join(path.Dir(name), strings.ReplaceAll(extends, `\`, "/"))
+		bases, err := parseArchiveRecipes(files, base, append(chain, name))
+		if err != nil {
+			return Recipe{}, err
+		}
+		if len(bases) != 1 {
+			return Recipe{}, fmt.Errorf("%s: Expected a single recipe, found %d", base, len(bases))
+		}
+		return bases[0], nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return recipes, nil
+}
+
+// readArchive returns the contents of the JSON files in an archive by their
+// cleaned path, skipping hidden files and directories.
+func readArchive(filename string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	keep := func(name string) bool {
+		for _, part := range strings.Split(name, "/") {
+			if strings.HasPrefix(part, ".") {
+				return false
+			}
+		}
+		return HasExtension(name, ".json")
+	}
+
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		archive, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer archive.Close()
+
+		for _, entry := range archive.File {
+			name := path.Clean(strings.TrimPrefix(entry.Name, "/"))
+			if entry.FileInfo().IsDir() || !keep(name) {
+				continue
+			}
+
+			f, err := entry.Open()
+			if err != nil {
+				return nil, err
+			}
+			contents, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[name] = contents
+		}
+
+		return files, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(filename), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if header.Typeflag != tar.TypeReg || !keep(name) {
+			continue
+		}
+
+		contents, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = contents
+	}
+
+	return files, nil
+}
+
+// withoutTopDir strips the directory all files are in, if there is one.
+func withoutTopDir(files map[string][]byte) map[string][]byte {
+	top := ""
+	for name := range files {
+		dir, _, ok := strings.Cut(name, "/")
+		if !ok || (top != "" && dir != top) {
+			return files
+		}
+		top = dir
+	}
+
+	stripped := map[string][]byte{}
+	for name, contents := range files {
+		stripped[strings.TrimPrefix(name, top+"/")] = contents
+	}
+
+	return stripped
+}
@@ -0,0 +1,119 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+
+	"github.com/barasher/go-exiftool"
+)
+
+// MetadataBackend reads the metadata of an image.  Tags are named, and their
+// values formatted, the way exiftool prints them with -j.  A backend may also
+// implement io.Closer, which Extractor.Close calls.
+type MetadataBackend interface {
+	Extract(path string) (map[string]any, error)
+}
+
+// The backend NewExtractor uses
+var DefaultBackend = "exiftool"
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]func() (MetadataBackend, error){}
+)
+
+// RegisterBackend makes a metadata backend available under name, e.g. one
+// reading a photo manager's database instead of the files.  open is called
+// for every Extractor using the backend.
+func RegisterBackend(name string, open func() (MetadataBackend, error)) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, ok := backends[name]; ok {
+		panic("filmdetect: backend registered twice: " + name)
+	}
+
+	backends[name] = open
+}
+
+// Backends returns the names of the registered metadata backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// OpenBackend starts the metadata backend registered under name.
+func OpenBackend(name string) (MetadataBackend, error) {
+	backendsMu.RLock()
+	open, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown metadata backend: '%s'", name)
+	}
+
+	return open()
+}
+
+// exiftoolBackend keeps a single exiftool process around.
+type exiftoolBackend struct {
+	et *exiftool.Exiftool
+}
+
+func openExiftool() (MetadataBackend, error) {
+	if _, err := exec.LookPath("exiftool"); err != nil {
+		return nil, ErrExiftoolMissing
+	}
+
+	et, err := exiftool.NewExiftool()
+	if err != nil {
+		return nil, err
+	}
+
+	return exiftoolBackend{et: et}, nil
+}
+
+func (b exiftoolBackend) Extract(path string) (map[string]any, error) {
+	for _, fileInfo := range b.et.ExtractMetadata(path) {
+		if fileInfo.Err != nil {
+			return nil, fileInfo.Err
+		}
+		return fileInfo.Fields, nil
+	}
+
+	return nil, fmt.Errorf("exiftool didn't read %s", path)
+}
+
+func (b exiftoolBackend) Close() error {
+	return b.et.Close()
+}
+
+func init() {
+	RegisterBackend("exiftool", openExiftool)
+}
@@ -0,0 +1,79 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed builtin/*.json
+var builtinFiles embed.FS
+
+// The collection of the recipes compiled into filmdetect
+const BuiltinCollection = "builtin"
+
+// BuiltinRecipes returns the recipes compiled into filmdetect, so that it's
+// useful without a simulation dir.  They are the camera defaults of every
+// film simulation.
+func BuiltinRecipes() ([]Recipe, error) {
+	var recipes []Recipe
+
+	files, err := fs.Glob(builtinFiles, "builtin/*.json")
+	if err != nil {
+		return recipes, err
+	}
+
+	for _, file := range files {
+		contents, err := builtinFiles.ReadFile(file)
+		if err != nil {
+			return recipes, err
+		}
+
+		recipe, err := GetRecipeFromJson(contents)
+		if err != nil {
+			return recipes, fmt.Errorf("%s: %v", file, err)
+		}
+		recipe.Collection = BuiltinCollection
+
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes, nil
+}
+
+// MergeRecipes combines several lists of recipes.  A recipe overrides any
+// recipe of the same name from an earlier list.
+func MergeRecipes(lists ...[]Recipe) []Recipe {
+	var recipes []Recipe
+	positions := map[string]int{}
+
+	for _, list := range lists {
+		for _, recipe := range list {
+			if i, ok := positions[recipe.Name]; ok {
+				recipes[i] = recipe
+				continue
+			}
+
+			positions[recipe.Name] = len(recipes)
+			recipes = append(recipes, recipe)
+		}
+	}
+
+	return recipes
+}
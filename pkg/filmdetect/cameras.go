@@ -0,0 +1,276 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// cameraTable is the capability matrix of the Fujifilm cameras: the sensor
+// generation of every model, and the settings and film simulations it lacks
+// although its generation has them.
+//
+//go:embed cameras.json
+var cameraTable []byte
+
+// cameraEntry is a model in cameraTable.
+type cameraEntry struct {
+	Generation string   `json:"generation"`
+	Lacks      []string `json:"lacks"`
+}
+
+// cameraEntries are the models of cameraTable by name.
+var cameraEntries = func() map[string]cameraEntry {
+	entries := map[string]cameraEntry{}
+	if err := json.Unmarshal(cameraTable, &entries); err != nil {
+		panic(fmt.Sprintf("cameras.json: %v", err))
+	}
+	return entries
+}()
+
+// SensorGenerations maps Fujifilm camera models to the generation of their
+// sensor and processor, which decides the settings they offer.
+var SensorGenerations = func() map[string]string {
+	generations := map[string]string{}
+	for model, entry := range cameraEntries {
+		generations[model] = entry.Generation
+	}
+	return generations
+}()
+
+// Generations lists the sensor generations from oldest to newest.
+var Generations = []string{"X-Trans I", "X-Trans II", "X-Trans III", "X-Trans IV", "X-Trans V"}
+
+// FieldGenerations holds the sensor generation that introduced a setting.
+// Cameras of older generations don't have it, so a recipe is never
+// penalized for it on them.
+var FieldGenerations = map[string]string{
+	"ColorChromeEffect": "X-Trans IV",
+	"ColorChromeFXBlue": "X-Trans IV",
+	"SmoothSkinEffect":  "X-Trans IV",
+	"Clarity":           "X-Trans IV",
+	"DRangePriority":    "X-Trans IV",
+}
+
+// HasField reports whether a camera model offers a setting.  Unknown
+// cameras are assumed to offer everything.
+func HasField(model, field string) bool {
+	return Capabilities(model).HasField(field)
+}
+
+// CameraCapabilities are the settings and film simulations of a camera.
+type CameraCapabilities struct {
+	// The model, or the sensor generation when that was asked for
+	Camera string `json:"camera"`
+	// "" for unknown cameras, which are taken to have everything
+	Generation      string   `json:"generation"`
+	FilmSimulations []string `json:"film_simulations"`
+	// The Recipe fields of the settings
+	Fields []string `json:"fields"`
+}
+
+// HasField reports whether the camera has a setting.
+func (c CameraCapabilities) HasField(field string) bool {
+	return slices.Contains(c.Fields, field) || !slices.Contains(scoringFields(), field)
+}
+
+// scoringFields are the ScoringFields, which don't change, for the cameras
+// of every candidate.
+var scoringFields = sync.OnceValue(ScoringFields)
+
+// HasSimulation reports whether the camera has a film simulation.
+func (c CameraCapabilities) HasSimulation(simulation string) bool {
+	return slices.Contains(c.FilmSimulations, NormalizeValue("FilmSimulation", simulation))
+}
+
+// Capabilities returns the settings and film simulations of a camera model
+// as reported in EXIF, e.g. "X-T3", or of every camera of a sensor
+// generation, e.g. "X-Trans III" or "x-trans3".  The film simulations and
+// settings come with the generation of the camera, see
+// SimulationGenerations and FieldGenerations, less what the camera lacks.
+func Capabilities(camera string) CameraCapabilities {
+	c := CameraCapabilities{Camera: strings.TrimSpace(camera)}
+
+	var lacks []string
+	if generation := SensorGeneration(camera); generation != "" {
+		c.Generation = generation
+		for model, entry := range cameraEntries {
+			if strings.EqualFold(model, normalizeModel(camera)) {
+				lacks = entry.Lacks
+			}
+		}
+	} else if generation, err := ParseGeneration(camera); err == nil {
+		c.Camera = generation
+		c.Generation = generation
+	}
+	index := slices.Index(Generations, c.Generation)
+
+	for _, simulation := range EnumValues["FilmSimulation"] {
+		introduced, ok := SimulationGenerations[simulation]
+		older := index >= 0 && ok && index < slices.Index(Generations, introduced)
+		if !older && !slices.Contains(lacks, simulation) {
+			c.FilmSimulations = append(c.FilmSimulations, simulation)
+		}
+	}
+
+	for _, field := range scoringFields() {
+		introduced, ok := FieldGenerations[field]
+		older := index >= 0 && ok && index < slices.Index(Generations, introduced)
+		if !older && !slices.Contains(lacks, field) {
+			c.Fields = append(c.Fields, field)
+		}
+	}
+
+	return c
+}
+
+// SensorGeneration returns the sensor generation of a camera model as
+// reported in EXIF, or "" if it's unknown.
+func SensorGeneration(model string) string {
+	model = normalizeModel(model)
+
+	for m, generation := range SensorGenerations {
+		if strings.EqualFold(m, model) {
+			return generation
+		}
+	}
+
+	return ""
+}
+
+// normalizeModel strips the make from a camera model as reported in EXIF.
+func normalizeModel(model string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(model), "FUJIFILM"))
+}
+
+// Variant holds the settings of a recipe that differ on some cameras.  In a
+// recipe file it's an object with a list of cameras, and the differing fields
+// in the same form as in the recipe:
+//
+//	"variants": [{"cameras": ["X-Trans III"], "clarity": 0}]
+type Variant struct {
+	// Camera models, e.g. "X-T3", or sensor generations, e.g. "X-Trans IV"
+	Cameras  []string
+	Settings map[string]json.RawMessage
+}
+
+func (v *Variant) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &v.Settings); err != nil {
+		return err
+	}
+
+	cameras, ok := v.Settings["cameras"]
+	if !ok {
+		return fmt.Errorf("Recipe variant doesn't list its cameras")
+	}
+	delete(v.Settings, "cameras")
+
+	return json.Unmarshal(cameras, &v.Cameras)
+}
+
+func (v Variant) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{"cameras": v.Cameras}
+	for key, value := range v.Settings {
+		fields[key] = value
+	}
+
+	return json.Marshal(fields)
+}
+
+// Matches reports whether the variant applies to a camera model.
+func (v Variant) Matches(model string) bool {
+	model = strings.TrimSpace(model)
+	generation := SensorGeneration(model)
+
+	for _, camera := range v.Cameras {
+		if strings.EqualFold(camera, model) || (generation != "" && strings.EqualFold(camera, generation)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply returns r with the settings of the variant.
+func (v Variant) apply(r Recipe) (Recipe, error) {
+	settings, err := json.Marshal(v.Settings)
+	if err != nil {
+		return r, err
+	}
+
+	r.Variants = nil
+	r.Tags = append([]string(nil), r.Tags...)
+	if err := decodeStrict(settings, &r); err != nil {
+		return r, fmt.Errorf("Recipe variant for %s: %v", strings.Join(v.Cameras, ", "), err)
+	}
+
+	var set []string
+	for key := range v.Settings {
+		if field, err := RecipeFieldName(key); err == nil {
+			set = append(set, field)
+		}
+	}
+
+	return r.withSet(set...), nil
+}
+
+// ForCamera returns the recipe as it's set up on a camera model, using the
+// first of its variants that matches the model.  Settings the camera doesn't
+// have are left at their default, which is what it records for them.
+// Variants that can't be applied are ignored; recipe files are checked when
+// they are read.
+func (r Recipe) ForCamera(model string) Recipe {
+	for _, variant := range r.Variants {
+		if variant.Matches(model) {
+			recipe, err := variant.apply(r)
+			if err == nil {
+				r = recipe
+			}
+			break
+		}
+	}
+
+	return r.withoutMissingFields(model)
+}
+
+// withoutMissingFields resets the settings a camera model doesn't have to
+// their defaults.
+func (r Recipe) withoutMissingFields(model string) Recipe {
+	v := reflect.ValueOf(&r).Elem()
+	capabilities := Capabilities(model)
+
+	for _, field := range scoringFields() {
+		if capabilities.HasField(field) {
+			continue
+		}
+
+		f := v.FieldByName(field)
+		if values, ok := EnumValues[field]; ok {
+			f.SetString(values[0])
+		} else {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,145 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import "sort"
+
+// RecipeDistance is how far apart two recipes are: the weight of the
+// settings they differ in, as WeightedScorer counts it.  Settings either
+// recipe leaves out don't count.
+func RecipeDistance(a, b Recipe) float64 {
+	a, b = NormalizeRecipe(a), NormalizeRecipe(b)
+
+	distance := 0.0
+	for _, diff := range CompareRecipes(a, b) {
+		if !a.IsUnset(diff.Field) {
+			distance += FieldWeight(diff.Field)
+		}
+	}
+
+	return distance
+}
+
+// ClusterNode is a node of the tree made by ClusterRecipes.  A leaf holds a
+// single recipe, and any other node joins two subtrees.
+type ClusterNode struct {
+	Recipe *Recipe
+	Left   *ClusterNode
+	Right  *ClusterNode
+	// The average distance between the recipes of the two subtrees
+	Distance float64
+}
+
+// IsLeaf reports whether the node holds a recipe rather than subtrees.
+func (n *ClusterNode) IsLeaf() bool {
+	return n.Recipe != nil
+}
+
+// Recipes returns the recipes under the node, in the order of the tree.
+func (n *ClusterNode) Recipes() []Recipe {
+	if n.IsLeaf() {
+		return []Recipe{*n.Recipe}
+	}
+
+	return append(n.Left.Recipes(), n.Right.Recipes()...)
+}
+
+// Cut splits the tree into the largest subtrees that join at no more than
+// maxDistance.
+func (n *ClusterNode) Cut(maxDistance float64) []*ClusterNode {
+	if n.IsLeaf() || n.Distance <= maxDistance {
+		return []*ClusterNode{n}
+	}
+
+	return append(n.Left.Cut(maxDistance), n.Right.Cut(maxDistance)...)
+}
+
+// ClusterRecipes groups recipes by similarity, joining the two closest
+// groups until one is left, and returns the tree of joins.  Groups are as
+// far apart as the average distance between their recipes.  It returns nil
+// when there are no recipes.
+func ClusterRecipes(recipes []Recipe) *ClusterNode {
+	if len(recipes) == 0 {
+		return nil
+	}
+
+	nodes := make([]*ClusterNode, len(recipes))
+	sizes := make([]int, len(recipes))
+	distances := make([][]float64, len(recipes))
+	for i := range recipes {
+		nodes[i] = &ClusterNode{Recipe: &recipes[i]}
+		sizes[i] = 1
+		distances[i] = make([]float64, len(recipes))
+		for j := 0; j < i; j++ {
+			distances[i][j] = RecipeDistance(recipes[i], recipes[j])
+			distances[j][i] = distances[i][j]
+		}
+	}
+
+	// Joined groups live on in the slot of the first, the other is nil
+	for remaining := len(recipes); remaining > 1; remaining-- {
+		a, b := -1, -1
+		for i := range nodes {
+			if nodes[i] == nil {
+				continue
+			}
+			for j := i + 1; j < len(nodes); j++ {
+				if nodes[j] != nil && (a < 0 || distances[i][j] < distances[a][b]) {
+					a, b = i, j
+				}
+			}
+		}
+
+		nodes[a] = &ClusterNode{Left: nodes[a], Right: nodes[b], Distance: distances[a][b]}
+		nodes[b] = nil
+
+		for k := range nodes {
+			if nodes[k] == nil || k == a {
+				continue
+			}
+			average := (distances[a][k]*float64(sizes[a]) + distances[b][k]*float64(sizes[b])) / float64(sizes[a]+sizes[b])
+			distances[a][k] = average
+			distances[k][a] = average
+		}
+		sizes[a] += sizes[b]
+	}
+
+	for _, node := range nodes {
+		if node != nil {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// ClusterGroups cuts the tree of recipes at maxDistance and returns the
+// groups of similar recipes, the biggest first.  Recipes unlike any other
+// come last, each on its own.
+func ClusterGroups(recipes []Recipe, maxDistance float64) []*ClusterNode {
+	root := ClusterRecipes(recipes)
+	if root == nil {
+		return nil
+	}
+
+	groups := root.Cut(maxDistance)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Recipes()) > len(groups[j].Recipes())
+	})
+
+	return groups
+}
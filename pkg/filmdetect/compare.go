@@ -0,0 +1,113 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"reflect"
+)
+
+// recipeField reads a compared setting of a Recipe.
+type recipeField struct {
+	name string
+	get  func(r *Recipe) any
+}
+
+// recipeAccessors read the compared settings of a Recipe without reflection,
+// which took most of the time of detecting the images of a big library.  A
+// setting that isn't listed here is read with reflection instead.
+var recipeAccessors = map[string]func(r *Recipe) any{
+	"FilmSimulation":       func(r *Recipe) any { return r.FilmSimulation },
+	"GrainEffectSize":      func(r *Recipe) any { return r.GrainEffectSize },
+	"GrainEffectRoughness": func(r *Recipe) any { return r.GrainEffectRoughness },
+	"ColorChromeEffect":    func(r *Recipe) any { return r.ColorChromeEffect },
+	"ColorChromeFXBlue":    func(r *Recipe) any { return r.ColorChromeFXBlue },
+	"SmoothSkinEffect":     func(r *Recipe) any { return r.SmoothSkinEffect },
+	"WhiteBalanceMode":     func(r *Recipe) any { return r.WhiteBalanceMode },
+	"WhiteBalanceRed":      func(r *Recipe) any { return r.WhiteBalanceRed },
+	"WhiteBalanceBlue":     func(r *Recipe) any { return r.WhiteBalanceBlue },
+	"DynamicRange":         func(r *Recipe) any { return r.DynamicRange },
+	"DRangePriority":       func(r *Recipe) any { return r.DRangePriority },
+	"Highlights":           func(r *Recipe) any { return r.Highlights },
+	"Shadows":              func(r *Recipe) any { return r.Shadows },
+	"Color":                func(r *Recipe) any { return r.Color },
+	"Sharpness":            func(r *Recipe) any { return r.Sharpness },
+	"NoiseReduction":       func(r *Recipe) any { return r.NoiseReduction },
+	"Clarity":              func(r *Recipe) any { return r.Clarity },
+	"MonochromeFilter":     func(r *Recipe) any { return r.MonochromeFilter },
+	"ToningWarmCool":       func(r *Recipe) any { return r.ToningWarmCool },
+	"ToningMagentaGreen":   func(r *Recipe) any { return r.ToningMagentaGreen },
+}
+
+// recipeFields are the ScoringFields, in the same order.
+var recipeFields = newRecipeFields()
+
+func newRecipeFields() []recipeField {
+	var fields []recipeField
+	for _, name := range ScoringFields() {
+		get, ok := recipeAccessors[name]
+		if !ok {
+			get = reflectAccessor(name)
+		}
+		fields = append(fields, recipeField{name: name, get: get})
+	}
+
+	return fields
+}
+
+// reflectAccessor reads a setting of a Recipe with reflection.
+func reflectAccessor(name string) func(r *Recipe) any {
+	field, _ := reflect.TypeOf(Recipe{}).FieldByName(name)
+
+	return func(r *Recipe) any {
+		return reflect.ValueOf(r).Elem().FieldByIndex(field.Index).Interface()
+	}
+}
+
+// compareFujifilm compares the Recipe fields of two film simulation recipes.
+func compareFujifilm(input, candidate Recipe) []FieldDiff {
+	monochrome := IsMonochrome(input.FilmSimulation) || IsMonochrome(candidate.FilmSimulation)
+
+	result := make([]FieldDiff, 0, len(recipeFields))
+	for _, field := range recipeFields {
+		if !compared(field.name, input, candidate, monochrome) {
+			continue
+		}
+
+		vInputValue := field.get(&input)
+		vCandidateValue := field.get(&candidate)
+
+		result = append(result, FieldDiff{
+			Field:     field.name,
+			Input:     vInputValue,
+			Candidate: vCandidateValue,
+			Matched:   matches(field.name, vInputValue, vCandidateValue),
+		})
+	}
+
+	return result
+}
+
+// compared reports whether a setting is compared: the monochrome settings
+// only for black and white recipes, and nothing either recipe leaves out.
+// It's unset in the input when the image has a value that couldn't be read.
+func compared(field string, input, candidate Recipe, monochrome bool) bool {
+	if fieldComparisons[field].Monochrome && !monochrome {
+		return false
+	}
+
+	return !candidate.IsUnset(field) && !input.IsUnset(field)
+}
@@ -0,0 +1,135 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestRecipeFields(t *testing.T) {
+	var names []string
+	for _, field := range recipeFields {
+		names = append(names, field.name)
+	}
+
+	if !slices.Equal(names, ScoringFields()) {
+		t.Fatalf("recipeFields are %v, but the scoring fields of Recipe are %v", names, ScoringFields())
+	}
+
+	// An accessor of a setting that was renamed or removed would never be
+	// used
+	for name := range recipeAccessors {
+		if !slices.Contains(ScoringFields(), name) {
+			t.Errorf("recipeAccessors has %s, which isn't a scoring field", name)
+		}
+	}
+
+	// Every accessor reads its own field, and so does reflection for the
+	// settings without one
+	var r Recipe
+	v := reflect.ValueOf(&r).Elem()
+	for i, field := range recipeFields {
+		f := v.FieldByName(field.name)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(fmt.Sprintf("value %d", i))
+		case reflect.Int:
+			f.SetInt(int64(i + 1))
+		}
+	}
+	for _, field := range recipeFields {
+		want := v.FieldByName(field.name).Interface()
+		if got := field.get(&r); got != want {
+			t.Errorf("recipeFields reads %v for %s, expected %v", got, field.name, want)
+		}
+		if got := reflectAccessor(field.name)(&r); got != want {
+			t.Errorf("reflectAccessor reads %v for %s, expected %v", got, field.name, want)
+		}
+	}
+}
+
+// benchmarkRecipes returns n recipes, the built-in ones with their tones
+// varied, as a big library would have.
+func benchmarkRecipes(b *testing.B, n int) []Recipe {
+	builtin, err := BuiltinRecipes()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	recipes := make([]Recipe, 0, n)
+	for i := 0; i < n; i++ {
+		recipe := builtin[i%len(builtin)]
+		recipe.Name = fmt.Sprintf("%s %d", recipe.Name, i)
+		recipe.Highlights = i%5 - 2
+		recipe.Shadows = i%7 - 3
+		recipe.Color = i%9 - 4
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes
+}
+
+func BenchmarkDetectFromRecipes(b *testing.B) {
+	recipes := benchmarkRecipes(b, 1000)
+	image := recipes[len(recipes)/2]
+	image.Clarity = 5
+	opts := Options{Camera: "X-T4"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DetectFromRecipesWithOptions(recipes, image, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDetectFromRecipeSet(b *testing.B) {
+	recipes := benchmarkRecipes(b, 1000)
+	set := NewRecipeSet(recipes)
+	image := recipes[len(recipes)/2]
+	image.Clarity = 5
+	opts := Options{Camera: "X-T4"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DetectFromRecipeSetWithOptions(set, image, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDifference(b *testing.B) {
+	recipes := benchmarkRecipes(b, 2)
+	input, candidate := recipes[0], recipes[1]
+
+	b.Run("recipes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			DifferenceFromRecipes(input, candidate)
+		}
+	})
+
+	// As detection compares them, normalized once up front
+	b.Run("prepared", func(b *testing.B) {
+		input, candidate := NormalizeRecipe(input), prepareCandidate(candidate, "X-T4")
+		for i := 0; i < b.N; i++ {
+			difference(input, candidate, DefaultScorer)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Confidence rates how sure detection is that a candidate is the recipe that
+// was used.
+type Confidence int
+
+const (
+	// Confidence wasn't determined, e.g. for a Difference made directly
+	UnknownConfidence Confidence = iota
+	LowConfidence
+	MediumConfidence
+	HighConfidence
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case LowConfidence:
+		return "Low"
+	case MediumConfidence:
+		return "Medium"
+	case HighConfidence:
+		return "High"
+	}
+
+	return "Unknown"
+}
+
+func (c Confidence) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// RateConfidence rates the best candidate of a detection, given the
+// candidate that came second, if there was one.  A close match that a critical
+// setting separates from the rest is a high confidence match.  Critical
+// mismatches, too many mismatches or a tie with the runner-up give a low
+// confidence.
+func RateConfidence(best Difference, runnerUp *Difference) Confidence {
+	if len(best.CriticalFields()) > 0 || !best.IsGoodMatch() {
+		return LowConfidence
+	}
+
+	margin := math.Inf(1)
+	if runnerUp != nil {
+		margin = best.Score() - runnerUp.Score()
+	}
+
+	if margin <= 0 && !best.IsFullScore() {
+		return LowConfidence
+	}
+
+	if len(best.Mismatches()) <= 1 && margin >= CriticalWeight {
+		return HighConfidence
+	}
+
+	return MediumConfidence
+}
@@ -0,0 +1,144 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import "sort"
+
+// ConsensusCandidate is how a recipe fared across the images of a shoot.
+type ConsensusCandidate struct {
+	Recipe Recipe `json:"recipe"`
+	// How many images had it as their best good match.  Images with several
+	// best candidates give each of them a vote.
+	Votes        int     `json:"votes"`
+	AverageScore float64 `json:"average_score"`
+}
+
+// ConsensusResult is the recipe a set of images most likely share.
+type ConsensusResult struct {
+	// How many images were compared; ones detection failed for don't count
+	Images     int                  `json:"images"`
+	Candidates []ConsensusCandidate `json:"candidates"`
+	Confidence Confidence           `json:"confidence"`
+}
+
+// Best returns the recipe the images most likely share, if any recipe was a
+// good match for one of them.
+func (r ConsensusResult) Best() (ConsensusCandidate, bool) {
+	if len(r.Candidates) == 0 || r.Candidates[0].Votes == 0 {
+		return ConsensusCandidate{}, false
+	}
+
+	return r.Candidates[0], true
+}
+
+// Consensus assumes that the images of records were all shot with the same
+// recipe, and finds it: the recipe that was the best match for the most
+// images, and on a tie, the one with the higher average score.  Averaging
+// over the images makes up for the few an exposure or a lens correction
+// threw off.
+func Consensus(recipes []Recipe, records []DetectionRecord) ConsensusResult {
+	return ConsensusWithOptions(recipes, records, Options{})
+}
+
+// ConsensusWithOptions is Consensus with options.  The camera of every
+// record is the one its image was taken with, unless opts name one.
+func ConsensusWithOptions(recipes []Recipe, records []DetectionRecord, opts Options) ConsensusResult {
+	result := ConsensusResult{}
+	totals := map[string]*ConsensusCandidate{}
+	scores := map[string]float64{}
+
+	prepared := newPreparedRecipes(recipes)
+	for _, record := range records {
+		if record.Err != nil {
+			continue
+		}
+		result.Images++
+
+		recordOpts := opts
+		if recordOpts.Camera == "" {
+			recordOpts.Camera = record.Extraction.Model
+		}
+		ranked := rankRecipes(prepared.forCamera(recordOpts.Camera), record.Extraction.Recipe, recordOpts, true)
+		for _, diff := range ranked {
+			name := diff.Candidate.FullName()
+
+			total, ok := totals[name]
+			if !ok {
+				// The recipe as written, not as set up for this camera
+				for _, recipe := range recipes {
+					if recipe.FullName() == name {
+						total = &ConsensusCandidate{Recipe: recipe}
+						break
+					}
+				}
+				totals[name] = total
+			}
+
+			scores[name] += diff.Score()
+			if diff.Score() == ranked[0].Score() && diff.IsGoodMatch() {
+				total.Votes++
+			}
+		}
+	}
+
+	for name, total := range totals {
+		total.AverageScore = scores[name] / float64(result.Images)
+		result.Candidates = append(result.Candidates, *total)
+	}
+
+	sort.SliceStable(result.Candidates, func(i, j int) bool {
+		a, b := result.Candidates[i], result.Candidates[j]
+		if a.Votes != b.Votes {
+			return a.Votes > b.Votes
+		}
+		if a.AverageScore != b.AverageScore {
+			return a.AverageScore > b.AverageScore
+		}
+		return a.Recipe.FullName() < b.Recipe.FullName()
+	})
+
+	result.Confidence = rateConsensus(result)
+
+	return result
+}
+
+// rateConsensus gives a high confidence when most images agree on a recipe
+// and it's clearly ahead of the runner-up on average, and a low one when no
+// recipe got the votes of at least half of the images.
+func rateConsensus(result ConsensusResult) Confidence {
+	best, ok := result.Best()
+	if !ok {
+		return LowConfidence
+	}
+
+	if best.Votes*2 < result.Images {
+		return LowConfidence
+	}
+
+	if len(result.Candidates) > 1 {
+		runnerUp := result.Candidates[1]
+		if runnerUp.Votes == best.Votes || best.AverageScore-runnerUp.AverageScore < CriticalWeight {
+			return MediumConfidence
+		}
+	}
+
+	if best.Votes*2 > result.Images {
+		return HighConfidence
+	}
+
+	return MediumConfidence
+}
@@ -0,0 +1,139 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SimulationFallbacks are the closest film simulation that came before each
+// one in SimulationGenerations.  ConvertRecipe follows them until it reaches
+// a simulation the camera has.
+var SimulationFallbacks = map[string]string{
+	"Nostalgic Neg":    "Classic Negative",
+	"Reala ACE":        "Provia",
+	"Classic Negative": "Classic Chrome",
+	"Bleach Bypass":    "Eterna",
+	"Eterna":           "Pro Neg. Std",
+	"Classic Chrome":   "Pro Neg. Std",
+	"Acros":            "None (B&W)",
+}
+
+// ParseGeneration returns the sensor generation a camera model or generation
+// names, e.g. "X-T2", "X-Trans III" or "x-trans3".
+func ParseGeneration(s string) (string, error) {
+	key := generationKey(s)
+	for i, generation := range Generations {
+		if key == generationKey(generation) || key == fmt.Sprintf("xtrans%d", i+1) {
+			return generation, nil
+		}
+	}
+
+	if generation := SensorGeneration(s); generation != "" {
+		return generation, nil
+	}
+
+	return "", fmt.Errorf("Unknown camera or sensor generation '%s', expected e.g. X-T2 or X-Trans III", s)
+}
+
+func generationKey(s string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(s))
+}
+
+// ConversionChange is a setting ConvertRecipe changed.
+type ConversionChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+	// Whether the camera has nothing like the setting, rather than a close
+	// substitute
+	Lost bool `json:"lost"`
+}
+
+func (c ConversionChange) String() string {
+	if c.Lost {
+		return fmt.Sprintf("%s %s is lost", FieldLabel(c.Field), FormatValue(c.Field, c.From))
+	}
+
+	return fmt.Sprintf("%s %s becomes %s", FieldLabel(c.Field), FormatValue(c.Field, c.From), FormatValue(c.Field, c.To))
+}
+
+// ConvertRecipe returns the nearest equivalent of a recipe on a camera model,
+// or the cameras of a sensor generation, see Capabilities, and what had to
+// change.  A variant of the recipe for the camera is used if it has one.
+// Film simulations the camera doesn't have are replaced following
+// SimulationFallbacks, and settings it doesn't have are reset to the default
+// it records.
+func ConvertRecipe(r Recipe, camera string) (Recipe, []ConversionChange, error) {
+	if r.DialectName() != FujifilmDialect {
+		return r, nil, fmt.Errorf("Only Fujifilm recipes can be converted, '%s' is a %s recipe", r.Name, r.DialectName())
+	}
+
+	capabilities := Capabilities(camera)
+	if capabilities.Generation == "" {
+		return r, nil, fmt.Errorf("Unknown camera or sensor generation '%s', expected e.g. X-T2 or X-Trans III", camera)
+	}
+
+	for _, variant := range r.Variants {
+		if variant.Matches(capabilities.Camera) {
+			applied, err := variant.apply(r)
+			if err != nil {
+				return r, nil, err
+			}
+			r = applied
+			break
+		}
+	}
+	r.Variants = nil
+
+	changes := []ConversionChange{}
+
+	simulation := NormalizeValue("FilmSimulation", r.FilmSimulation)
+	for !capabilities.HasSimulation(simulation) && SimulationFallbacks[simulation] != "" {
+		simulation = SimulationFallbacks[simulation]
+	}
+	if simulation != NormalizeValue("FilmSimulation", r.FilmSimulation) {
+		changes = append(changes, ConversionChange{Field: "FilmSimulation", From: r.FilmSimulation, To: simulation})
+		r.FilmSimulation = simulation
+	}
+
+	v := reflect.ValueOf(&r).Elem()
+	for _, field := range ScoringFields() {
+		if capabilities.HasField(field) || r.IsUnset(field) {
+			continue
+		}
+
+		f := v.FieldByName(field)
+		from := f.Interface()
+		if values, ok := EnumValues[field]; ok {
+			if NormalizeValue(field, f.String()) == values[0] {
+				continue
+			}
+			f.SetString(values[0])
+		} else {
+			if f.IsZero() {
+				continue
+			}
+			f.Set(reflect.Zero(f.Type()))
+		}
+		changes = append(changes, ConversionChange{Field: field, From: from, To: f.Interface(), Lost: true})
+	}
+
+	return r, changes, nil
+}
@@ -0,0 +1,188 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CaptureOneStyleExtension is the extension of Capture One style files.
+const CaptureOneStyleExtension = ".costyle"
+
+// CaptureOneStyles is a Fetcher reading the Capture One styles in Dir and
+// its subdirectories as recipe stubs, see ParseCaptureOneStyle.
+type CaptureOneStyles struct {
+	Dir string
+}
+
+func (s CaptureOneStyles) Fetch(ctx context.Context) ([]Recipe, error) {
+	var files []string
+	err := filepath.WalkDir(s.Dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && HasExtension(path, CaptureOneStyleExtension) {
+			files = append(files, path)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var recipes []Recipe
+	for _, file := range files {
+		recipe, err := ParseCaptureOneStyle(file)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes, nil
+}
+
+// ParseCaptureOneStyle turns a Capture One style into a recipe stub.  Its
+// adjustments don't translate to camera settings, so the stub only has a
+// film simulation, found in the name of the ICC profile the style uses or
+// else in the name of the style, and leaves out every other setting.  It's
+// tagged "capture-one".
+func ParseCaptureOneStyle(filename string) (Recipe, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Recipe{}, err
+	}
+	defer f.Close()
+
+	entries, err := captureOneEntries(f)
+	if err != nil {
+		return Recipe{}, fmt.Errorf("Reading %s failed: %v", filename, err)
+	}
+
+	name := entries["Name"]
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	recipe := Recipe{
+		Name:  name,
+		Notes: fmt.Sprintf("Imported from the Capture One style %s", filepath.Base(filename)),
+		Tags:  []string{"capture-one"},
+	}
+
+	profile := entries["ICCProfile"]
+	if profile != "" {
+		recipe.Notes += fmt.Sprintf(", which uses the ICC profile %s", profile)
+	}
+
+	simulation := filmSimulationIn(profile)
+	if simulation == "" {
+		simulation = filmSimulationIn(name)
+	}
+	recipe.FilmSimulation, recipe.MonochromeFilter = SplitMonochromeFilter(simulation)
+
+	for _, field := range ScoringFields() {
+		if field == "FilmSimulation" && recipe.FilmSimulation != "" {
+			continue
+		}
+		if field == "MonochromeFilter" && recipe.MonochromeFilter != "" {
+			continue
+		}
+		recipe.Unset = append(recipe.Unset, field)
+	}
+
+	return recipe, nil
+}
+
+// captureOneEntries returns the <E K="..." V="..."/> entries of a Capture One
+// style by key.
+func captureOneEntries(r io.Reader) (map[string]string, error) {
+	entries := map[string]string{}
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "E" {
+			continue
+		}
+
+		var key, value string
+		for _, attr := range element.Attr {
+			switch attr.Name.Local {
+			case "K":
+				key = attr.Value
+			case "V":
+				value = attr.Value
+			}
+		}
+		if key != "" {
+			entries[key] = value
+		}
+	}
+}
+
+// The shortest alias filmSimulationIn looks for, since short ones such as
+// "cc" turn up inside unrelated words
+const minFilmSimulationAlias = 5
+
+// filmSimulationIn returns the film simulation named anywhere in text, e.g.
+// "Classic Chrome" in "FujiXT4-ClassicChrome", or "" if none is.  The longest
+// name found wins, so that "Classic Negative" isn't taken for something
+// shorter it contains.
+func filmSimulationIn(text string) string {
+	simple := simplifyName(text)
+
+	names := map[string]string{}
+	for _, known := range EnumValues["FilmSimulation"] {
+		names[simplifyName(known)] = known
+	}
+	for known := range MonochromeFilterSimulations {
+		names[simplifyName(known)] = known
+	}
+	for alias, canonical := range FilmSimulationAliases {
+		if len(alias) >= minFilmSimulationAlias {
+			names[alias] = canonical
+		}
+	}
+
+	found, longest := "", 0
+	for name, canonical := range names {
+		if !strings.Contains(simple, name) {
+			continue
+		}
+		if len(name) > longest || (len(name) == longest && canonical < found) {
+			found, longest = canonical, len(name)
+		}
+	}
+
+	return found
+}
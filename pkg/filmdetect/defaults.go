@@ -0,0 +1,191 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// DefaultsFile holds the settings that recipes of a simulation directory or
+// collection get when they leave them out.  It has the format of a recipe
+// file, but isn't a recipe itself.
+const DefaultsFile = "defaults.json"
+
+// IsUnset reports whether the recipe file left out a setting, which is then
+// not compared when matching, rather than taken as zero.
+func (r Recipe) IsUnset(field string) bool {
+	return slices.Contains(r.Unset, field)
+}
+
+// unsetFields returns the settings that the keys of a recipe file don't set.
+// The film simulation is always compared, so it's never unset.
+func unsetFields(keys map[string]json.RawMessage) []string {
+	var unset []string
+
+	t := reflect.TypeOf(Recipe{})
+	for _, field := range ScoringFields() {
+		if field == "FilmSimulation" {
+			continue
+		}
+
+		f, _ := t.FieldByName(field)
+		if !hasKey(keys, strings.Split(f.Tag.Get("json"), ",")[0]) {
+			unset = append(unset, field)
+		}
+	}
+
+	return unset
+}
+
+// hasKey reports whether a recipe file sets key.  Keys match regardless of
+// case, like json.Unmarshal matches them to the fields of Recipe, so that
+// e.g. the "Sharpness" of files written before the keys were lowercase
+// counts.
+func hasKey(keys map[string]json.RawMessage, key string) bool {
+	if _, ok := keys[key]; ok {
+		return true
+	}
+
+	for k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withSet returns r with fields no longer unset.
+func (r Recipe) withSet(fields ...string) Recipe {
+	var unset []string
+	for _, field := range r.Unset {
+		if !slices.Contains(fields, field) {
+			unset = append(unset, field)
+		}
+	}
+	r.Unset = unset
+
+	return r
+}
+
+// WithDefaults returns r with the settings it leaves out taken from
+// defaults.  Settings that defaults leaves out too stay unset.
+func (r Recipe) WithDefaults(defaults Recipe) Recipe {
+	v := reflect.ValueOf(&r).Elem()
+	d := reflect.ValueOf(defaults)
+
+	var set []string
+	for _, field := range r.Unset {
+		if !defaults.IsUnset(field) {
+			v.FieldByName(field).Set(d.FieldByName(field))
+			set = append(set, field)
+		}
+	}
+
+	return r.withSet(set...)
+}
+
+// MarshalJSON leaves out the settings that are unset, so that writing a
+// recipe and reading it back doesn't turn them into zeros.
+func (r Recipe) MarshalJSON() ([]byte, error) {
+	type plain Recipe
+	b, err := json.Marshal(plain(r))
+	if err != nil || len(r.Unset) == 0 {
+		return b, err
+	}
+
+	omit := map[string]bool{}
+	t := reflect.TypeOf(r)
+	for _, field := range r.Unset {
+		if f, ok := t.FieldByName(field); ok {
+			omit[strings.Split(f.Tag.Get("json"), ",")[0]] = true
+		}
+	}
+
+	return omitKeys(b, omit)
+}
+
+// omitKeys removes keys from a JSON object, keeping the order of the rest.
+func omitKeys(b []byte, omit map[string]bool) ([]byte, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(b)))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	out := []byte{'{'}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		if omit[key.(string)] {
+			continue
+		}
+
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		name, _ := json.Marshal(key)
+		out = append(out, name...)
+		out = append(out, ':')
+		out = append(out, value...)
+	}
+
+	return append(out, '}'), nil
+}
+
+// readDefaults reads the defaults of every directory from simulationDir down
+// to dir, the nearest one first.  Directories without a DefaultsFile are
+// skipped.
+func readDefaults(simulationDir, dir string, cache map[string]*Recipe) ([]Recipe, error) {
+	var chain []Recipe
+
+	for {
+		defaults, ok := cache[dir]
+		if !ok {
+			filename := filepath.Join(dir, DefaultsFile)
+			if _, err := os.Stat(filename); err == nil {
+				recipe, err := ParseRecipeFile(filename)
+				if err != nil {
+					return nil, err
+				}
+				defaults = &recipe
+			}
+			cache[dir] = defaults
+		}
+		if defaults != nil {
+			chain = append(chain, *defaults)
+		}
+
+		rel, err := filepath.Rel(simulationDir, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return chain, err
+		}
+		dir = filepath.Dir(dir)
+	}
+}
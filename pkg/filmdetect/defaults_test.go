@@ -0,0 +1,92 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A recipe file as filmdetect wrote them before its keys were all lowercase,
+// with the untagged fields under their Go names
+const baselineRecipe = `{
+  "name": "Kodachrome 64",
+  "Author": "Fuji X Weekly",
+  "Url": "https://fujixweekly.com/",
+  "film_simulation": "Classic Chrome",
+  "grain_effect_size": "Small",
+  "grain_effect_roughness": "Weak",
+  "color_chrome_effect": "Strong",
+  "color_chrome_fx_blue": "Off",
+  "white_balance_mode": "Daylight",
+  "white_balance_r": 2,
+  "white_balance_b": -5,
+  "dynamic_range": "DR200",
+  "tone_curve_highlights": 0,
+  "tone_curve_shadows": 0,
+  "Color": 2,
+  "Sharpness": 1,
+  "noise_reduction": -4,
+  "Clarity": 3
+}`
+
+func TestBaselineRecipeFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kodachrome-64.json")
+	if err := os.WriteFile(filename, []byte(baselineRecipe), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recipe, err := ParseRecipeFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recipe.Author != "Fuji X Weekly" || recipe.Url != "https://fujixweekly.com/" {
+		t.Errorf("Author and Url = %q, %q", recipe.Author, recipe.Url)
+	}
+	if recipe.Color != 2 || recipe.Sharpness != 1 || recipe.Clarity != 3 {
+		t.Errorf("Color, Sharpness and Clarity = %d, %d, %d, expected 2, 1, 3", recipe.Color, recipe.Sharpness, recipe.Clarity)
+	}
+	for _, field := range []string{"Color", "Sharpness", "Clarity", "WhiteBalanceRed", "WhiteBalanceBlue"} {
+		if recipe.IsUnset(field) {
+			t.Errorf("%s is unset", field)
+		}
+	}
+
+	// Only unset settings are left out of the comparison
+	image := recipe
+	image.Sharpness = -2
+	if diffs := CompareRecipes(recipe, image); len(diffs) != 1 || diffs[0].Field != "Sharpness" {
+		t.Errorf("Comparing with a different sharpness gave %v", diffs)
+	}
+
+	b, err := json.Marshal(recipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written map[string]any
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"color", "sharpness", "clarity"} {
+		if _, ok := written[key]; !ok {
+			t.Errorf("%s is left out when writing the recipe: %s", key, b)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// The oldest exiftool that knows all the Fujifilm tags filmdetect reads
+const MinExiftoolVersion = 12.48
+
+var ErrExiftoolMissing = errors.New("exiftool is not installed, or not in your PATH.  " +
+	"Install it from https://exiftool.org/ or with your package manager, " +
+	"e.g. `apt install libimage-exiftool-perl` or `brew install exiftool`.")
+
+// ExiftoolVersion runs exiftool to find out its version.
+func ExiftoolVersion() (float64, error) {
+	path, err := exec.LookPath("exiftool")
+	if err != nil {
+		return 0, ErrExiftoolMissing
+	}
+
+	out, err := exec.Command(path, "-ver").Output()
+	if err != nil {
+		return 0, fmt.Errorf("Running %s failed: %v", path, err)
+	}
+
+	version, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Unexpected exiftool version: '%s'", strings.TrimSpace(string(out)))
+	}
+
+	return version, nil
+}
+
+// CheckDependencies makes sure the tools filmdetect relies on are available,
+// and returns an error explaining what to do if they aren't.
+func CheckDependencies() error {
+	version, err := ExiftoolVersion()
+	if err != nil {
+		return err
+	}
+
+	if version < MinExiftoolVersion {
+		return fmt.Errorf("exiftool %.2f is too old, filmdetect needs %.2f or newer.  "+
+			"Older versions don't know about all of the Fujifilm settings.", version, MinExiftoolVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"sync"
+)
+
+// DetectorOptions configure a Detector.
+type DetectorOptions struct {
+	// How images are compared to the recipes
+	Options
+	// The directories recipes are read from, see GetRecipesFromDirs
+	SimulationDirs []string
+	// Loads the recipes instead of reading SimulationDirs, if set
+	Load func() ([]Recipe, error)
+}
+
+func (o DetectorOptions) load() ([]Recipe, error) {
+	if o.Load != nil {
+		return o.Load()
+	}
+
+	return GetRecipesFromDirs(o.SimulationDirs)
+}
+
+// Detector keeps recipes loaded and an exiftool process running, for
+// detecting the recipes of many images.  It's safe for concurrent use, and
+// the recipes can be reloaded while it's in use.
+type Detector struct {
+	opts      DetectorOptions
+	extractor *Extractor
+
+	mu      sync.RWMutex
+	recipes *RecipeSet
+}
+
+// NewDetector loads the recipes and starts exiftool.  The Detector must be
+// closed when it's no longer needed.
+func NewDetector(opts DetectorOptions) (*Detector, error) {
+	d := &Detector{opts: opts}
+
+	if err := d.ReloadRecipes(); err != nil {
+		return nil, err
+	}
+
+	extractor, err := NewExtractor()
+	if err != nil {
+		return nil, err
+	}
+	extractor.Force = opts.Force
+	extractor.Lenient = opts.Lenient
+	d.extractor = extractor
+
+	return d, nil
+}
+
+func (d *Detector) Close() error {
+	return d.extractor.Close()
+}
+
+// ReloadRecipes loads the recipes again.  Detections that are under way
+// finish with the old recipes.  If loading fails, the old recipes are kept.
+func (d *Detector) ReloadRecipes() error {
+	recipes, err := d.opts.load()
+	if err != nil {
+		return err
+	}
+
+	set := NewRecipeSet(recipes)
+
+	d.mu.Lock()
+	d.recipes = set
+	d.mu.Unlock()
+
+	return nil
+}
+
+// Recipes returns the current recipes.  The set is shared, and mustn't be
+// modified.
+func (d *Detector) Recipes() *RecipeSet {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.recipes
+}
+
+// Extract reads the camera settings of an image.
+func (d *Detector) Extract(filename string) (ExtractionResult, error) {
+	return d.extractor.Extract(filename)
+}
+
+// Detect finds the recipes closest to the settings of an image, like
+// DetectFromRecipes.
+func (d *Detector) Detect(filename string) ([]Difference, bool, error) {
+	extraction, err := d.Extract(filename)
+	if err != nil {
+		return []Difference{}, false, err
+	}
+
+	return d.DetectExtraction(extraction)
+}
+
+// DetectExtraction finds the recipes closest to settings that were already
+// extracted.  The camera model of the extraction picks the recipe variants.
+func (d *Detector) DetectExtraction(extraction ExtractionResult) ([]Difference, bool, error) {
+	opts := d.opts.Options
+	if opts.Camera == "" {
+		opts.Camera = extraction.Model
+	}
+
+	return DetectFromRecipeSetWithOptions(d.Recipes(), extraction.Recipe, opts)
+}
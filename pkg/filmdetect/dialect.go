@@ -0,0 +1,438 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect is the picture settings of a family of cameras: which settings
+// there are, how they're read from the metadata of an image, and how the
+// settings of two recipes are compared.  Fujifilm film simulation recipes
+// are the Recipe fields; recipes of other dialects keep their settings in
+// Recipe.Settings.
+type Dialect interface {
+	Name() string
+	// Matches reports whether images of the camera are read with the
+	// dialect.
+	Matches(make, model string) bool
+	// The settings of the dialect, the one telling looks apart first
+	Fields() []DialectField
+	// Extract reads a recipe from metadata as MetadataBackend returns it.
+	Extract(tags map[string]any) (Recipe, error)
+	// Compare returns every setting of candidate compared with input, like
+	// CompareAllFields.
+	Compare(input, candidate Recipe) []FieldDiff
+}
+
+// DialectField is a setting of a Dialect.
+type DialectField struct {
+	// Name in FieldDiff, and for FieldLabel and FieldWeight
+	Name string
+	// Key in the settings of a recipe file
+	Key string
+	// The exiftool tag the setting is read from
+	Tag string
+	// As the camera menus show it
+	Label string
+	// See FieldWeight; 1 if not given
+	Weight float64
+	// Whether the setting is a number, e.g. an adjustment from -4 to +4
+	Numeric bool
+	// The values cameras record, for lint.  Any value is fine if empty.
+	Values []string
+	// The lowest and highest values of a numeric setting, for lint
+	Range [2]int
+}
+
+// The name of the dialect of Fujifilm film simulation recipes, which recipes
+// without a dialect are.
+const FujifilmDialect = "fujifilm"
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{}
+	// The settings of the dialects by name, of the dialect registered first
+	// if several share one
+	dialectFields = map[string]DialectField{}
+)
+
+// RegisterDialect makes a dialect available for recipe files to name, and
+// for reading the images of the cameras it matches.  FieldLabel and
+// FieldWeight fall back to the labels and weights of its settings, for the
+// ones FieldLabels and FieldWeights don't list.
+func RegisterDialect(d Dialect) {
+	// Before locking, since the Fujifilm dialect reads FieldWeight
+	fields := d.Fields()
+
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+
+	if _, ok := dialects[d.Name()]; ok {
+		panic("filmdetect: dialect registered twice: " + d.Name())
+	}
+
+	for _, field := range fields {
+		if _, ok := dialectFields[field.Name]; !ok {
+			dialectFields[field.Name] = field
+		}
+	}
+
+	dialects[d.Name()] = d
+}
+
+// dialectField returns the setting of a registered dialect named name.
+func dialectField(name string) (DialectField, bool) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	field, ok := dialectFields[name]
+	return field, ok
+}
+
+// Dialects returns the names of the registered dialects.
+func Dialects() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	var names []string
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// DialectByName returns the dialect registered under name.  The empty name
+// is FujifilmDialect.
+func DialectByName(name string) (Dialect, bool) {
+	if name == "" {
+		name = FujifilmDialect
+	}
+
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// DialectFor returns the dialect images of a camera are read with.  Cameras
+// no other dialect matches are read as Fujifilm cameras.
+func DialectFor(make, model string) Dialect {
+	for _, name := range Dialects() {
+		if name == FujifilmDialect {
+			continue
+		}
+
+		if d, _ := DialectByName(name); d.Matches(make, model) {
+			return d
+		}
+	}
+
+	d, _ := DialectByName(FujifilmDialect)
+	return d
+}
+
+// SupportedCamera reports whether a dialect reads the images of a camera,
+// Fujifilm cameras included.
+func SupportedCamera(make, model string) bool {
+	for _, name := range Dialects() {
+		if d, _ := DialectByName(name); d.Matches(make, model) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DialectName is the dialect of the recipe, FujifilmDialect if it doesn't
+// name one.
+func (r Recipe) DialectName() string {
+	if r.Dialect == "" {
+		return FujifilmDialect
+	}
+
+	return r.Dialect
+}
+
+func (r Recipe) dialect() Dialect {
+	if d, ok := DialectByName(r.Dialect); ok {
+		return d
+	}
+
+	d, _ := DialectByName(FujifilmDialect)
+	return d
+}
+
+// look is the value of the setting telling looks apart: the film simulation
+// of a Fujifilm recipe, or e.g. the image control of a Ricoh one.
+func (r Recipe) look() string {
+	if r.DialectName() == FujifilmDialect {
+		return r.FilmSimulation
+	}
+
+	fields := r.dialect().Fields()
+	if len(fields) == 0 || r.Settings[fields[0].Key] == nil {
+		return ""
+	}
+
+	return FormatValue(fields[0].Name, r.Settings[fields[0].Key])
+}
+
+// checkDialect checks that a recipe file names a registered dialect, and
+// that its settings are ones of the dialect.  Settings are normalized, and
+// none of the Fujifilm settings count as set in recipes of other dialects.
+func checkDialect(r *Recipe) error {
+	d, ok := DialectByName(r.Dialect)
+	if !ok {
+		return fmt.Errorf("Unknown dialect '%s', expected one of %s", r.Dialect, strings.Join(Dialects(), ", "))
+	}
+
+	if d.Name() == FujifilmDialect {
+		if len(r.Settings) > 0 {
+			return fmt.Errorf("Only recipes of other dialects than %s have settings", FujifilmDialect)
+		}
+		return nil
+	}
+
+	for key, value := range r.Settings {
+		i := slices.IndexFunc(d.Fields(), func(f DialectField) bool { return f.Key == key })
+		if i < 0 {
+			return fmt.Errorf("Unknown %s setting '%s'", d.Name(), key)
+		}
+		r.Settings[key] = d.Fields()[i].normalize(value)
+	}
+	r.Unset = ScoringFields()
+
+	return nil
+}
+
+// normalize turns a value as exiftool formats it, or as a recipe file has
+// it, into an int for numeric settings, and a string for the rest.
+func (f DialectField) normalize(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if f.Numeric {
+			return int(v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		if f.Numeric {
+			return v
+		}
+		return strconv.Itoa(v)
+	case string:
+		v = strings.TrimSpace(v)
+		if f.Numeric {
+			if strings.EqualFold(v, "Normal") {
+				return 0
+			}
+			if i, err := strconv.Atoi(strings.TrimPrefix(v, "+")); err == nil {
+				return i
+			}
+		}
+		return v
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// SettingsDialect is a Dialect whose settings are read from exiftool tags as
+// they are, and match when they are equal, ignoring case.  Recipes keep
+// them in Recipe.Settings.
+type SettingsDialect struct {
+	DialectName string
+	// A camera matches if its make contains Make, and its model contains
+	// one of Models, ignoring case
+	Make   string
+	Models []string
+	// The settings, the one telling looks apart first
+	Settings []DialectField
+}
+
+func (d SettingsDialect) Name() string {
+	return d.DialectName
+}
+
+func (d SettingsDialect) Matches(make, model string) bool {
+	if !strings.Contains(strings.ToUpper(make), strings.ToUpper(d.Make)) {
+		return false
+	}
+
+	for _, m := range d.Models {
+		if strings.Contains(strings.ToUpper(model), strings.ToUpper(m)) {
+			return true
+		}
+	}
+
+	return len(d.Models) == 0
+}
+
+func (d SettingsDialect) Fields() []DialectField {
+	return d.Settings
+}
+
+func (d SettingsDialect) Extract(tags map[string]any) (Recipe, error) {
+	recipe := Recipe{Dialect: d.DialectName, Settings: map[string]any{}, Unset: ScoringFields()}
+
+	for _, field := range d.Settings {
+		if value, ok := tags[field.Tag]; ok {
+			recipe.Settings[field.Key] = field.normalize(value)
+		}
+	}
+
+	return recipe, nil
+}
+
+// Compare compares the settings the candidate has.  Settings the input
+// doesn't have compare as empty.
+func (d SettingsDialect) Compare(input, candidate Recipe) []FieldDiff {
+	result := []FieldDiff{}
+
+	for _, field := range d.Settings {
+		candidateValue, ok := candidate.Settings[field.Key]
+		if !ok {
+			continue
+		}
+		inputValue := input.Settings[field.Key]
+
+		result = append(result, FieldDiff{
+			Field:     field.Name,
+			Input:     inputValue,
+			Candidate: candidateValue,
+			Matched:   strings.EqualFold(fmt.Sprintf("%v", inputValue), fmt.Sprintf("%v", candidateValue)),
+		})
+	}
+
+	return result
+}
+
+// lint checks the settings of a recipe against Values and Range.
+func (d SettingsDialect) lint(r Recipe, variant string) []LintIssue {
+	var issues []LintIssue
+
+	for _, field := range d.Settings {
+		value, ok := r.Settings[field.Key]
+		if !ok {
+			continue
+		}
+
+		if i, isInt := value.(int); isInt && field.Range != [2]int{} {
+			if i < field.Range[0] || i > field.Range[1] {
+				issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: field.Name, Value: strconv.Itoa(i),
+					Message: fmt.Sprintf("%d is outside of %d..%d", i, field.Range[0], field.Range[1])})
+			}
+			continue
+		}
+
+		text := fmt.Sprintf("%v", value)
+		if len(field.Values) > 0 && !slices.ContainsFunc(field.Values, func(v string) bool { return strings.EqualFold(v, text) }) {
+			issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: field.Name, Value: text,
+				Message: fmt.Sprintf("'%s' isn't a value any camera records, expected one of %s", text, strings.Join(field.Values, ", "))})
+		}
+	}
+
+	return issues
+}
+
+// fujifilmDialect is the Recipe fields, read from the tags of Fujifilm's
+// maker notes.
+type fujifilmDialect struct{}
+
+func (fujifilmDialect) Name() string {
+	return FujifilmDialect
+}
+
+func (fujifilmDialect) Matches(make, model string) bool {
+	return strings.Contains(strings.ToUpper(make), "FUJIFILM")
+}
+
+// fujifilmFields are the Fields of fujifilmDialect that come from the Recipe
+// type, which scoring asks for every candidate.
+var fujifilmFields = sync.OnceValue(func() []DialectField {
+	var fields []DialectField
+
+	t := reflect.TypeOf(Recipe{})
+	for _, name := range ScoringFields() {
+		f, _ := t.FieldByName(name)
+		fields = append(fields, DialectField{
+			Name:    name,
+			Key:     strings.Split(f.Tag.Get("json"), ",")[0],
+			Numeric: f.Type.Kind() == reflect.Int,
+		})
+	}
+
+	return fields
+})
+
+func (fujifilmDialect) Fields() []DialectField {
+	fields := slices.Clone(fujifilmFields())
+
+	for i, field := range fields {
+		fields[i].Label = FieldLabel(field.Name)
+		fields[i].Weight = FieldWeight(field.Name)
+		fields[i].Values = EnumValues[field.Name]
+		fields[i].Range = IntRanges[field.Name]
+	}
+
+	return fields
+}
+
+func (fujifilmDialect) Extract(tags map[string]any) (Recipe, error) {
+	return extractFujifilm(tags)
+}
+
+func (fujifilmDialect) Compare(input, candidate Recipe) []FieldDiff {
+	return compareFujifilm(input, candidate)
+}
+
+// RicohGR3 is the image control settings of the Ricoh GR III and GR IIIx.
+var RicohGR3 = SettingsDialect{
+	DialectName: "ricoh-gr3",
+	Make:        "RICOH",
+	Models:      []string{"GR III"},
+	Settings: []DialectField{
+		{Name: "ImageControl", Key: "image_control", Tag: "ImageTone", Label: "Image Control", Weight: 3,
+			Values: []string{"Standard", "Vivid", "Monotone", "Soft Monotone", "Hard Monotone", "Hi-Contrast B&W",
+				"Positive Film", "Negative Film", "Bleach Bypass", "Retro", "HDR Tone", "Cross Processing"}},
+		{Name: "RicohSaturation", Key: "saturation", Tag: "Saturation", Label: "Saturation", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "RicohHue", Key: "hue", Tag: "Hue", Label: "Hue", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "HighLowKey", Key: "high_low_key", Tag: "HighLowKeyAdj", Label: "High/Low Key", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "Contrast", Key: "contrast", Tag: "Contrast", Label: "Contrast", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "ContrastHighlight", Key: "contrast_highlight", Tag: "ContrastHighlight", Label: "Contrast (Highlight)", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "ContrastShadow", Key: "contrast_shadow", Tag: "ContrastShadow", Label: "Contrast (Shadow)", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "RicohSharpness", Key: "sharpness", Tag: "Sharpness", Label: "Sharpness", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "Shading", Key: "shading", Tag: "Shading", Label: "Shading", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "RicohClarity", Key: "clarity", Tag: "Clarity", Label: "Clarity", Numeric: true, Range: [2]int{-4, 4}},
+		{Name: "Toning", Key: "toning", Tag: "MonochromeToning", Label: "Toning"},
+		{Name: "FilterEffect", Key: "filter_effect", Tag: "MonochromeFilterEffect", Label: "Filter Effect"},
+		{Name: "RicohWhiteBalance", Key: "white_balance", Tag: "WhiteBalance", Label: "White Balance", Weight: 2},
+	},
+}
+
+func init() {
+	RegisterDialect(fujifilmDialect{})
+	RegisterDialect(RicohGR3)
+}
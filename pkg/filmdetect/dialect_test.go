@@ -0,0 +1,68 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"sync"
+	"testing"
+)
+
+// testDialect has one setting, and matches no camera.
+type testDialect struct{}
+
+func (testDialect) Name() string                    { return "test" }
+func (testDialect) Matches(make, model string) bool { return false }
+
+func (testDialect) Fields() []DialectField {
+	return []DialectField{{Name: "TestTone", Key: "test_tone", Label: "Test Tone", Weight: 3, Numeric: true}}
+}
+
+func (testDialect) Extract(tags map[string]any) (Recipe, error) { return Recipe{}, nil }
+func (testDialect) Compare(input, candidate Recipe) []FieldDiff { return nil }
+
+// TestRegisterDialect registers a dialect while settings are being scored,
+// which go test -race checks.
+func TestRegisterDialect(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				FieldWeight("TestTone")
+				FieldLabel("TestTone")
+			}
+		}()
+	}
+	RegisterDialect(testDialect{})
+	wg.Wait()
+
+	if weight := FieldWeight("TestTone"); weight != 3 {
+		t.Errorf("FieldWeight gave %v, expected 3", weight)
+	}
+	if label := FieldLabel("TestTone"); label != "Test Tone" {
+		t.Errorf("FieldLabel gave %q, expected %q", label, "Test Tone")
+	}
+	if _, ok := FieldWeights["TestTone"]; ok {
+		t.Error("RegisterDialect added to FieldWeights")
+	}
+
+	// The settings of Recipe keep their own weights
+	if weight := FieldWeight("FilmSimulation"); weight != FieldWeights["FilmSimulation"] {
+		t.Errorf("FieldWeight of FilmSimulation gave %v, expected %v", weight, FieldWeights["FilmSimulation"])
+	}
+}
@@ -0,0 +1,273 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// FindRecipeFile returns the file of the recipe called name in the
+// simulation directories.  name is either the name of the recipe, or its
+// full name when recipes of several collections share the name.
+func FindRecipeFile(simulationDirs []string, name string) (string, error) {
+	var found, names []string
+
+	for _, dir := range simulationDirs {
+		files, err := GetRecipeFiles(dir)
+		if err != nil {
+			return "", err
+		}
+
+		for _, file := range files {
+			recipes, err := ParseRecipesFile(file)
+			if err != nil {
+				return "", err
+			}
+
+			for _, recipe := range recipes {
+				recipe.Collection = collectionOf(dir, file)
+				if recipe.FullName() == name || recipe.Name == name {
+					found = append(found, file)
+					names = append(names, recipe.FullName())
+				}
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("No recipe called '%s' in the simulation dirs", name)
+	case 1:
+		return found[0], nil
+	}
+
+	return "", fmt.Errorf("Several recipes are called '%s': %s", name, strings.Join(names, ", "))
+}
+
+// collectionOf is the collection of a recipe file in dir, as GetRecipes
+// names it.
+func collectionOf(dir, file string) string {
+	rel, err := filepath.Rel(dir, filepath.Dir(file))
+	if err != nil || rel == "." {
+		return ""
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// EditRecipeFile sets fields of the recipe called name in a recipe file, and
+// rewrites the file.  fields are keyed by anything RecipeFieldName accepts,
+// and their values are parsed like SetField parses them.  Only the values
+// of the fields are changed: keys filmdetect doesn't know, the order of keys
+// and the formatting of the file are kept.  Nothing is written if the
+// recipe doesn't read, or a new value doesn't pass LintRecipe.  The file
+// keeps its encoding, e.g. UTF-16 with a byte order mark as Notepad saves it.
+func EditRecipeFile(filename, name string, fields map[string]string) error {
+	original, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	contents := decodeText(original)
+
+	start, end, err := findRecipeObject(contents, name)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range fields {
+		field, err := RecipeFieldName(key)
+		if err != nil {
+			return err
+		}
+		values[field] = value
+	}
+
+	// New keys are added in the order of Recipe
+	object := contents[start:end]
+	var changed []string
+	t := reflect.TypeOf(Recipe{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i).Name
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+
+		var recipe Recipe
+		if err := SetField(&recipe, field, value); err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(reflect.ValueOf(recipe).FieldByName(field).Interface())
+		if err != nil {
+			return err
+		}
+
+		object, err = setObjectKey(object, recipeFieldKeys(field), encoded)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		changed = append(changed, field)
+	}
+
+	edited := append(append(append([]byte{}, contents[:start]...), object...), contents[end:]...)
+
+	// Read the result the way it will be read later on
+	recipe, err := decodeRecipe(object, func(extends string) (Recipe, error) {
+		base := RecipePath(extends)
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(filename), base)
+		}
+		return ParseRecipeFile(base)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, issue := range LintRecipe(recipe) {
+		for _, field := range changed {
+			if issue.Field == field && issue.Variant == "" {
+				return fmt.Errorf("%s: %s", filename, issue)
+			}
+		}
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, encodeText(edited, original), info.Mode().Perm())
+}
+
+// recipeFieldKeys returns the key of a Recipe field in recipe files,
+// followed by the older names of the key migrateRecipe still reads.
+func recipeFieldKeys(field string) []string {
+	f, _ := reflect.TypeOf(Recipe{}).FieldByName(field)
+	key := strings.Split(f.Tag.Get("json"), ",")[0]
+
+	keys := []string{key}
+	for old, name := range v1SettingKeys {
+		if name == key {
+			keys = append(keys, old)
+		}
+	}
+
+	return keys
+}
+
+// findRecipeObject returns where the JSON object of the recipe called name
+// starts and ends in the contents of a recipe file.  A file of a single
+// recipe holds it whatever its name.
+func findRecipeObject(contents []byte, name string) (int, int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+
+	if !isJSONArray(contents) {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return 0, 0, err
+		}
+		end := int(decoder.InputOffset())
+		return end - len(raw), end, nil
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return 0, 0, err
+	}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return 0, 0, err
+		}
+		end := int(decoder.InputOffset())
+
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &named); err != nil {
+			return 0, 0, err
+		}
+		if named.Name == name || strings.HasSuffix(name, "/"+named.Name) {
+			return end - len(raw), end, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("No recipe called '%s'", name)
+}
+
+// setObjectKey replaces the value of the first of keys the JSON object has,
+// regardless of case like json.Unmarshal, with value.  When it has none of
+// them, the first key is added after the last one, indented like it.
+func setObjectKey(object []byte, keys []string, value []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(object))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	lastKeyStart, lastValueEnd := -1, -1
+	for decoder.More() {
+		keyEnd := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+		keyStart := bytes.IndexByte(object[keyEnd:], '"') + keyEnd
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		valueEnd := int(decoder.InputOffset())
+		valueStart := valueEnd - len(raw)
+
+		for _, k := range keys {
+			if strings.EqualFold(k, key) {
+				return append(append(append([]byte{}, object[:valueStart]...), value...), object[valueEnd:]...), nil
+			}
+		}
+
+		lastKeyStart, lastValueEnd = keyStart, valueEnd
+	}
+
+	name, _ := json.Marshal(keys[0])
+	member := append(append(name, ": "...), value...)
+
+	if lastKeyStart < 0 {
+		open := bytes.IndexByte(object, '{') + 1
+		return append(append(append([]byte{}, object[:open]...), member...), object[open:]...), nil
+	}
+
+	// The whitespace before the last key, e.g. a newline and two spaces, or
+	// a space on a single line
+	indent := object[bytes.LastIndexAny(object[:lastKeyStart], ",{")+1 : lastKeyStart]
+	if newline := bytes.LastIndexByte(indent, '\n'); newline >= 0 {
+		indent = indent[newline:]
+	} else {
+		indent = []byte(" ")
+	}
+
+	inserted := append([]byte{','}, indent...)
+	inserted = append(inserted, member...)
+	return append(append(append([]byte{}, object[:lastValueEnd]...), inserted...), object[lastValueEnd:]...), nil
+}
@@ -0,0 +1,62 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditRecipeFileKeepsEncoding(t *testing.T) {
+	const recipe = "{\n  \"name\": \"Kodachrome\",\n  \"film_simulation\": \"Classic Chrome\",\n  \"sharpness\": 0\n}\n"
+
+	encodings := []struct {
+		name string
+		bom  []byte
+	}{
+		{"UTF-8", nil},
+		{"UTF-8 with BOM", bomUTF8},
+		{"UTF-16 LE", bomUTF16LE},
+		{"UTF-16 BE", bomUTF16BE},
+	}
+
+	for _, encoding := range encodings {
+		filename := filepath.Join(t.TempDir(), "kodachrome.json")
+		if err := os.WriteFile(filename, encodeText([]byte(recipe), encoding.bom), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := EditRecipeFile(filename, "Kodachrome", map[string]string{"sharpness": "2"}); err != nil {
+			t.Fatalf("%s: %v", encoding.name, err)
+		}
+
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Replace(recipe, `"sharpness": 0`, `"sharpness": 2`, 1)
+		if got := decodeText(contents); string(got) != want {
+			t.Errorf("%s: edited file reads %q, expected %q", encoding.name, got, want)
+		}
+		if !bytes.Equal(contents, encodeText([]byte(want), encoding.bom)) {
+			t.Errorf("%s: edited file isn't in its original encoding: % x", encoding.name, contents[:min(len(contents), 8)])
+		}
+	}
+}
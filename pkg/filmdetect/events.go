@@ -0,0 +1,89 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+// EventKind says what happened in an Event.
+type EventKind int
+
+const (
+	// The recipes to compare with were read
+	RecipesLoaded EventKind = iota + 1
+	// Detection started on a file of a batch
+	FileStarted
+	// An image was compared with one candidate recipe
+	CandidateCompared
+	// Detection finished on a file of a batch, successfully or not
+	FileDone
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case RecipesLoaded:
+		return "recipes-loaded"
+	case FileStarted:
+		return "file-started"
+	case CandidateCompared:
+		return "candidate-compared"
+	case FileDone:
+		return "file-done"
+	}
+
+	return "unknown"
+}
+
+// Event reports the progress of detection to Options.Events, e.g. for a
+// progress bar in a desktop app.  Which fields are set depends on the Kind.
+type Event struct {
+	Kind EventKind
+	// The image being detected; not set for RecipesLoaded
+	File string
+	// For FileStarted and FileDone, the position of File in the batch,
+	// counting from 1, and the size of the batch.  For CandidateCompared, the
+	// same for the candidate among all candidates of File.
+	Index int
+	Total int
+	// How many recipes were loaded, for RecipesLoaded
+	Recipes int
+	// The full name of the candidate, for CandidateCompared
+	Candidate string
+	// The outcome, for FileDone
+	Record *DetectionRecord
+}
+
+// emit sends an event to the Events callback, if there is one.
+func (o Options) emit(event Event) {
+	if o.Events != nil {
+		o.Events(event)
+	}
+}
+
+// forFile returns options whose events are about file.
+func (o Options) forFile(file string) Options {
+	if o.Events == nil {
+		return o
+	}
+
+	events := o.Events
+	o.Events = func(event Event) {
+		if event.File == "" {
+			event.File = file
+		}
+		events(event)
+	}
+
+	return o
+}
@@ -0,0 +1,213 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scorerWeight returns how much a setting counts with scorer, if the scorer
+// is one of ours.
+func scorerWeight(scorer Scorer, field string) (float64, bool) {
+	switch s := scorer.(type) {
+	case WeightedScorer:
+		return s.weight(field), true
+	case CountScorer:
+		return 1, true
+	}
+
+	return 0, false
+}
+
+// scorerMax returns the score of a perfect match with scorer, if the scorer
+// is one of ours.
+func scorerMax(scorer Scorer) (float64, bool) {
+	switch s := scorer.(type) {
+	case WeightedScorer:
+		return s.MaxScore(), true
+	case CountScorer:
+		return float64(len(ScoringFields())), true
+	}
+
+	return 0, false
+}
+
+// explainValue prints a setting, making empty ones visible.
+func explainValue(field string, value interface{}) string {
+	if value == "" {
+		return "(empty)"
+	}
+
+	return FormatValue(field, value)
+}
+
+// ExplainDifference describes how the score of d came about: every compared
+// setting with its weight, and the settings that weren't compared.
+func ExplainDifference(d Difference, opts Options) string {
+	scorer := opts.scorer()
+	out := &strings.Builder{}
+
+	fmt.Fprintf(out, "%s: score %.1f", d.Candidate.FullName(), d.Score())
+	if max, ok := scorerMax(scorer); ok {
+		fmt.Fprintf(out, " of %.1f", max)
+	}
+	if d.Confidence != UnknownConfidence {
+		fmt.Fprintf(out, ", %s confidence", d.Confidence)
+	}
+	fmt.Fprintln(out)
+
+	compared := map[string]bool{}
+	weighted, isWeighted := scorer.(WeightedScorer)
+	shiftExplained := false
+	for _, field := range d.Fields() {
+		compared[field.Field] = true
+
+		// A mismatch costs its weight, a match costs nothing, and a differing
+		// white balance shift costs its distance once
+		weight := ""
+		if w, ok := scorerWeight(scorer, field.Field); ok {
+			switch {
+			case field.Matched:
+				weight = fmt.Sprintf("weight %.1f", w)
+			case isWeighted && isWhiteBalanceShiftField(field.Field) && shiftExplained:
+				weight = "counted with the other shift"
+			case isWeighted && isWhiteBalanceShiftField(field.Field):
+				input, candidate := whiteBalanceShifts(d.Mismatches())
+				weight = fmt.Sprintf("-%.1f for distance %.1f", weighted.whiteBalanceShiftPenalty(d.Mismatches()), input.Distance(candidate))
+				shiftExplained = true
+			default:
+				weight = fmt.Sprintf("-%.1f", w)
+			}
+			if IsCriticalField(field.Field) {
+				weight += ", critical"
+			}
+		}
+
+		if field.Matched {
+			fmt.Fprintf(out, "  = %-22s %-26s %s\n", FieldLabel(field.Field), explainValue(field.Field, field.Input), weight)
+		} else {
+			value := explainValue(field.Field, field.Input) + ", recipe has " + explainValue(field.Field, field.Candidate)
+			fmt.Fprintf(out, "  ≠ %-22s %-26s %s\n", FieldLabel(field.Field), value, weight)
+		}
+	}
+
+	monochrome := IsMonochrome(d.Input.FilmSimulation) || IsMonochrome(d.Candidate.FilmSimulation)
+	var skipped, unset []string
+	for _, field := range ScoringFields() {
+		if compared[field] {
+			continue
+		}
+		if monochrome || !fieldComparisons[field].Monochrome {
+			unset = append(unset, FieldLabel(field))
+		} else {
+			skipped = append(skipped, FieldLabel(field))
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "  Only used by black and white film simulations, so count as matching: %s\n", strings.Join(skipped, ", "))
+	}
+	if len(unset) > 0 {
+		fmt.Fprintf(out, "  Left out by the recipe, so count as matching: %s\n", strings.Join(unset, ", "))
+	}
+
+	if opts.Camera != "" {
+		for _, variant := range d.Candidate.Variants {
+			if variant.Matches(opts.Camera) {
+				fmt.Fprintf(out, "  Compared with the variant for %s\n", strings.Join(variant.Cameras, ", "))
+				break
+			}
+		}
+
+		var missing []string
+		for _, field := range ScoringFields() {
+			if !HasField(opts.Camera, field) {
+				missing = append(missing, FieldLabel(field))
+			}
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(out, "  The %s doesn't have %s, which count as matching\n", opts.Camera, strings.Join(missing, ", "))
+		}
+	}
+
+	return out.String()
+}
+
+// ExplainRanking describes the first n candidates of a ranking made by
+// RankRecipes with opts, and how ties between them were broken.
+func ExplainRanking(ranked []Difference, opts Options, n int) string {
+	out := &strings.Builder{}
+
+	if n > len(ranked) {
+		n = len(ranked)
+	}
+
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(out, "%d. %s\n", i+1, ExplainDifference(ranked[i], opts))
+	}
+
+	if n > 1 && ranked[0].Score() == ranked[1].Score() {
+		fmt.Fprintf(out, "%s and %s have the same score; they are listed in the order the recipes were read, later simulation dirs last.\n",
+			ranked[0].Candidate.FullName(), ranked[1].Candidate.FullName())
+	}
+
+	if len(ranked) > 0 {
+		fmt.Fprintf(out, "%s confidence: %s\n", ranked[0].Confidence, confidenceReason(ranked))
+	}
+
+	return out.String()
+}
+
+// confidenceReason explains the rating RateConfidence gave the best
+// candidate of a ranking.
+func confidenceReason(ranked []Difference) string {
+	best := ranked[0]
+
+	if len(best.CriticalFields()) > 0 {
+		return "the closest recipe differs in a critical setting"
+	}
+	if !best.IsGoodMatch() {
+		return fmt.Sprintf("the closest recipe differs in more than %d settings", MaxMismatches)
+	}
+
+	margin := -1.0
+	if len(ranked) > 1 {
+		margin = best.Score() - ranked[1].Score()
+	}
+
+	if margin == 0 {
+		if best.IsFullScore() {
+			return "another recipe matches just as well"
+		}
+		return "the closest recipes are tied"
+	}
+
+	switch best.Confidence {
+	case HighConfidence:
+		if margin < 0 {
+			return "it's the only recipe"
+		}
+		return fmt.Sprintf("the next recipe scores %.1f less", margin)
+	case MediumConfidence:
+		if len(best.Mismatches()) > 1 {
+			return fmt.Sprintf("the closest recipe differs in %d settings", len(best.Mismatches()))
+		}
+		return fmt.Sprintf("the next recipe scores only %.1f less", margin)
+	}
+
+	return "no recipes were ranked"
+}
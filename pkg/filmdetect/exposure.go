@@ -0,0 +1,109 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseExposureCompensation parses an exposure value such as "+2/3", "-1" or
+// "0.7".
+func ParseExposureCompensation(input string) (float64, error) {
+	input = strings.TrimSpace(input)
+
+	parts := strings.SplitN(input, "/", 2)
+	numerator, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Parsing exposure compensation failed: Unexpected value: '%s'", input)
+	}
+
+	if len(parts) == 1 {
+		return numerator, nil
+	}
+
+	denominator, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || denominator == 0 {
+		return 0, fmt.Errorf("Parsing exposure compensation failed: Unexpected value: '%s'", input)
+	}
+
+	return numerator / denominator, nil
+}
+
+// ParseExposureCompensationRange parses the exposure compensation suggested
+// by a recipe, either a single value or a range such as "+1/3 to +1".
+func ParseExposureCompensationRange(input string) (float64, float64, error) {
+	parts := regexp.MustCompile(`\s+to\s+|\.\.`).Split(strings.TrimSpace(input), 2)
+
+	low, err := ParseExposureCompensation(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 1 {
+		return low, low, nil
+	}
+
+	high, err := ParseExposureCompensation(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if low > high {
+		low, high = high, low
+	}
+
+	return low, high, nil
+}
+
+// CheckSuggestions compares the ISO and exposure compensation of a photo to
+// what the recipe suggests, and describes every value that falls outside of
+// the suggestion.  These settings don't take part in scoring.  It also tells
+// which dynamic range the camera chose for a recipe that leaves it to Auto.
+func CheckSuggestions(recipe Recipe, extraction ExtractionResult) ([]string, error) {
+	var notes []string
+
+	if !extraction.Recipe.IsUnset("DynamicRange") && autoDynamicRange("DynamicRange", extraction.Recipe.DynamicRange, recipe.DynamicRange) {
+		notes = append(notes, fmt.Sprintf("Dynamic range was %s, which Auto chose.", FormatValue("DynamicRange", extraction.Recipe.DynamicRange)))
+	}
+
+	if recipe.IsoMin > 0 && extraction.ISO > 0 && extraction.ISO < recipe.IsoMin {
+		notes = append(notes, fmt.Sprintf("ISO %d is below the suggested minimum of %d.", extraction.ISO, recipe.IsoMin))
+	}
+
+	if recipe.IsoMax > 0 && extraction.ISO > recipe.IsoMax {
+		notes = append(notes, fmt.Sprintf("ISO %d is above the suggested maximum of %d.", extraction.ISO, recipe.IsoMax))
+	}
+
+	if recipe.ExposureCompensation != "" {
+		low, high, err := ParseExposureCompensationRange(recipe.ExposureCompensation)
+		if err != nil {
+			return notes, err
+		}
+
+		// Thirds of a stop don't survive floating point exactly
+		const tolerance = 0.05
+		ec := extraction.ExposureCompensation
+		if ec < low-tolerance || ec > high+tolerance {
+			notes = append(notes, fmt.Sprintf("Exposure compensation %+.1f is outside the suggested %s.", ec, recipe.ExposureCompensation))
+		}
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,203 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RecipeFieldName resolves name to the name of a Recipe struct field.  Both
+// the Go field name and the JSON key are accepted, case-insensitively.
+func RecipeFieldName(name string) (string, error) {
+	t := reflect.TypeOf(Recipe{})
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+
+		if strings.EqualFold(field.Name, name) || (jsonName != "" && strings.EqualFold(jsonName, name)) {
+			return field.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown recipe field: '%s'", name)
+}
+
+// CompleteValue returns the known values of an enum field that contain input,
+// ignoring case.  An exact match is returned on its own.
+func CompleteValue(field, input string) []string {
+	var completions []string
+
+	for _, value := range EnumValues[field] {
+		if strings.EqualFold(value, input) {
+			return []string{value}
+		}
+
+		if strings.Contains(strings.ToLower(value), strings.ToLower(input)) {
+			completions = append(completions, value)
+		}
+	}
+
+	return completions
+}
+
+// CanSetField reports whether SetField can set the named field of Recipe:
+// text, numbers and lists of text, but not e.g. the Settings of a dialect.
+func CanSetField(name string) bool {
+	fieldName, err := RecipeFieldName(name)
+	if err != nil {
+		return false
+	}
+
+	field, _ := reflect.TypeOf(Recipe{}).FieldByName(fieldName)
+	switch field.Type.Kind() {
+	case reflect.String, reflect.Int:
+		return true
+	case reflect.Slice:
+		return field.Type.Elem().Kind() == reflect.String
+	}
+
+	return false
+}
+
+// SetField parses value and assigns it to the named field of r.  Enum values
+// are matched case-insensitively and stored in their canonical spelling,
+// integers are checked against IntRanges, and lists are separated by commas.
+func SetField(r *Recipe, name string, value string) error {
+	fieldName, err := RecipeFieldName(name)
+	if err != nil {
+		return err
+	}
+
+	if !CanSetField(fieldName) {
+		return fmt.Errorf("Field %s can't be set", fieldName)
+	}
+
+	field := reflect.ValueOf(r).Elem().FieldByName(fieldName)
+
+	switch field.Kind() {
+	case reflect.String:
+		values, isEnum := EnumValues[fieldName]
+		if !isEnum {
+			field.SetString(value)
+			return nil
+		}
+
+		value = NormalizeValue(fieldName, value)
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				field.SetString(v)
+				*r = r.withSet(fieldName)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("Invalid value for %s: '%s'", fieldName, value)
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s: '%s' is not a number", fieldName, value)
+		}
+
+		if limits, ok := IntRanges[fieldName]; ok && (i < limits[0] || i > limits[1]) {
+			return fmt.Errorf("Invalid value for %s: %d is outside of %d..%d", fieldName, i, limits[0], limits[1])
+		}
+
+		field.SetInt(int64(i))
+		*r = r.withSet(fieldName)
+		return nil
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	return fmt.Errorf("Field %s can't be set", fieldName)
+}
+
+// FieldLabels are the names of the settings as the camera menus show them.
+var FieldLabels = map[string]string{
+	"FilmSimulation":       "Film Simulation",
+	"GrainEffectSize":      "Grain Size",
+	"GrainEffectRoughness": "Grain Roughness",
+	"ColorChromeEffect":    "Color Chrome Effect",
+	"ColorChromeFXBlue":    "Color Chrome FX Blue",
+	"SmoothSkinEffect":     "Smooth Skin Effect",
+	"WhiteBalanceMode":     "White Balance",
+	"WhiteBalanceRed":      "WB Shift Red",
+	"WhiteBalanceBlue":     "WB Shift Blue",
+	"WhiteBalanceShift":    "WB Shift",
+	"DynamicRange":         "Dynamic Range",
+	"DRangePriority":       "D Range Priority",
+	"Highlights":           "Highlight",
+	"Shadows":              "Shadow",
+	"Color":                "Color",
+	"Sharpness":            "Sharpness",
+	"NoiseReduction":       "High ISO NR",
+	"Clarity":              "Clarity",
+	"MonochromeFilter":     "Monochrome Filter",
+	"ToningWarmCool":       "Monochromatic Color WC",
+	"ToningMagentaGreen":   "Monochromatic Color MG",
+}
+
+// FieldLabel returns the human-friendly name of a Recipe field or a setting
+// of a dialect, for showing to people.  Fields without a label keep their
+// name.
+func FieldLabel(name string) string {
+	if label, ok := FieldLabels[name]; ok {
+		return label
+	}
+	if field, ok := dialectField(name); ok && field.Label != "" {
+		return field.Label
+	}
+
+	return name
+}
+
+// FormatValue formats the value of a setting the way the camera shows it:
+// "+2" rather than "2" for tone and other adjustments, and "DR400" rather
+// than "400".
+func FormatValue(field string, value interface{}) string {
+	switch v := value.(type) {
+	case int:
+		if v > 0 {
+			return fmt.Sprintf("+%d", v)
+		}
+		return strconv.Itoa(v)
+	case string:
+		if field == "DynamicRange" {
+			if _, err := strconv.Atoi(v); err == nil {
+				return "DR" + v
+			}
+		}
+		return v
+	}
+
+	return fmt.Sprintf("%v", value)
+}
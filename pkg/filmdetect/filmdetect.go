@@ -20,59 +20,155 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"os"
 	"path/filepath"
-	"reflect"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/barasher/go-exiftool"
 	"github.com/olekukonko/tablewriter"
 )
 
-// The number of fields in Recipe
-const FullScore = 16
+// The number of differing fields past which a candidate is no longer
+// considered a good match.
+const MaxMismatches = 3
 
+// A Recipe is a set of camera settings.  Their compare struct tags say how
+// they're compared, see fieldComparison.  Fields tagged `filmdetect:"meta"`
+// describe the recipe.
 type Recipe struct {
-	Name                 string `json:"name"`
-	Author               string
-	Url                  string
-	FilmSimulation       string `json:"film_simulation"`
-	GrainEffectSize      string `json:"grain_effect_size"`
-	GrainEffectRoughness string `json:"grain_effect_roughness"`
-	ColorChromeEffect    string `json:"color_chrome_effect"`
-	ColorChromeFXBlue    string `json:"color_chrome_fx_blue"`
-	WhiteBalanceMode     string `json:"white_balance_mode"`
-	WhiteBalanceRed      int    `json:"white_balance_r"`
-	WhiteBalanceBlue     int    `json:"white_balance_b"`
-	DynamicRange         string `json:"dynamic_range"`
-	Highlights           int    `json:"tone_curve_highlights"`
-	Shadows              int    `json:"tone_curve_shadows"`
-	Color                int
-	Sharpness            int
-	NoiseReduction       int `json:"noise_reduction"`
-	Clarity              int
+	Name                 string    `json:"name" filmdetect:"meta" compare:"-"`
+	Author               string    `json:"author" filmdetect:"meta" compare:"-"`
+	Url                  string    `json:"url" filmdetect:"meta" compare:"-"`
+	Collection           string    `json:"collection,omitempty" filmdetect:"meta" compare:"-"`
+	Created              string    `json:"created,omitempty" filmdetect:"meta" compare:"-"`
+	Updated              string    `json:"updated,omitempty" filmdetect:"meta" compare:"-"`
+	Notes                string    `json:"notes,omitempty" filmdetect:"meta" compare:"-"`
+	Tags                 []string  `json:"tags,omitempty" filmdetect:"meta" compare:"-"`
+	FilmSimulation       string    `json:"film_simulation" compare:"weight=3"`
+	GrainEffectSize      string    `json:"grain_effect_size"`
+	GrainEffectRoughness string    `json:"grain_effect_roughness"`
+	ColorChromeEffect    string    `json:"color_chrome_effect"`
+	ColorChromeFXBlue    string    `json:"color_chrome_fx_blue"`
+	SmoothSkinEffect     string    `json:"smooth_skin_effect"`
+	WhiteBalanceMode     string    `json:"white_balance_mode" compare:"weight=2"`
+	WhiteBalanceRed      int       `json:"white_balance_r" compare:"weight=2"`
+	WhiteBalanceBlue     int       `json:"white_balance_b" compare:"weight=2"`
+	DynamicRange         string    `json:"dynamic_range" compare:"weight=2"`
+	DRangePriority       string    `json:"d_range_priority" compare:"weight=2"`
+	Highlights           int       `json:"tone_curve_highlights"`
+	Shadows              int       `json:"tone_curve_shadows"`
+	Color                int       `json:"color"`
+	Sharpness            int       `json:"sharpness"`
+	NoiseReduction       int       `json:"noise_reduction"`
+	Clarity              int       `json:"clarity"`
+	MonochromeFilter     string    `json:"monochrome_filter" compare:"monochrome"`
+	ToningWarmCool       int       `json:"toning_warm_cool" compare:"monochrome"`
+	ToningMagentaGreen   int       `json:"toning_magenta_green" compare:"monochrome"`
+	IsoMin               int       `json:"iso_min,omitempty" compare:"-"`
+	IsoMax               int       `json:"iso_max,omitempty" compare:"-"`
+	ExposureCompensation string    `json:"exposure_compensation,omitempty" compare:"-"`
+	Variants             []Variant `json:"variants,omitempty" compare:"-"`
+	// See Dialect; recipes of other dialects than FujifilmDialect keep their
+	// settings in Settings
+	Dialect  string         `json:"dialect,omitempty" compare:"-"`
+	Settings map[string]any `json:"settings,omitempty" compare:"-"`
+	// The settings the recipe file leaves out
+	Unset []string `json:"-" compare:"-"`
+}
+
+// FullName is the name of the recipe, prefixed with its collection if it has
+// one.
+func (r Recipe) FullName() string {
+	if r.Collection == "" {
+		return r.Name
+	}
+
+	return r.Collection + "/" + r.Name
+}
+
+// FilterByCollection returns the recipes that belong to one of collections.
+func FilterByCollection(recipes []Recipe, collections []string) []Recipe {
+	var filtered []Recipe
+
+	for _, recipe := range recipes {
+		for _, collection := range collections {
+			if recipe.Collection == collection {
+				filtered = append(filtered, recipe)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// HasTag reports whether the recipe is tagged with tag, ignoring case.
+func (r Recipe) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterByTags returns the recipes that have at least one of tags.
+func FilterByTags(recipes []Recipe, tags []string) []Recipe {
+	var filtered []Recipe
+
+	for _, recipe := range recipes {
+		for _, tag := range tags {
+			if recipe.HasTag(tag) {
+				filtered = append(filtered, recipe)
+				break
+			}
+		}
+	}
+
+	return filtered
 }
 
 func (r Recipe) String() string {
+	if r.DialectName() != FujifilmDialect {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Name: %s\n  Dialect: %s\n", r.Name, r.Dialect)
+		for _, field := range r.dialect().Fields() {
+			if value, ok := r.Settings[field.Key]; ok {
+				fmt.Fprintf(&b, "  %s: %v\n", field.Name, value)
+			}
+		}
+		return b.String()
+	}
+
 	return fmt.Sprintf(`Name: %s
   FilmSimulation: %s
   GrainEffectSize: %s
   GrainEffectRoughness: %s
   ColorChromeEffect: %s
   ColorChromeFXBlue: %s
+  SmoothSkinEffect: %s
   WhiteBalanceMode: %s
   WhiteBalanceRed: %d
   WhiteBalanceBlue: %d
   DynamicRange: %s
+  DRangePriority: %s
   Highlights: %d
   Shadows: %d
   Color: %d
   Sharpness: %d
   NoiseReduction: %d
   Clarity: %d
+  MonochromeFilter: %s
+  ToningWarmCool: %d
+  ToningMagentaGreen: %d
 `,
 		r.Name,
 		r.FilmSimulation,
@@ -80,16 +176,72 @@ func (r Recipe) String() string {
 		r.GrainEffectRoughness,
 		r.ColorChromeEffect,
 		r.ColorChromeFXBlue,
+		r.SmoothSkinEffect,
 		r.WhiteBalanceMode,
 		r.WhiteBalanceRed,
 		r.WhiteBalanceBlue,
 		r.DynamicRange,
+		r.DRangePriority,
 		r.Highlights,
 		r.Shadows,
 		r.Color,
 		r.Sharpness,
 		r.NoiseReduction,
-		r.Clarity)
+		r.Clarity,
+		r.MonochromeFilter,
+		r.ToningWarmCool,
+		r.ToningMagentaGreen)
+}
+
+// ExtractionResult holds everything read from an image: the recipe it was shot
+// with, and the camera state around it.
+type ExtractionResult struct {
+	Recipe Recipe `json:"recipe"`
+	// The custom setting bank (C1-C7) that was active, if the camera recorded
+	// it.
+	CustomSlot string `json:"custom_slot,omitempty"`
+
+	Make                 string    `json:"make"`
+	Model                string    `json:"model"`
+	CaptureTime          time.Time `json:"capture_time"`
+	ISO                  int       `json:"iso"`
+	ExposureCompensation float64   `json:"exposure_compensation"`
+	Lens                 string    `json:"lens,omitempty"`
+	// As exiftool shows it, e.g. "1/250" or "2"
+	ShutterSpeed string  `json:"shutter_speed,omitempty"`
+	Aperture     float64 `json:"aperture,omitempty"`
+
+	// The tags exiftool read from the image, for debugging and for settings
+	// filmdetect doesn't model.  File system details, keywords and binary
+	// data such as thumbnails are left out.
+	RawFields map[string]any `json:"raw_fields,omitempty"`
+
+	// The settings that couldn't be read, with Extractor.Lenient.  They are
+	// unset in the Recipe, and not compared.
+	FieldErrors FieldErrors `json:"field_errors,omitempty"`
+
+	// The converter the image was converted from RAW with, e.g. "X RAW
+	// Studio", if it tells
+	RAWConverter string `json:"raw_converter,omitempty"`
+
+	// Whether the file is a movie, of which only the VideoFields are
+	// compared
+	Video bool `json:"video,omitempty"`
+}
+
+// Camera names the camera that took the image, e.g. "FUJIFILM X-T4", without
+// repeating the make when the model starts with it.
+func (e ExtractionResult) Camera() string {
+	return cameraName(e.Make, e.Model)
+}
+
+func cameraName(make, model string) string {
+	brand, _, _ := strings.Cut(make, " ")
+	if brand == "" || strings.HasPrefix(strings.ToUpper(model), strings.ToUpper(brand)) {
+		return strings.TrimSpace(model)
+	}
+
+	return strings.TrimSpace(make + " " + model)
 }
 
 func GetFiles(path string) ([]string, error) {
@@ -114,47 +266,168 @@ func GetFiles(path string) ([]string, error) {
 	return files, nil
 }
 
+// ParseRecipeFile reads a recipe file, resolving the recipes it extends.
 func ParseRecipeFile(filename string) (Recipe, error) {
-	var recipe Recipe
-	contents, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return recipe, err
-	}
-	err = json.Unmarshal(contents, &recipe)
+	return parseRecipeFile(filename, nil)
+}
 
-	if err != nil {
-		return recipe, err
-	}
+// ParseRecipesFile reads a recipe file that holds either a single recipe, or
+// a JSON array of recipes, as community dumps are often distributed.
+func ParseRecipesFile(filename string) ([]Recipe, error) {
+	return parseRecipesFile(filename, nil)
+}
 
-	return recipe, nil
+// GetRecipeFiles returns the JSON files in dir and its subdirectories,
+// skipping hidden ones such as .git.  If dir is a file, that's the only one.
+func GetRecipeFiles(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		hidden := path != dir && strings.HasPrefix(info.Name(), ".")
+
+		if info.IsDir() {
+			if hidden {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !hidden && HasExtension(path, ".json") && info.Name() != DefaultsFile {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	sort.Strings(files)
+
+	return files, err
 }
 
+// GetRecipes reads all recipes in simulationDir and its subdirectories.  The
+// subdirectory a recipe is in becomes its Collection.  Settings a recipe
+// leaves out are taken from the DefaultsFile of its collection, or failing
+// that, of simulationDir.  simulationDir may also be a single file of
+// recipes, or an archive of them.
 func GetRecipes(simulationDir string) ([]Recipe, error) {
+	recipes, _, err := GetRecipesWithOptions(simulationDir, LoadOptions{})
+	return recipes, err
+}
+
+// GetRecipesWithOptions is GetRecipes, with opts deciding what happens to
+// files that can't be read.
+func GetRecipesWithOptions(simulationDir string, opts LoadOptions) ([]Recipe, LoadReport, error) {
+	report := LoadReport{}
+
+	if IsRecipeArchive(simulationDir) {
+		recipes, err := getRecipesFromArchive(simulationDir, opts, &report)
+		return recipes, report, err
+	}
+
 	var recipes []Recipe
-	files, err := GetFiles(simulationDir)
+	files, err := GetRecipeFiles(simulationDir)
+	defaults := map[string]*Recipe{}
 
 	if err != nil {
-		return recipes, err
+		return recipes, report, err
 	}
 
-	for _, file := range files {
-		recipe, err := ParseRecipeFile(file)
+	root := simulationRoot(simulationDir)
 
+	for _, file := range files {
+		fileRecipes, err := readRecipesFile(root, file, defaults)
 		if err != nil {
-			return recipes, err
+			if opts.skip(&report, file, err) {
+				continue
+			}
+			return recipes, report, err
+		}
+
+		recipes = append(recipes, fileRecipes...)
+	}
+
+	return recipes, report, nil
+}
+
+// simulationRoot returns the directory the collections of simulationDir are
+// relative to, which is its parent when it's a single file.
+func simulationRoot(simulationDir string) string {
+	if info, err := os.Stat(simulationDir); err == nil && !info.IsDir() {
+		return filepath.Dir(simulationDir)
+	}
+
+	return simulationDir
+}
+
+// readRecipesFile reads the recipes of a file in the simulation dir root,
+// with their collection and the defaults of their directories, which are
+// cached in defaults.
+func readRecipesFile(root, file string, defaults map[string]*Recipe) ([]Recipe, error) {
+	fileRecipes, err := ParseRecipesFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := readDefaults(root, filepath.Dir(file), defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := filepath.Rel(root, filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, recipe := range fileRecipes {
+		if collection != "." {
+			recipe.Collection = filepath.ToSlash(collection)
 		}
 
-		recipes = append(recipes, recipe)
+		for _, d := range chain {
+			recipe = recipe.WithDefaults(d)
+		}
 
+		fileRecipes[i] = recipe
 	}
 
-	return recipes, nil
+	return fileRecipes, nil
+}
+
+// GetRecipesFromDirs reads the recipes of several simulation directories.  A
+// recipe overrides any recipe of the same name from an earlier directory.
+func GetRecipesFromDirs(simulationDirs []string) ([]Recipe, error) {
+	recipes, _, err := GetRecipesFromDirsWithOptions(simulationDirs, LoadOptions{})
+	return recipes, err
+}
+
+// GetRecipesFromDirsWithOptions is GetRecipesFromDirs, with opts deciding
+// what happens to files that can't be read, and to recipes that share a name
+// but not their settings.
+func GetRecipesFromDirsWithOptions(simulationDirs []string, opts LoadOptions) ([]Recipe, LoadReport, error) {
+	var lists [][]Recipe
+	report := LoadReport{}
+
+	for _, dir := range simulationDirs {
+		dirRecipes, dirReport, err := GetRecipesWithOptions(dir, opts)
+		report.Skipped = append(report.Skipped, dirReport.Skipped...)
+		if err != nil {
+			recipes, _ := mergeRecipes(opts, &report, simulationDirs, lists)
+			return recipes, report, err
+		}
+
+		lists = append(lists, dirRecipes)
+	}
 
+	recipes, err := mergeRecipes(opts, &report, simulationDirs, lists)
+	return recipes, report, err
 }
 
 func GetRecipeFromJson(b []byte) (Recipe, error) {
-	recipe := Recipe{}
-	err := json.Unmarshal(b, &recipe)
+	recipe, err := decodeRecipe(b, nil)
 	if err != nil {
 		return recipe, err
 	}
@@ -162,27 +435,106 @@ func GetRecipeFromJson(b []byte) (Recipe, error) {
 	return recipe, nil
 }
 
+// exiftool reports the white balance shift in steps of 20, one for every
+// step on the camera
+const ExifWhiteBalanceScale = 20
+
+// ParseError is returned when a metadata value is in a format we don't know
+type ParseError struct {
+	Tag   string
+	Value string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Parsing %s failed: Unexpected value: '%s'", e.Tag, e.Value)
+}
+
+// FieldError is a setting that couldn't be read from an image.
+type FieldError struct {
+	// The tag the setting is read from, and its value
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+	// The Recipe fields the tag sets
+	Fields []string `json:"fields"`
+	Err    error    `json:"-"`
+}
+
+func (e FieldError) Error() string {
+	return e.Err.Error()
+}
+
+func (e FieldError) MarshalJSON() ([]byte, error) {
+	type fieldError FieldError
+	return json.Marshal(struct {
+		fieldError
+		Error string `json:"error"`
+	}{fieldError(e), e.Error()})
+}
+
+// FieldErrors are returned by Extract for an image with settings that can't
+// be read.  Extractor.Lenient reads the others anyway.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.As find the errors of the single fields, e.g. a
+// *ParseError.
+func (e FieldErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err.Err
+	}
+	return errs
+}
+
+var (
+	whiteBalanceChannel = regexp.MustCompile(`(?i)\b(red|blue|r|b)\b\s*:?\s*([\-+]?[0-9]+)`)
+	whiteBalanceNumber  = regexp.MustCompile(`^\s*([\-+]?[0-9]+)[\s,;]+([\-+]?[0-9]+)\s*$`)
+)
+
+// ParseWhiteBalanceOffset reads the red and blue white balance shift, in
+// camera units, from exiftool's WhiteBalanceFineTune.  It accepts
+// "Red +20, Blue -40", either order, values without a sign, and the bare
+// "20 -40" printed with -n.
 func ParseWhiteBalanceOffset(input string) (int, int, error) {
-	if input == "" {
+	if strings.TrimSpace(input) == "" {
 		return 0, 0, nil
 	}
-	p := regexp.MustCompile(`Red ([\-+][0-9]+), Blue ([\-+][0-9]+)`)
-	matches := p.FindStringSubmatch(input)
 
-	redMatch := matches[1]
-	blueMatch := matches[2]
+	var redMatch, blueMatch string
+	if matches := whiteBalanceNumber.FindStringSubmatch(input); matches != nil {
+		redMatch, blueMatch = matches[1], matches[2]
+	} else {
+		for _, m := range whiteBalanceChannel.FindAllStringSubmatch(input, -1) {
+			if strings.HasPrefix(strings.ToLower(m[1]), "r") {
+				redMatch = m[2]
+			} else {
+				blueMatch = m[2]
+			}
+		}
+	}
+
+	if redMatch == "" || blueMatch == "" {
+		return 0, 0, &ParseError{Tag: "WhiteBalanceFineTune", Value: input}
+	}
 
 	red, err := strconv.Atoi(redMatch)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, &ParseError{Tag: "WhiteBalanceFineTune", Value: input}
 	}
 	blue, err := strconv.Atoi(blueMatch)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, &ParseError{Tag: "WhiteBalanceFineTune", Value: input}
 	}
 
-	red = red / 20
-	blue = blue / 20
+	red = red / ExifWhiteBalanceScale
+	blue = blue / ExifWhiteBalanceScale
 	return red, blue, nil
 }
 
@@ -203,6 +555,50 @@ func ParseHighlightShadow(input string) (int, error) {
 	return value, nil
 }
 
+// parseTone parses a tone or other adjustment, which converters write as a
+// bare number rather than e.g. "+1 (medium hard)".
+func parseTone(stringValue string, floatValue float64) (int, error) {
+	if stringValue == "" {
+		return int(floatValue), nil
+	}
+
+	return ParseHighlightShadow(stringValue)
+}
+
+// IsMonochrome reports whether a film simulation is black and white.
+func IsMonochrome(filmSimulation string) bool {
+	lower := strings.ToLower(filmSimulation)
+	return strings.Contains(lower, "acros") || strings.Contains(lower, "b&w") || strings.Contains(lower, "monochrome")
+}
+
+// ParseMonochromeFilter returns the color filter of a black and white film
+// simulation as reported in the Saturation tag, e.g. "Yellow" for "Acros
+// Yellow Filter".
+func ParseMonochromeFilter(input string) string {
+	for _, filter := range []string{"Yellow", "Red", "Green"} {
+		if strings.Contains(input, filter+" Filter") {
+			return filter
+		}
+	}
+
+	return "Off"
+}
+
+// ParseDRangePriority returns the dynamic range priority setting from the
+// DRangePriority tags: "Auto", or the strength it was fixed at.
+func ParseDRangePriority(fields map[string]interface{}) string {
+	priority := fmt.Sprintf("%v", fields["DRangePriority"])
+	if priority == "Auto" {
+		return "Auto"
+	}
+
+	if fixed, ok := fields["DRangePriorityFixed"].(string); ok && priority == "Fixed" {
+		return fixed
+	}
+
+	return "Off"
+}
+
 func ParseSharpness(input string) (int, error) {
 	switch input {
 	case "Softest":
@@ -228,191 +624,569 @@ func ParseSharpness(input string) (int, error) {
 	return 0, fmt.Errorf("wrong value for sharpness")
 }
 
-func GetRecipeFromFile(filename string) (Recipe, error) {
-	et, err := exiftool.NewExiftool()
+// Extractor reads camera settings from images.  It keeps its metadata
+// backend, e.g. an exiftool process, around, which makes it much cheaper than
+// Extract when going through many files.
+type Extractor struct {
+	backend MetadataBackend
+	// Force reads images of any camera as ones of a Fujifilm camera, rather
+	// than returning an *UnsupportedCameraError.
+	Force bool
+	// Lenient leaves out settings that can't be parsed, listing them in
+	// ExtractionResult.FieldErrors, rather than failing with FieldErrors.
+	Lenient bool
+}
+
+// Logger receives the messages of the library that aren't returned as errors.
+// They are discarded unless it's replaced, e.g. with slog.Default().
+var Logger = slog.New(slog.DiscardHandler)
+
+// NewExtractor starts an Extractor using DefaultBackend.
+func NewExtractor() (*Extractor, error) {
+	backend, err := OpenBackend(DefaultBackend)
 	if err != nil {
-		fmt.Printf("Error when intializing: %v", err)
-		return Recipe{}, err
+		return nil, err
 	}
-	defer et.Close()
 
-	fileInfos := et.ExtractMetadata(filename)
+	return NewExtractorWithBackend(backend), nil
+}
 
-	recipe := Recipe{
-		DynamicRange: "Auto",
+func NewExtractorWithBackend(backend MetadataBackend) *Extractor {
+	return &Extractor{backend: backend}
+}
+
+func (e *Extractor) Close() error {
+	if closer, ok := e.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// Extract reads the camera settings of an image.
+func Extract(filename string) (ExtractionResult, error) {
+	e, err := NewExtractor()
+	if err != nil {
+		Logger.Debug("Starting the metadata backend failed", "backend", DefaultBackend, "err", err)
+		return ExtractionResult{}, err
 	}
+	defer e.Close()
 
-	for _, fileInfo := range fileInfos {
-		if fileInfo.Err != nil {
-			fmt.Printf("Error concerning %v: %v", fileInfo.File, fileInfo.Err)
+	return e.Extract(filename)
+}
+
+// UnsupportedCameraError is returned for images of a camera no Dialect
+// matches, unless the Extractor is forced to read them.
+type UnsupportedCameraError struct {
+	Make  string
+	Model string
+}
+
+func (e *UnsupportedCameraError) Error() string {
+	return fmt.Sprintf("The image was taken with a %s, which isn't a Fujifilm camera or another one filmdetect knows.", cameraName(e.Make, e.Model))
+}
+
+// Extract reads the camera settings of an image with the extractor.  Images
+// of unsupported cameras are an *UnsupportedCameraError, unless Force is set.
+// Movies, see IsVideo, are read like images, leaving out the settings they
+// don't have.
+func (e *Extractor) Extract(filename string) (ExtractionResult, error) {
+	fields, err := e.backend.Extract(filename)
+	if err != nil {
+		return ExtractionResult{}, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	result := ExtractionResult{RawFields: rawFields(fields)}
+
+	for k, v := range fields {
+		// Keyword lists, including the ones written by WriteKeywords
+		if k == "Subject" || k == "HierarchicalSubject" || k == "Keywords" {
 			continue
 		}
+		stringValue, floatValue, err := tagValue(v)
+		if err != nil {
+			return ExtractionResult{}, err
+		}
 
-		for k, v := range fileInfo.Fields {
-			if k == "Subject" {
-				continue
-			}
-			stringValue := ""
-			floatValue := 0.0
-
-			switch value := v.(type) {
-			case string:
-				stringValue = value
-			case float64:
-				floatValue = value
-			default:
-				return Recipe{}, errors.New("Field value isn't string of float.")
-			}
+		if k == CustomSlotTag {
+			result.CustomSlot = ParseCustomSlot(stringValue, floatValue)
+		}
 
-			if k == "FilmMode" {
-				recipe.FilmSimulation = stringValue
-			}
+		if k == "Make" {
+			result.Make = stringValue
+		}
 
-			if k == "GrainEffectRoughness" {
-				recipe.GrainEffectRoughness = stringValue
-			}
+		if k == "Model" {
+			result.Model = stringValue
+		}
 
-			if k == "ColorChromeEffect" {
-				recipe.ColorChromeEffect = stringValue
-			}
+		if k == "DateTimeOriginal" {
+			result.CaptureTime = ParseExifTime(stringValue)
+		}
 
-			if k == "ColorChromeFXBlue" {
-				recipe.ColorChromeFXBlue = stringValue
-			}
+		if k == "ISO" {
+			result.ISO = int(floatValue)
+		}
 
-			if k == "WhiteBalance" {
-				recipe.WhiteBalanceMode = stringValue
-			}
+		if k == "LensModel" {
+			result.Lens = stringValue
+		}
 
-			if k == "WhiteBalanceFineTune" {
-				red, blue, err := ParseWhiteBalanceOffset(stringValue)
-				if err != nil {
-					return recipe, err
-				}
+		if k == "Software" {
+			result.RAWConverter = RAWConverter(stringValue)
+		}
 
-				recipe.WhiteBalanceRed = red
-				recipe.WhiteBalanceBlue = blue
+		if k == "ExposureTime" {
+			if stringValue == "" {
+				result.ShutterSpeed = strconv.FormatFloat(floatValue, 'f', -1, 64)
+			} else {
+				result.ShutterSpeed = stringValue
 			}
+		}
 
-			if k == "DevelopmentDynamicRange" {
-				dyn := strconv.FormatFloat(floatValue, 'f', 0, 64)
-				recipe.DynamicRange = dyn
-			}
+		if k == "FNumber" {
+			result.Aperture = floatValue
+		}
 
-			if k == "HighlightTone" {
-				high, err := ParseHighlightShadow(stringValue)
+		if k == "ExposureCompensation" {
+			if stringValue == "" {
+				result.ExposureCompensation = floatValue
+			} else {
+				ec, err := ParseExposureCompensation(stringValue)
 				if err != nil {
-					return Recipe{}, err
+					return ExtractionResult{}, err
 				}
+				result.ExposureCompensation = ec
+			}
+		}
+
+	}
 
-				recipe.Highlights = high
+	// Without a make, e.g. in an export that lost it, the maker notes decide
+	if !e.Force && result.Make != "" && !SupportedCamera(result.Make, result.Model) {
+		return result, &UnsupportedCameraError{Make: result.Make, Model: result.Model}
+	}
+
+	// The camera is known even without the settings, e.g. for
+	// ErrNoFujiMetadata
+	result.Recipe, err = DialectFor(result.Make, result.Model).Extract(fields)
+	if IsVideo(filename) {
+		result.Video = true
+		result.Recipe = videoRecipe(result.Recipe)
+	}
+	var fieldErrors FieldErrors
+	if e.Lenient && errors.As(err, &fieldErrors) {
+		result.FieldErrors = fieldErrors
+		err = nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+
+}
+
+// rawFieldExcluded are tags that describe the file rather than the image, or
+// that filmdetect writes itself.
+var rawFieldExcluded = map[string]bool{
+	"SourceFile":          true,
+	"ExifToolVersion":     true,
+	"FileName":            true,
+	"Directory":           true,
+	"FileSize":            true,
+	"FileModifyDate":      true,
+	"FileAccessDate":      true,
+	"FileInodeChangeDate": true,
+	"FilePermissions":     true,
+	"Subject":             true,
+	"HierarchicalSubject": true,
+	"Keywords":            true,
+}
+
+// rawFields returns the tags of an image worth showing to a user, leaving out
+// the rawFieldExcluded ones and binary data, which exiftool prints as e.g.
+// "(Binary data 8469 bytes, use -b option to extract)".
+func rawFields(fields map[string]any) map[string]any {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	raw := make(map[string]any, len(fields))
+	for k, v := range fields {
+		if rawFieldExcluded[k] {
+			continue
+		}
+		if s, ok := v.(string); ok && strings.HasPrefix(s, "(Binary data") {
+			continue
+		}
+		raw[k] = v
+	}
+
+	return raw
+}
+
+// tagValue returns the value of a tag as exiftool prints it, which is either
+// a string or a number.
+func tagValue(v any) (string, float64, error) {
+	switch value := v.(type) {
+	case string:
+		return value, 0, nil
+	case float64:
+		return "", value, nil
+	}
+
+	return "", 0, errors.New("Field value isn't string of float.")
+}
+
+// ErrNoFujiMetadata is returned when an image doesn't have the maker notes
+// the settings of Fujifilm cameras are read from.
+var ErrNoFujiMetadata = errors.New("The image has no Fujifilm maker notes, so its recipe can't be told.  " +
+	"Services such as Instagram or WhatsApp remove them; try the original file from the camera.")
+
+// AutoDynamicRange is the dynamic range of a recipe that leaves it to the
+// camera.  Images record the range the camera chose, e.g. "200".
+const AutoDynamicRange = "Auto"
+
+// fujiMakerNoteTags are tags of Fujifilm's maker notes that every camera
+// records, whatever the film simulation.
+var fujiMakerNoteTags = []string{"FilmMode", "HighlightTone", "ShadowTone", "WhiteBalanceFineTune", "DevelopmentDynamicRange", "DynamicRangeSetting", "FujiFlashMode"}
+
+// extractFujifilm reads a film simulation recipe from the tags of Fujifilm's
+// maker notes.  Images without them are an ErrNoFujiMetadata.  Settings that
+// can't be parsed are returned as FieldErrors, along with the recipe of the
+// others.
+func extractFujifilm(fields map[string]any) (Recipe, error) {
+	fields = withTagVariants(fields)
+	if !slices.ContainsFunc(fujiMakerNoteTags, func(tag string) bool { return fields[tag] != nil }) {
+		return Recipe{}, ErrNoFujiMetadata
+	}
+
+	recipe := Recipe{
+		DynamicRange:     AutoDynamicRange,
+		DRangePriority:   "Off",
+		SmoothSkinEffect: "Off",
+	}
+
+	// Settings that don't parse are left unset, so that the others can
+	// still be compared if the caller is lenient
+	var failed FieldErrors
+	fail := func(tag string, value any, err error, fields ...string) {
+		failed = append(failed, FieldError{Tag: tag, Value: fmt.Sprintf("%v", value), Fields: fields, Err: err})
+		recipe.Unset = append(recipe.Unset, fields...)
+	}
+
+	for k, v := range fields {
+		if k == "Subject" || k == "HierarchicalSubject" || k == "Keywords" {
+			continue
+		}
+		stringValue, floatValue, err := tagValue(v)
+		if err != nil {
+			return Recipe{}, err
+		}
+
+		if k == "FilmMode" {
+			recipe.FilmSimulation = NormalizeFilmSimulation(stringValue)
+		}
+
+		if k == "GrainEffectRoughness" {
+			recipe.GrainEffectRoughness = stringValue
+		}
+
+		if k == "ColorChromeEffect" {
+			recipe.ColorChromeEffect = stringValue
+		}
+
+		if k == "ColorChromeFXBlue" {
+			recipe.ColorChromeFXBlue = stringValue
+		}
+
+		if k == "SmoothSkinEffect" {
+			recipe.SmoothSkinEffect = NormalizeValue("SmoothSkinEffect", stringValue)
+		}
+
+		if k == "WhiteBalance" {
+			recipe.WhiteBalanceMode = stringValue
+		}
+
+		if k == "WhiteBalanceFineTune" {
+			red, blue, err := ParseWhiteBalanceOffset(stringValue)
+			if err != nil {
+				fail(k, v, err, "WhiteBalanceRed", "WhiteBalanceBlue")
 			}
 
-			if k == "ShadowTone" {
-				shadow, err := ParseHighlightShadow(stringValue)
-				if err != nil {
-					return Recipe{}, err
-				}
+			recipe.WhiteBalanceRed = red
+			recipe.WhiteBalanceBlue = blue
+		}
+
+		if k == "DRangePriority" {
+			recipe.DRangePriority = ParseDRangePriority(fields)
+		}
+
+		if k == "DevelopmentDynamicRange" {
+			dyn := strconv.FormatFloat(floatValue, 'f', 0, 64)
+			recipe.DynamicRange = dyn
+		}
 
-				recipe.Shadows = shadow
+		if k == "HighlightTone" {
+			high, err := parseTone(stringValue, floatValue)
+			if err != nil {
+				fail(k, v, err, "Highlights")
 			}
 
-			if k == "Saturation" {
-				if strings.Contains(stringValue, "Acros") {
-					recipe.Color = 0
-					recipe.FilmSimulation = stringValue
-				} else {
-					color, err := ParseHighlightShadow(stringValue)
-					if err != nil {
-						return Recipe{}, err
-					}
-					recipe.Color = color
-				}
+			recipe.Highlights = high
+		}
+
+		if k == "ShadowTone" {
+			shadow, err := parseTone(stringValue, floatValue)
+			if err != nil {
+				fail(k, v, err, "Shadows")
 			}
 
-			if k == "Sharpness" {
+			recipe.Shadows = shadow
+		}
 
-				sharpness, err := ParseSharpness(stringValue)
+		if k == "Saturation" {
+			if IsMonochrome(stringValue) {
+				recipe.Color = 0
+				recipe.FilmSimulation, recipe.MonochromeFilter = SplitMonochromeFilter(stringValue)
+				if recipe.MonochromeFilter == "" {
+					recipe.MonochromeFilter = "Off"
+				}
+			} else {
+				color, err := parseTone(stringValue, floatValue)
 				if err != nil {
-					return recipe, err
+					fail(k, v, err, "Color")
 				}
-
-				recipe.Sharpness = sharpness
+				recipe.Color = color
 			}
+		}
 
-			if k == "NoiseReduction" {
-				noise, err := ParseHighlightShadow(stringValue)
-				if err != nil {
-					return recipe, err
-				}
+		if k == "Sharpness" {
 
-				recipe.NoiseReduction = noise
+			sharpness, err := ParseSharpness(stringValue)
+			if err != nil {
+				fail(k, v, err, "Sharpness")
 			}
 
-			if k == "Clarity" {
-				recipe.Clarity = int(floatValue)
-			}
+			recipe.Sharpness = sharpness
+		}
 
-			if k == "GrainEffectSize" {
-				recipe.GrainEffectSize = stringValue
+		if k == "NoiseReduction" {
+			noise, err := parseTone(stringValue, floatValue)
+			if err != nil {
+				fail(k, v, err, "NoiseReduction")
 			}
 
+			recipe.NoiseReduction = noise
+		}
+
+		if k == "Clarity" {
+			recipe.Clarity = int(floatValue)
+		}
+
+		if k == "BWAdjustment" {
+			recipe.ToningWarmCool = int(floatValue)
 		}
+
+		if k == "BWMagentaGreen" {
+			recipe.ToningMagentaGreen = int(floatValue)
+		}
+
+		if k == "GrainEffectSize" {
+			recipe.GrainEffectSize = stringValue
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Tag < failed[j].Tag })
+		return recipe, failed
 	}
 
 	return recipe, nil
+}
+
+// The exiftool tag holding the custom setting bank on bodies that record it.
+const CustomSlotTag = "CustomSettingBank"
+
+// ParseCustomSlot turns the custom setting bank tag into "C1" through "C7".
+// exiftool reports it either as a bare number or as a string.
+func ParseCustomSlot(stringValue string, floatValue float64) string {
+	if stringValue == "" {
+		if floatValue <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("C%d", int(floatValue))
+	}
+
+	if _, err := strconv.Atoi(stringValue); err == nil {
+		return "C" + stringValue
+	}
+
+	return strings.ToUpper(stringValue)
+}
+
+// ParseExifTime parses an EXIF timestamp, ignoring any sub-second or time zone
+// suffix.  The zero time is returned when the value can't be parsed.
+func ParseExifTime(input string) time.Time {
+	const layout = "2006:01:02 15:04:05"
+
+	if len(input) > len(layout) {
+		input = input[:len(layout)]
+	}
 
+	t, err := time.Parse(layout, input)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func GetRecipeFromFile(filename string) (Recipe, error) {
+	result, err := Extract(filename)
+	if err != nil {
+		return Recipe{}, err
+	}
+
+	return result.Recipe, nil
 }
 
 type Difference struct {
 	Input     Recipe
 	Candidate Recipe
-	Lines     [][]string
+	// Set by detection, see RateConfidence
+	Confidence Confidence
+	score      float64
+	fields     []FieldDiff
+	mismatches []FieldDiff
 }
 
 func DifferenceFromRecipes(input, candidate Recipe) Difference {
+	return DifferenceWithScorer(input, candidate, DefaultScorer)
+}
+
+// DifferenceWithScorer compares the candidate to the input using scorer.
+// Both recipes are normalized first.  The differing fields are ordered by
+// importance.
+func DifferenceWithScorer(input, candidate Recipe, scorer Scorer) Difference {
+	return difference(NormalizeRecipe(input), NormalizeRecipe(candidate), scorer)
+}
+
+// difference is DifferenceWithScorer for recipes that are normalized
+// already.
+func difference(input, candidate Recipe, scorer Scorer) Difference {
 	d := Difference{Input: input, Candidate: candidate}
-	d.Lines = d.GetLines()
+	d.score, d.mismatches = scorer.Score(d.Input, d.Candidate)
+	sort.SliceStable(d.mismatches, func(i, j int) bool {
+		return FieldWeight(d.mismatches[i].Field) > FieldWeight(d.mismatches[j].Field)
+	})
+
+	// The scorer decides what differs, which may not be every unequal value
+	mismatched := map[string]FieldDiff{}
+	for _, field := range d.mismatches {
+		mismatched[field.Field] = field
+	}
+	for _, field := range CompareAllFields(d.Input, d.Candidate) {
+		if mismatch, ok := mismatched[field.Field]; ok {
+			field = mismatch
+		} else {
+			field.Matched = true
+		}
+		d.fields = append(d.fields, field)
+	}
+
 	return d
 }
 
-func (d Difference) IsFullScore() bool {
-	return len(d.Lines) == 0
+// Fields returns every compared setting in the order of Recipe, with whether
+// it matched.
+func (d Difference) Fields() []FieldDiff {
+	return d.fields
 }
 
-func (d Difference) Score() int {
-	return FullScore - len(d.Lines)
+// Mismatches returns the differing settings, the most important first.
+func (d Difference) Mismatches() []FieldDiff {
+	return d.mismatches
 }
 
-func (d Difference) AsList() []string {
-	return []string{"White balance", "1", "2"}
+// CriticalFields returns the differing settings that weigh at least
+// CriticalWeight.
+func (d Difference) CriticalFields() []FieldDiff {
+	fields := []FieldDiff{}
+	for _, field := range d.mismatches {
+		if IsCriticalField(field.Field) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
 }
-func (d Difference) GetLines() [][]string {
-	vInput := reflect.ValueOf(d.Input)
-	vCandidate := reflect.ValueOf(d.Candidate)
 
-	typeOfvInput := vInput.Type()
-	// typeOfvCandidate := vCandidate.Type()
+// MinorFields returns the differing settings that aren't critical.
+func (d Difference) MinorFields() []FieldDiff {
+	fields := []FieldDiff{}
+	for _, field := range d.mismatches {
+		if !IsCriticalField(field.Field) {
+			fields = append(fields, field)
+		}
+	}
 
-	result := [][]string{}
-	for i := 0; i < vInput.NumField(); i++ {
-		fieldName := typeOfvInput.Field(i).Name
+	return fields
+}
 
-		if strings.Contains("Name Author Url", fieldName) {
-			continue
-		}
+func (d Difference) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Recipe     Recipe      `json:"recipe"`
+		Score      float64     `json:"score"`
+		Confidence Confidence  `json:"confidence"`
+		Critical   []FieldDiff `json:"critical"`
+		Minor      []FieldDiff `json:"minor"`
+		Fields     []FieldDiff `json:"fields"`
+		// Describes the candidate, but isn't compared
+		Meta map[string]any `json:"meta"`
+	}{
+		Recipe:     d.Candidate,
+		Score:      d.score,
+		Confidence: d.Confidence,
+		Critical:   d.CriticalFields(),
+		Minor:      d.MinorFields(),
+		Fields:     d.fields,
+		Meta:       RecipeMeta(d.Candidate),
+	})
+}
+
+func (d Difference) IsFullScore() bool {
+	return len(d.mismatches) == 0
+}
 
-		vInputValue := vInput.Field(i).Interface()
-		vCandidateValue := vCandidate.Field(i).Interface()
+// IsGoodMatch reports whether the candidate is close enough to the input to
+// plausibly be the recipe that was used.
+func (d Difference) IsGoodMatch() bool {
+	return len(d.mismatches) <= MaxMismatches
+}
+
+func (d Difference) Score() float64 {
+	return d.score
+}
+
+// GetLines returns the label, input value and candidate value of every
+// differing setting, with the white balance shift as one, along with how far
+// apart the shifts are.
+func (d Difference) GetLines() [][]string {
+	result := [][]string{}
 
-		if vInputValue != vCandidateValue {
-			result = append(result, []string{
-				fieldName,
-				fmt.Sprintf("%v", vInputValue),
-				fmt.Sprintf("%v", vCandidateValue),
-			})
+	for _, field := range d.GroupedMismatches() {
+		candidate := FormatValue(field.Field, field.Candidate)
+		if distance, ok := shiftDistance(field); ok {
+			candidate += fmt.Sprintf(", distance %.1f", distance)
 		}
 
+		result = append(result, []string{
+			FieldLabel(field.Field),
+			FormatValue(field.Field, field.Input),
+			candidate,
+		})
 	}
 
 	return result
@@ -423,83 +1197,211 @@ func (d Difference) String() string {
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
 	table.SetAutoFormatHeaders(false)
-	table.SetHeader([]string{d.Candidate.Name, "Input", "Candidate"})
-	table.AppendBulk(d.Lines)
+	table.SetAutoMergeCellsByColumnIndex([]int{0})
+	table.SetHeader([]string{"", d.Candidate.FullName(), "Input", "Candidate"})
+	mismatches := d.GroupedMismatches()
+	for i, line := range d.GetLines() {
+		group := "Minor"
+		if IsCriticalField(mismatches[i].Field) {
+			group = "Critical"
+		}
+		table.Append(append([]string{group}, line...))
+	}
 	table.Render()
 	return tableString.String()
 }
 
 func DetectFromRecipes(recipes []Recipe, recipe Recipe) ([]Difference, bool, error) {
+	return DetectFromRecipesWithOptions(recipes, recipe, Options{})
+}
+
+// DetectFromRecipesWithOptions compares the recipe to the candidates, and
+// returns either the perfect match, or all candidates that share the top
+// score.  It stops at the first perfect match, whose Confidence is then rated
+// against the candidates compared before it.  With opts.Top, every candidate
+// is compared, and the Top closest are returned.
+func DetectFromRecipesWithOptions(recipes []Recipe, recipe Recipe, opts Options) ([]Difference, bool, error) {
+	return detectFromRecipes(recipes, recipe, opts, false)
+}
+
+// detectFromRecipes is DetectFromRecipesWithOptions, for candidates that are
+// prepared for opts.Camera already if prepared is set.
+func detectFromRecipes(recipes []Recipe, recipe Recipe, opts Options, prepared bool) ([]Difference, bool, error) {
 	resultDifferences := []Difference{}
 
+	recipe, err := opts.override(recipe)
+	if err != nil {
+		return resultDifferences, false, err
+	}
+
+	if opts.Top > 0 {
+		ranked := rankRecipes(recipes, recipe, opts, prepared)
+		perfect := len(ranked) > 0 && ranked[0].IsFullScore()
+		return ranked[:min(opts.Top, len(ranked))], perfect, nil
+	}
+
+	differences := compareCandidates(recipes, recipe, opts, prepared, Difference.IsFullScore)
+	for _, diff := range rankDifferences(differences) {
+		if diff.IsFullScore() {
+			return []Difference{diff}, true, nil
+		}
+
+		if len(resultDifferences) > 0 && resultDifferences[0].Score() > diff.Score() {
+			break
+		}
+
+		resultDifferences = append(resultDifferences, diff)
+	}
+
+	return resultDifferences, false, nil
+}
+
+// RankRecipes compares the recipe, with the Overrides of opts, to all
+// candidates, and returns all of them from the closest to the farthest.  The
+// candidates sharing the top score are rated with a Confidence.
+func RankRecipes(recipes []Recipe, recipe Recipe, opts Options) []Difference {
+	return rankRecipes(recipes, recipe, opts, false)
+}
+
+// rankRecipes is RankRecipes, for candidates that are prepared for
+// opts.Camera already if prepared is set.
+func rankRecipes(recipes []Recipe, recipe Recipe, opts Options, prepared bool) []Difference {
+	// DetectFromRecipesWithOptions returns the error
+	if overridden, err := opts.override(recipe); err == nil {
+		recipe = overridden
+	} else {
+		Logger.Warn("Ignoring overrides", "err", err)
+	}
+
+	return rankDifferences(compareCandidates(recipes, recipe, opts, prepared, nil))
+}
+
+// prepareCandidate returns a recipe the way it's compared to the images of a
+// camera model: set up for the camera, see ForCamera, and normalized.
+func prepareCandidate(recipe Recipe, camera string) Recipe {
+	if camera != "" {
+		recipe = recipe.ForCamera(camera)
+	}
+
+	return NormalizeRecipe(recipe)
+}
+
+// compareCandidates compares the recipe to the candidates of its dialect, in
+// order, until stop, if given, is true of a Difference.  Unless prepared is
+// set, every candidate is prepared for opts.Camera first.
+func compareCandidates(recipes []Recipe, recipe Recipe, opts Options, prepared bool, stop func(Difference) bool) []Difference {
 	differences := []Difference{}
 
-	for _, candidate := range recipes {
-		differences = append(differences, DifferenceFromRecipes(recipe, candidate))
+	recipe = NormalizeRecipe(recipe)
+	scorer := opts.scorer()
+	for i, candidate := range recipes {
+		if candidate.DialectName() != recipe.DialectName() {
+			continue
+		}
+		if !prepared {
+			candidate = prepareCandidate(candidate, opts.Camera)
+		}
+		diff := difference(recipe, candidate, scorer)
+		differences = append(differences, diff)
+		opts.emit(Event{Kind: CandidateCompared, Index: i + 1, Total: len(recipes), Candidate: candidate.FullName()})
+
+		if stop != nil && stop(diff) {
+			break
+		}
 	}
 
-	sort.Slice(differences, func(i, j int) bool {
+	return differences
+}
+
+// rankDifferences sorts differences from the closest to the farthest, and
+// rates the ones sharing the top score with a Confidence.
+func rankDifferences(differences []Difference) []Difference {
+	sort.SliceStable(differences, func(i, j int) bool {
 		return differences[i].Score() > differences[j].Score()
 	})
 
-	topScore := 0
-
-	for _, diff := range differences {
-		if diff.IsFullScore() {
-			return []Difference{diff}, true, nil
+	if len(differences) > 0 {
+		var runnerUp *Difference
+		if len(differences) > 1 {
+			runnerUp = &differences[1]
 		}
+		confidence := RateConfidence(differences[0], runnerUp)
 
-		if topScore != 0 {
-			if topScore > diff.Score() {
-				break
+		for i := range differences {
+			if differences[i].Score() == differences[0].Score() {
+				differences[i].Confidence = confidence
 			}
-			resultDifferences = append(resultDifferences, diff)
-			continue
 		}
+	}
 
-		if topScore == 0 {
-			topScore = diff.Score()
-			resultDifferences = append(resultDifferences, diff)
-		}
+	return differences
+}
 
+// TiedDifferences returns the leading differences of ranked, as returned by
+// RankRecipes, that share the top score.
+func TiedDifferences(ranked []Difference) []Difference {
+	for i := range ranked {
+		if ranked[i].Score() != ranked[0].Score() {
+			return ranked[:i]
+		}
 	}
 
-	return resultDifferences, false, nil
+	return ranked
 }
 
 // Detect is the main library function. It returns a list of differences, and
 // the bool in the return means "were we able to find a perfect match?"
 func Detect(simulationDir string, filename string) ([]Difference, bool, error) {
+	return DetectWithOptions(simulationDir, filename, Options{})
+}
+
+func DetectWithOptions(simulationDir string, filename string, opts Options) ([]Difference, bool, error) {
 	allRecipes, err := GetRecipes(simulationDir)
 	if err != nil {
 		return []Difference{}, false, err
 	}
+	opts.emit(Event{Kind: RecipesLoaded, Recipes: len(allRecipes)})
+	opts = opts.forFile(filename)
 
-	recipe, err := GetRecipeFromFile(filename)
+	extraction, err := opts.extract(filename)
 	if err != nil {
 		return []Difference{}, false, err
 	}
 
-	return DetectFromRecipes(allRecipes, recipe)
+	if opts.Camera == "" {
+		opts.Camera = extraction.Model
+	}
+
+	return DetectFromRecipesWithOptions(allRecipes, extraction.Recipe, opts)
 
 }
 
-// CLI
-func Run(simulationDir string, filename string) {
-	diffs, havePerfectMatch, err := Detect(simulationDir, filename)
+// CompareImageToRecipe compares an image with a single recipe file, as the
+// recipe is set up on the camera that took the image.  The image was shot with
+// the recipe if the Difference IsFullScore.
+func CompareImageToRecipe(imagePath, recipePath string) (Difference, error) {
+	return CompareImageToRecipeWithOptions(imagePath, recipePath, Options{})
+}
+
+func CompareImageToRecipeWithOptions(imagePath, recipePath string, opts Options) (Difference, error) {
+	recipe, err := ParseRecipeFile(recipePath)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return Difference{}, err
 	}
 
-	if havePerfectMatch {
-		fmt.Println(diffs[0].Candidate.Name)
-		return
+	extraction, err := opts.extract(imagePath)
+	if err != nil {
+		return Difference{}, err
 	}
 
-	fmt.Println("We were not able to find a perfect match.  These recipes are the closest:")
+	if opts.Camera == "" {
+		opts.Camera = extraction.Model
+	}
 
-	for _, diff := range diffs {
-		fmt.Println(diff)
+	image, err := opts.override(extraction.Recipe)
+	if err != nil {
+		return Difference{}, err
 	}
+
+	return DifferenceWithScorer(image, recipe.ForCamera(opts.Camera), opts.scorer()), nil
 }
@@ -0,0 +1,97 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// RecipeMatch is a recipe found by FindRecipes, with how many of the
+// constraints it satisfies.
+type RecipeMatch struct {
+	Recipe      Recipe      `json:"recipe"`
+	Satisfied   int         `json:"satisfied"`
+	Constraints int         `json:"constraints"`
+	Score       float64     `json:"score"`
+	Mismatches  []FieldDiff `json:"mismatches"`
+}
+
+// FindRecipes searches recipes for the ones with the given settings, by
+// field name as RecipeFieldName takes them, e.g. "film_simulation": "Classic
+// Negative".  It's detection with an input that only has those settings.
+// Recipes satisfying the most constraints come first, then the ones with the
+// best score, and recipes satisfying none are left out.  A recipe that leaves
+// a setting out doesn't satisfy a constraint on it.
+func FindRecipes(recipes []Recipe, constraints map[string]string) ([]RecipeMatch, error) {
+	if len(constraints) == 0 {
+		return nil, fmt.Errorf("No settings to search for")
+	}
+
+	input := Recipe{Unset: ScoringFields()}
+	for name, value := range constraints {
+		field, err := RecipeFieldName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ScoringFields(), field) {
+			return nil, fmt.Errorf("%s isn't a setting that can be searched for", field)
+		}
+		if err := SetField(&input, field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []RecipeMatch
+	for _, candidate := range recipes {
+		if candidate.DialectName() != input.DialectName() {
+			continue
+		}
+
+		diff := DifferenceFromRecipes(input, candidate)
+		satisfied := 0
+		for _, field := range diff.Fields() {
+			if field.Matched {
+				satisfied++
+			}
+		}
+		if satisfied == 0 {
+			continue
+		}
+
+		matches = append(matches, RecipeMatch{
+			Recipe:      diff.Candidate,
+			Satisfied:   satisfied,
+			Constraints: len(constraints),
+			Score:       diff.Score(),
+			Mismatches:  diff.Mismatches(),
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Satisfied != matches[j].Satisfied {
+			return matches[i].Satisfied > matches[j].Satisfied
+		}
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Recipe.FullName() < matches[j].Recipe.FullName()
+	})
+
+	return matches, nil
+}
@@ -0,0 +1,105 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The parent keyword of recipe names in hierarchical subjects, e.g.
+// "Recipe|Kodachrome 64".
+var KeywordPrefix = "Recipe"
+
+// SidecarPath returns the XMP sidecar of an image.  darktable and digiKam
+// name it after the full filename, e.g. "DSCF0001.JPG.xmp".
+func SidecarPath(filename string) string {
+	return filename + ".xmp"
+}
+
+// WriteKeywords adds the recipe name to the keywords and hierarchical
+// subjects of an image, or of its XMP sidecar, so that photo managers can
+// build collections per recipe.  Running it again doesn't duplicate keywords.
+func WriteKeywords(filename string, recipeName string, sidecar bool) error {
+	tags := [][]string{
+		{"XMP-dc:Subject", recipeName},
+		{"XMP-lr:HierarchicalSubject", KeywordPrefix + "|" + recipeName},
+	}
+
+	target := filename
+	if sidecar {
+		target = SidecarPath(filename)
+	} else {
+		tags = append(tags, []string{"IPTC:Keywords", recipeName})
+	}
+
+	args := []string{"-overwrite_original"}
+	for _, tag := range tags {
+		// Removing the value first keeps it from being added twice
+		args = append(args, fmt.Sprintf("-%s-=%s", tag[0], tag[1]), fmt.Sprintf("-%s+=%s", tag[0], tag[1]))
+	}
+	args = append(args, target)
+
+	return runExiftool(args...)
+}
+
+// The tags WriteComment can write to, with the group exiftool writes them in
+var CommentTags = map[string]string{
+	"UserComment":      "EXIF:UserComment",
+	"ImageDescription": "EXIF:ImageDescription",
+	"XPComment":        "EXIF:XPComment",
+}
+
+// RecipeComment describes a recipe in one line, with its author and source.
+func RecipeComment(recipe Recipe) string {
+	comment := KeywordPrefix + ": " + recipe.FullName()
+	if recipe.Author != "" {
+		comment += " by " + recipe.Author
+	}
+	if recipe.Url != "" {
+		comment += " (" + recipe.Url + ")"
+	}
+
+	return comment
+}
+
+// WriteComment replaces the given comment tags of an image (see CommentTags)
+// with the description of a recipe, so that it travels with the file when it's
+// exported or shared.
+func WriteComment(filename string, recipe Recipe, tags []string) error {
+	args := []string{"-overwrite_original"}
+	for _, tag := range tags {
+		name, ok := CommentTags[tag]
+		if !ok {
+			return fmt.Errorf("Can't write the recipe to '%s'", tag)
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", name, RecipeComment(recipe)))
+	}
+	args = append(args, filename)
+
+	return runExiftool(args...)
+}
+
+func runExiftool(args ...string) error {
+	out, err := exec.Command("exiftool", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Running exiftool failed: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// SimulationGenerations holds the sensor generation that introduced a film
+// simulation.  Simulations that aren't listed are on every camera.
+var SimulationGenerations = map[string]string{
+	"Classic Chrome":   "X-Trans II",
+	"Acros":            "X-Trans III",
+	"Eterna":           "X-Trans III",
+	"Classic Negative": "X-Trans IV",
+	"Bleach Bypass":    "X-Trans IV",
+	"Nostalgic Neg":    "X-Trans V",
+	"Reala ACE":        "X-Trans V",
+}
+
+// LintIssue is a setting of a recipe that no camera would record.
+type LintIssue struct {
+	Recipe string `json:"recipe"`
+	// The cameras of the variant the issue is in, if it's in one
+	Variant string `json:"variant,omitempty"`
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	if i.Variant != "" {
+		return fmt.Sprintf("%s (%s): %s: %s", i.Recipe, i.Variant, i.Field, i.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", i.Recipe, i.Field, i.Message)
+}
+
+// LintRecipe checks the settings of a recipe, and of its variants, against
+// the values Fujifilm cameras record, or the cameras of its dialect.  Variants are also checked against the
+// film simulations and settings of the generations they are for.
+func LintRecipe(r Recipe) []LintIssue {
+	if d, ok := r.dialect().(SettingsDialect); ok {
+		return d.lint(r, "")
+	}
+
+	issues := lintSettings(r, "")
+
+	for _, variant := range r.Variants {
+		name := strings.Join(variant.Cameras, ", ")
+
+		applied, err := variant.apply(r)
+		if err != nil {
+			issues = append(issues, LintIssue{Recipe: r.Name, Variant: name, Message: err.Error()})
+			continue
+		}
+
+		// The rest of the settings are the recipe's, which were checked
+		// already
+		for _, issue := range lintSettings(applied, name) {
+			for key := range variant.Settings {
+				if field, err := RecipeFieldName(key); err == nil && field == issue.Field {
+					issues = append(issues, issue)
+				}
+			}
+		}
+		for _, camera := range variant.Cameras {
+			issues = append(issues, lintCamera(applied, name, camera)...)
+		}
+	}
+
+	return issues
+}
+
+// lintSettings checks every setting of r against EnumValues and IntRanges.
+func lintSettings(r Recipe, variant string) []LintIssue {
+	var issues []LintIssue
+	v := reflect.ValueOf(r)
+
+	for _, field := range ScoringFields() {
+		if r.IsUnset(field) {
+			continue
+		}
+
+		value := v.FieldByName(field)
+
+		if values, ok := EnumValues[field]; ok {
+			normalized := NormalizeValue(field, value.String())
+			if normalized == "" {
+				issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: field,
+					Message: "isn't set"})
+			} else if !slices.Contains(values, normalized) {
+				issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: field, Value: value.String(),
+					Message: fmt.Sprintf("'%s' isn't a value any camera records, expected one of %s", value.String(), strings.Join(values, ", "))})
+			}
+			continue
+		}
+
+		if limits, ok := IntRanges[field]; ok {
+			i := int(value.Int())
+			if i < limits[0] || i > limits[1] {
+				issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: field, Value: fmt.Sprintf("%d", i),
+					Message: fmt.Sprintf("%d is outside of %d..%d", i, limits[0], limits[1])})
+			}
+		}
+	}
+
+	return issues
+}
+
+// missingMessage explains why a camera doesn't have a film simulation or
+// setting introduced with a sensor generation.
+func missingMessage(capabilities CameraCapabilities, camera, name, introduced string) string {
+	if slices.Index(Generations, capabilities.Generation) < slices.Index(Generations, introduced) {
+		return fmt.Sprintf("%s doesn't have %s, it came with %s", camera, name, introduced)
+	}
+
+	return fmt.Sprintf("%s doesn't have %s", camera, name)
+}
+
+// lintCamera checks r for film simulations and settings a camera model or
+// sensor generation doesn't have.
+func lintCamera(r Recipe, variant, camera string) []LintIssue {
+	var issues []LintIssue
+
+	capabilities := Capabilities(camera)
+	if capabilities.Generation == "" {
+		return issues
+	}
+
+	simulation := NormalizeValue("FilmSimulation", r.FilmSimulation)
+	if slices.Contains(EnumValues["FilmSimulation"], simulation) && !capabilities.HasSimulation(simulation) {
+		issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: "FilmSimulation", Value: r.FilmSimulation,
+			Message: missingMessage(capabilities, camera, simulation, SimulationGenerations[simulation])})
+	}
+
+	v := reflect.ValueOf(r)
+	for _, field := range ScoringFields() {
+		if capabilities.HasField(field) {
+			continue
+		}
+
+		// The camera records the default for settings it doesn't have
+		value := v.FieldByName(field)
+		if values, ok := EnumValues[field]; ok {
+			if NormalizeValue(field, value.String()) == values[0] {
+				continue
+			}
+		} else if value.IsZero() {
+			continue
+		}
+
+		issues = append(issues, LintIssue{Recipe: r.Name, Variant: variant, Field: field, Value: fmt.Sprintf("%v", value.Interface()),
+			Message: missingMessage(capabilities, camera, field, FieldGenerations[field])})
+	}
+
+	slices.SortStableFunc(issues, func(a, b LintIssue) int { return strings.Compare(a.Field, b.Field) })
+	return issues
+}
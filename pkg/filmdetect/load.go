@@ -0,0 +1,287 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LoadPolicy decides what happens to the recipes when a recipe file can't be
+// read.
+type LoadPolicy int
+
+const (
+	// LoadStrict fails loading on the first broken file
+	LoadStrict LoadPolicy = iota
+	// LoadSkip leaves broken files out, and lists them in the LoadReport
+	LoadSkip
+	// LoadInteractive asks LoadOptions.Ask about every broken file
+	LoadInteractive
+)
+
+// LoadPolicies are the names of the policies, as ParseLoadPolicy takes them.
+var LoadPolicies = []string{"strict", "skip", "ask"}
+
+// ParseLoadPolicy parses "strict", "skip" or "ask".
+func ParseLoadPolicy(s string) (LoadPolicy, error) {
+	for i, name := range LoadPolicies {
+		if strings.EqualFold(s, name) {
+			return LoadPolicy(i), nil
+		}
+	}
+
+	return LoadStrict, fmt.Errorf("Unknown load policy '%s', expected one of: %s", s, strings.Join(LoadPolicies, ", "))
+}
+
+func (p LoadPolicy) String() string {
+	if int(p) < len(LoadPolicies) {
+		return LoadPolicies[p]
+	}
+	return fmt.Sprintf("LoadPolicy(%d)", int(p))
+}
+
+// LoadOptions configure GetRecipesWithOptions.
+type LoadOptions struct {
+	Policy LoadPolicy
+	// Decides whether a broken file is skipped under LoadInteractive.
+	// Returning false fails loading with err.  Without it, every broken
+	// file is skipped.
+	Ask func(file string, err error) bool
+	// What happens when recipes of several directories share a name, see
+	// GetRecipesFromDirsWithOptions
+	OnConflict ConflictPolicy
+}
+
+// SkippedFile is a recipe file that was left out, and why.
+type SkippedFile struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// LoadReport lists the recipe files left out while loading, and the recipes
+// that shared a name.
+type LoadReport struct {
+	Skipped   []SkippedFile    `json:"skipped"`
+	Conflicts []RecipeConflict `json:"conflicts,omitempty"`
+}
+
+// skip reports whether file, which couldn't be read, should be left out, and
+// records it in report if so.
+func (o LoadOptions) skip(report *LoadReport, file string, err error) bool {
+	switch o.Policy {
+	case LoadSkip:
+	case LoadInteractive:
+		if o.Ask != nil && !o.Ask(file, err) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	Logger.Warn("Skipped recipe file", "file", file, "err", err)
+	report.Skipped = append(report.Skipped, SkippedFile{
+		File:   file,
+		Reason: strings.TrimPrefix(err.Error(), file+": "),
+	})
+
+	return true
+}
+
+// LoadRecipes reads the recipes of simulationDir like GetRecipes, one file at
+// a time as the loop asks for them, so that a big collection isn't held in
+// memory and the loop can stop early, e.g. at a perfect match:
+//
+//	for recipe, err := range LoadRecipes(ctx, dir) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// A file that can't be read is yielded as an error, and the loop may carry on
+// with the next one.  Loading stops with ctx.Err() when ctx is done.
+// Archives are read whole before their first recipe.
+//
+// It's for programs using this package.  Detection ranks every recipe, so
+// the commands and Detector load them all with GetRecipesFromDirs instead.
+func LoadRecipes(ctx context.Context, simulationDir string) iter.Seq2[Recipe, error] {
+	return func(yield func(Recipe, error) bool) {
+		if IsRecipeArchive(simulationDir) {
+			recipes, err := GetRecipesFromArchive(simulationDir)
+			if err != nil {
+				yield(Recipe{}, err)
+				return
+			}
+			for _, recipe := range recipes {
+				if !yield(recipe, nil) {
+					return
+				}
+			}
+			return
+		}
+
+		files, err := GetRecipeFiles(simulationDir)
+		if err != nil {
+			yield(Recipe{}, err)
+			return
+		}
+
+		root := simulationRoot(simulationDir)
+		defaults := map[string]*Recipe{}
+
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				yield(Recipe{}, err)
+				return
+			}
+
+			recipes, err := readRecipesFile(root, file, defaults)
+			if err != nil {
+				if !yield(Recipe{}, err) {
+					return
+				}
+				continue
+			}
+
+			for _, recipe := range recipes {
+				if !yield(recipe, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ConflictPolicy decides what happens when recipes of several simulation
+// directories or collections share a name, but not their settings.
+type ConflictPolicy int
+
+const (
+	// ConflictKeepLast keeps the recipe of the later directory
+	ConflictKeepLast ConflictPolicy = iota
+	// ConflictKeepFirst keeps the recipe of the earlier directory
+	ConflictKeepFirst
+	// ConflictRename keeps both, numbering the later one, e.g. "Portra (2)"
+	ConflictRename
+	// ConflictError fails loading
+	ConflictError
+)
+
+// ConflictPolicies are the names of the policies, as ParseConflictPolicy
+// takes them.
+var ConflictPolicies = []string{"keep-last", "keep-first", "rename", "error"}
+
+// ParseConflictPolicy parses "keep-last", "keep-first", "rename" or "error".
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for i, name := range ConflictPolicies {
+		if strings.EqualFold(s, name) {
+			return ConflictPolicy(i), nil
+		}
+	}
+
+	return ConflictKeepLast, fmt.Errorf("Unknown conflict policy '%s', expected one of: %s", s, strings.Join(ConflictPolicies, ", "))
+}
+
+func (p ConflictPolicy) String() string {
+	if int(p) < len(ConflictPolicies) {
+		return ConflictPolicies[p]
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+}
+
+// RecipeConflict is a name shared by recipes with different settings.
+type RecipeConflict struct {
+	Name string `json:"name"`
+	// Where the recipes are from, the earlier one first: the simulation
+	// directory, and the collection in it
+	Sources []string `json:"sources"`
+	// What became of the later recipe: "kept", "dropped" or "renamed"
+	Resolution string `json:"resolution"`
+	// The name the later recipe got, if it was renamed
+	Renamed string `json:"renamed,omitempty"`
+}
+
+// mergeRecipes is MergeRecipes for the recipes of dirs, with opts.OnConflict
+// deciding about recipes of the same name that differ, which are listed in
+// report.
+func mergeRecipes(opts LoadOptions, report *LoadReport, dirs []string, lists [][]Recipe) ([]Recipe, error) {
+	var recipes []Recipe
+	// Where each recipe is from
+	var sources []string
+	positions := map[string]int{}
+
+	for l, list := range lists {
+		for _, recipe := range list {
+			source := path.Join(filepath.ToSlash(dirs[l]), recipe.Collection)
+			i, ok := positions[recipe.Name]
+			if !ok {
+				positions[recipe.Name] = len(recipes)
+				recipes = append(recipes, recipe)
+				sources = append(sources, source)
+				continue
+			}
+
+			if sameSettings(recipes[i], recipe) {
+				recipes[i] = recipe
+				sources[i] = source
+				continue
+			}
+
+			conflict := RecipeConflict{Name: recipe.Name, Sources: []string{sources[i], source}}
+			switch opts.OnConflict {
+			case ConflictError:
+				return recipes, fmt.Errorf("Recipe '%s' is defined twice, with different settings", recipe.Name)
+			case ConflictKeepFirst:
+				conflict.Resolution = "dropped"
+			case ConflictRename:
+				conflict.Resolution = "renamed"
+				for n := 2; ; n++ {
+					name := fmt.Sprintf("%s (%d)", recipe.Name, n)
+					if _, taken := positions[name]; !taken {
+						conflict.Renamed = name
+						break
+					}
+				}
+				recipe.Name = conflict.Renamed
+				positions[recipe.Name] = len(recipes)
+				recipes = append(recipes, recipe)
+				sources = append(sources, source)
+			default:
+				conflict.Resolution = "kept"
+				recipes[i] = recipe
+				sources[i] = source
+			}
+
+			Logger.Warn("Recipes share a name, but not their settings", "name", conflict.Name,
+				"sources", conflict.Sources, "policy", opts.OnConflict)
+			report.Conflicts = append(report.Conflicts, conflict)
+		}
+	}
+
+	return recipes, nil
+}
+
+// sameSettings reports whether two recipes have the same settings, leaving
+// out the ones either doesn't set.
+func sameSettings(a, b Recipe) bool {
+	return len(CompareRecipes(a, b)) == 0 && len(CompareRecipes(b, a)) == 0
+}
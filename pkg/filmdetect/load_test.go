@@ -0,0 +1,120 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestDir writes three recipe files, the second of them broken.
+func loadTestDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json": `{"name": "A", "film_simulation": "Provia"}`,
+		"b.json": `{"name": "B", "film_simulation": `,
+		"c.json": `{"name": "C", "film_simulation": "Velvia"}`,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoadRecipes(t *testing.T) {
+	dir := loadTestDir(t)
+
+	t.Run("Errors", func(t *testing.T) {
+		var names []string
+		var errs []error
+		for recipe, err := range LoadRecipes(context.Background(), dir) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			names = append(names, recipe.Name)
+		}
+
+		// The broken file doesn't stop the others from loading
+		if len(names) != 2 || names[0] != "A" || names[1] != "C" {
+			t.Errorf("LoadRecipes gave %v, expected [A C]", names)
+		}
+		if len(errs) != 1 {
+			t.Errorf("LoadRecipes gave errors %v, expected one for b.json", errs)
+		}
+	})
+
+	t.Run("Break", func(t *testing.T) {
+		var names []string
+		for recipe, err := range LoadRecipes(context.Background(), dir) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, recipe.Name)
+			break
+		}
+
+		if len(names) != 1 || names[0] != "A" {
+			t.Errorf("LoadRecipes gave %v before the break, expected [A]", names)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var names []string
+		var errs []error
+		for recipe, err := range LoadRecipes(ctx, dir) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			names = append(names, recipe.Name)
+			cancel()
+		}
+
+		if len(names) != 1 {
+			t.Errorf("LoadRecipes gave %v after being canceled, expected [A]", names)
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+			t.Errorf("LoadRecipes gave errors %v, expected %v", errs, context.Canceled)
+		}
+	})
+
+	t.Run("MissingDir", func(t *testing.T) {
+		count := 0
+		for _, err := range LoadRecipes(context.Background(), filepath.Join(dir, "missing")) {
+			if err == nil {
+				t.Error("LoadRecipes of a missing directory gave a recipe")
+			}
+			count++
+		}
+
+		if count != 1 {
+			t.Errorf("LoadRecipes of a missing directory yielded %d times, expected once", count)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// RecipeSchemaVersion is the version of the recipe file format, which
+// WriteRecipeFile writes into the schema_version of the files it saves.
+// Files without a schema_version are of version 1.
+const RecipeSchemaVersion = 2
+
+// recipeMigrations upgrade the keys of a recipe file by one version: the
+// first from version 1 to 2, and so on.
+var recipeMigrations = []func(keys map[string]json.RawMessage) error{
+	migrateV1,
+}
+
+// migrateRecipe upgrades the contents of a recipe file to
+// RecipeSchemaVersion.  Files of the current version are returned as they
+// are.
+func migrateRecipe(b []byte) ([]byte, error) {
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+
+	version := 1
+	if raw, ok := keys["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 1 {
+			return nil, fmt.Errorf("Invalid schema_version: %s", raw)
+		}
+	}
+
+	if version > RecipeSchemaVersion {
+		return nil, fmt.Errorf("The recipe is of schema version %d, but this version of filmdetect only reads up to %d", version, RecipeSchemaVersion)
+	}
+	if version == RecipeSchemaVersion {
+		return b, nil
+	}
+
+	for v := version; v < RecipeSchemaVersion; v++ {
+		if err := recipeMigrations[v-1](keys); err != nil {
+			return nil, err
+		}
+	}
+
+	keys["schema_version"] = json.RawMessage(fmt.Sprint(RecipeSchemaVersion))
+	return json.Marshal(keys)
+}
+
+// v1SettingKeys are the names older recipe files give some settings, and
+// their names since version 2.  The first filmdetect had no keys for the
+// author, URL, color, sharpness and clarity, so it wrote their Go names.
+var v1SettingKeys = map[string]string{
+	"Author":             "author",
+	"Url":                "url",
+	"Color":              "color",
+	"Sharpness":          "sharpness",
+	"Clarity":            "clarity",
+	"white_balance":      "white_balance_mode",
+	"white_balance_red":  "white_balance_r",
+	"white_balance_blue": "white_balance_b",
+	"highlights":         "tone_curve_highlights",
+	"shadows":            "tone_curve_shadows",
+}
+
+// migrateV1 renames the settings in v1SettingKeys, in the recipe and its
+// variants, and splits the grain_effect shorthand, e.g. "Strong, Large",
+// into grain_effect_roughness and grain_effect_size.  The separate grain
+// fields win if a recipe has both.
+func migrateV1(keys map[string]json.RawMessage) error {
+	if err := renameKeys(keys, v1SettingKeys); err != nil {
+		return err
+	}
+
+	if raw, ok := keys["grain_effect"]; ok {
+		var grainEffect string
+		if err := json.Unmarshal(raw, &grainEffect); err != nil {
+			return fmt.Errorf("grain_effect: %v", err)
+		}
+
+		if grainEffect != "" {
+			roughness, size, err := ParseGrainEffect(grainEffect)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := keys["grain_effect_roughness"]; !ok {
+				keys["grain_effect_roughness"], _ = json.Marshal(roughness)
+			}
+			if _, ok := keys["grain_effect_size"]; !ok {
+				keys["grain_effect_size"], _ = json.Marshal(size)
+			}
+		}
+		delete(keys, "grain_effect")
+	}
+
+	raw, ok := keys["variants"]
+	if !ok {
+		return nil
+	}
+
+	var variants []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &variants); err != nil {
+		return fmt.Errorf("variants: %v", err)
+	}
+	for _, variant := range variants {
+		if err := renameKeys(variant, v1SettingKeys); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	keys["variants"], err = json.Marshal(variants)
+	return err
+}
+
+// renameKeys renames the keys of an object from the keys of names to their
+// values.
+func renameKeys(keys map[string]json.RawMessage, names map[string]string) error {
+	for old, name := range names {
+		value, ok := keys[old]
+		if !ok {
+			continue
+		}
+
+		if _, ok := keys[name]; ok {
+			return fmt.Errorf("Both '%s' and '%s' are set; '%s' is the old name of '%s'", old, name, old, name)
+		}
+
+		keys[name] = value
+		delete(keys, old)
+	}
+
+	return nil
+}
+
+// EncodeRecipeFile returns the contents of a recipe file of recipe, of the
+// current RecipeSchemaVersion.
+func EncodeRecipeFile(recipe Recipe) ([]byte, error) {
+	b, err := json.Marshal(recipe)
+	if err != nil {
+		return nil, err
+	}
+
+	versioned := fmt.Appendf(nil, `{"schema_version":%d`, RecipeSchemaVersion)
+	if len(b) > 2 {
+		versioned = append(versioned, ',')
+	}
+	versioned = append(versioned, b[1:]...)
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, versioned, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateRecipe(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]any
+	}{
+		{
+			"baseline keys",
+			`{"name": "Kodachrome 64", "Author": "Fuji X Weekly", "Url": "https://fujixweekly.com/", "Color": 2, "Sharpness": 1, "Clarity": 3}`,
+			map[string]any{"name": "Kodachrome 64", "author": "Fuji X Weekly", "url": "https://fujixweekly.com/", "color": 2.0, "sharpness": 1.0, "clarity": 3.0},
+		},
+		{
+			"version 1 keys",
+			`{"name": "Portra", "white_balance": "Auto", "white_balance_red": 1, "highlights": -1, "grain_effect": "Strong, Large"}`,
+			map[string]any{"name": "Portra", "white_balance_mode": "Auto", "white_balance_r": 1.0, "tone_curve_highlights": -1.0, "grain_effect_roughness": "Strong", "grain_effect_size": "Large"},
+		},
+		{
+			"variants",
+			`{"name": "Portra", "variants": [{"models": ["X-T3"], "Color": 1, "shadows": 2}]}`,
+			map[string]any{"name": "Portra", "variants": []any{map[string]any{"models": []any{"X-T3"}, "color": 1.0, "tone_curve_shadows": 2.0}}},
+		},
+	}
+
+	for _, test := range tests {
+		migrated, err := migrateRecipe([]byte(test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var got map[string]any
+		if err := json.Unmarshal(migrated, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["schema_version"] != float64(RecipeSchemaVersion) {
+			t.Errorf("%s: schema_version = %v", test.name, got["schema_version"])
+		}
+		delete(got, "schema_version")
+
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(test.want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: migrated to %s, expected %s", test.name, gotJSON, wantJSON)
+		}
+	}
+
+	if _, err := migrateRecipe([]byte(`{"Color": 1, "color": 2}`)); err == nil {
+		t.Errorf("Both Color and color migrated")
+	}
+}
+
+func TestEditBaselineRecipe(t *testing.T) {
+	object := []byte(`{"name": "Kodachrome 64", "Sharpness": 1}`)
+
+	edited, err := setObjectKey(object, recipeFieldKeys("Sharpness"), []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name": "Kodachrome 64", "Sharpness": 2}`; string(edited) != want {
+		t.Errorf("Edited to %s, expected %s", edited, want)
+	}
+}
@@ -0,0 +1,399 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Synonyms maps lowercase spellings of enum values, as found in shared
+// recipes, to the values exiftool reports.
+var Synonyms = map[string]string{
+	"off":    "Off",
+	"none":   "Off",
+	"weak":   "Weak",
+	"low":    "Weak",
+	"strong": "Strong",
+	"high":   "Strong",
+	"small":  "Small",
+	"large":  "Large",
+	"auto":   "Auto",
+	"ye":     "Yellow",
+	"r":      "Red",
+	"g":      "Green",
+}
+
+// GrainEffectAliases maps lowercase spellings of grain effect roughness and
+// size, as found in shared recipes, to the values exiftool reports.
+var GrainEffectAliases = map[string]string{
+	"none":   "Off",
+	"no":     "Off",
+	"soft":   "Weak",
+	"light":  "Weak",
+	"mild":   "Weak",
+	"rough":  "Strong",
+	"heavy":  "Strong",
+	"hard":   "Strong",
+	"sm":     "Small",
+	"fine":   "Small",
+	"lg":     "Large",
+	"big":    "Large",
+	"coarse": "Large",
+}
+
+// The most characters a misspelled enum value may differ in from the value
+// it's taken for, see closestName.  Fewer are allowed in short values.
+const MaxEditDistance = 2
+
+// WhiteBalanceAliases maps the names recipes use for white balance modes to
+// what exiftool reports.  Keys are simplified with simplifyName.
+var WhiteBalanceAliases = map[string]string{
+	"awb":                    "Auto",
+	"autowb":                 "Auto",
+	"autowhitebalance":       "Auto",
+	"awbwhitepriority":       "Auto (white priority)",
+	"autowhitepriority":      "Auto (white priority)",
+	"whitepriority":          "Auto (white priority)",
+	"awbambiencepriority":    "Auto (ambiance priority)",
+	"awbambiancepriority":    "Auto (ambiance priority)",
+	"autoambiencepriority":   "Auto (ambiance priority)",
+	"ambiencepriority":       "Auto (ambiance priority)",
+	"ambiancepriority":       "Auto (ambiance priority)",
+	"sunny":                  "Daylight",
+	"fine":                   "Daylight",
+	"shade":                  "Cloudy",
+	"overcast":               "Cloudy",
+	"fluorescent1":           "Daylight Fluorescent",
+	"fluorescentlight1":      "Daylight Fluorescent",
+	"fluorescent2":           "Day White Fluorescent",
+	"fluorescentlight2":      "Day White Fluorescent",
+	"fluorescent3":           "White Fluorescent",
+	"fluorescentlight3":      "White Fluorescent",
+	"tungsten":               "Incandescent",
+	"incandescentlight":      "Incandescent",
+	"colortemperature":       "Kelvin",
+	"colortemperaturekelvin": "Kelvin",
+	"custom1":                "Custom",
+	"customwhitebalance":     "Custom",
+	"customwhitebalance1":    "Custom",
+	"customwhitebalance2":    "Custom2",
+	"customwhitebalance3":    "Custom3",
+}
+
+// FilmSimulationAliases maps exiftool's FilmMode values, and the names
+// recipes use for film simulations, to the names in EnumValues.  Keys are
+// simplified with simplifyName.
+var FilmSimulationAliases = map[string]string{
+	"f0standardprovia":                     "Provia",
+	"standardprovia":                       "Provia",
+	"proviastandard":                       "Provia",
+	"standard":                             "Provia",
+	"f2fujichromevelvia":                   "Velvia",
+	"f4velvia":                             "Velvia",
+	"fujichromevelvia":                     "Velvia",
+	"velviavivid":                          "Velvia",
+	"vivid":                                "Velvia",
+	"f1bstudioportraitsmoothskintoneastia": "Astia",
+	"studioportraitsmoothskintoneastia":    "Astia",
+	"astiasoft":                            "Astia",
+	"soft":                                 "Astia",
+	"cc":                                   "Classic Chrome",
+	"pronegstandard":                       "Pro Neg. Std",
+	"proneghigh":                           "Pro Neg. Hi",
+	"classicneg":                           "Classic Negative",
+	"nostalgicnegative":                    "Nostalgic Neg",
+	"eternacinema":                         "Eterna",
+	"eternableachbypass":                   "Bleach Bypass",
+	"reala":                                "Reala ACE",
+	"monochrome":                           "None (B&W)",
+	"bw":                                   "None (B&W)",
+	"monochromeyellowfilter":               "B&W Yellow Filter",
+	"monochromeye":                         "B&W Yellow Filter",
+	"monochromeredfilter":                  "B&W Red Filter",
+	"monochromer":                          "B&W Red Filter",
+	"monochromegreenfilter":                "B&W Green Filter",
+	"monochromeg":                          "B&W Green Filter",
+	"sepia":                                "B&W Sepia",
+	"acrosye":                              "Acros Yellow Filter",
+	"acrosyellow":                          "Acros Yellow Filter",
+	"acrosr":                               "Acros Red Filter",
+	"acrosred":                             "Acros Red Filter",
+	"acrosg":                               "Acros Green Filter",
+	"acrosgreen":                           "Acros Green Filter",
+}
+
+// MonochromeFilterSimulations are the black and white film simulations with a
+// color filter, as exiftool reports them in the Saturation tag, split into
+// the film simulation and MonochromeFilter.
+var MonochromeFilterSimulations = map[string][2]string{
+	"Acros Yellow Filter": {"Acros", "Yellow"},
+	"Acros Red Filter":    {"Acros", "Red"},
+	"Acros Green Filter":  {"Acros", "Green"},
+	"B&W Yellow Filter":   {"None (B&W)", "Yellow"},
+	"B&W Red Filter":      {"None (B&W)", "Red"},
+	"B&W Green Filter":    {"None (B&W)", "Green"},
+}
+
+// SplitMonochromeFilter splits a black and white film simulation with a
+// color filter, e.g. "Acros Yellow Filter", into the film simulation and
+// the filter.  The filter is empty for other film simulations.
+func SplitMonochromeFilter(filmSimulation string) (string, string) {
+	simulation := NormalizeFilmSimulation(filmSimulation)
+	if split, ok := MonochromeFilterSimulations[simulation]; ok {
+		return split[0], split[1]
+	}
+
+	return simulation, ""
+}
+
+// closestName returns the value of names whose key is the only one within
+// MaxEditDistance of simple, and no more than a quarter of its length.  Keys
+// are simplified with simplifyName.
+func closestName(simple string, names map[string]string) (string, bool) {
+	tolerance := min(MaxEditDistance, len(simple)/4)
+	if tolerance == 0 {
+		return "", false
+	}
+
+	best := ""
+	bestDistance := tolerance + 1
+	ambiguous := false
+	for key, value := range names {
+		distance := editDistance(simple, key)
+		if distance < bestDistance {
+			best, bestDistance, ambiguous = value, distance, false
+		} else if distance == bestDistance && value != best {
+			ambiguous = true
+		}
+	}
+
+	if best == "" || ambiguous {
+		return "", false
+	}
+
+	return best, true
+}
+
+// editDistance returns the number of single character edits turning a into
+// b, counting two swapped neighbouring characters as one, as in "Velvai".
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+// enumNames returns the values of field, and the aliases of them, keyed by
+// their simplified names, for closestName.
+func enumNames(field string, aliases map[string]string) map[string]string {
+	names := map[string]string{}
+	for _, known := range EnumValues[field] {
+		names[simplifyName(known)] = known
+	}
+	for alias, canonical := range aliases {
+		if slices.Contains(EnumValues[field], canonical) {
+			names[simplifyName(alias)] = canonical
+		}
+	}
+
+	return names
+}
+
+var (
+	nonAlphanumeric  = regexp.MustCompile(`[^a-z0-9]+`)
+	colorTemperature = regexp.MustCompile(`^[0-9]{4,5}k$`)
+)
+
+// simplifyName lowercases input and drops everything but letters and digits,
+// so that "Auto (white priority)" and "auto-white priority" compare equal.
+func simplifyName(input string) string {
+	return nonAlphanumeric.ReplaceAllString(strings.ToLower(input), "")
+}
+
+// NormalizeWhiteBalanceMode maps the many ways of naming a white balance mode
+// to the value exiftool reports.  A color temperature such as "6500K" maps to
+// "Kelvin", which is all the camera records as the mode.
+func NormalizeWhiteBalanceMode(value string) string {
+	simple := simplifyName(value)
+
+	for _, known := range EnumValues["WhiteBalanceMode"] {
+		if simplifyName(known) == simple {
+			return known
+		}
+	}
+
+	if canonical, ok := WhiteBalanceAliases[simple]; ok {
+		return canonical
+	}
+
+	if colorTemperature.MatchString(simple) {
+		return "Kelvin"
+	}
+
+	if closest, ok := closestName(simple, enumNames("WhiteBalanceMode", WhiteBalanceAliases)); ok {
+		return closest
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// NormalizeFilmSimulation maps exiftool's FilmMode, or any of the names
+// recipes use for a film simulation, to its name in EnumValues.
+func NormalizeFilmSimulation(value string) string {
+	simple := simplifyName(value)
+
+	for _, known := range EnumValues["FilmSimulation"] {
+		if simplifyName(known) == simple {
+			return known
+		}
+	}
+
+	if canonical, ok := FilmSimulationAliases[simple]; ok {
+		return canonical
+	}
+
+	names := enumNames("FilmSimulation", FilmSimulationAliases)
+	for known := range MonochromeFilterSimulations {
+		if simplifyName(known) == simple {
+			return known
+		}
+		names[simplifyName(known)] = known
+	}
+	for alias, canonical := range FilmSimulationAliases {
+		if _, ok := MonochromeFilterSimulations[canonical]; ok {
+			names[alias] = canonical
+		}
+	}
+
+	if closest, ok := closestName(simple, names); ok {
+		return closest
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// NormalizeValue returns the canonical spelling of an enum value of field.
+// Values are matched case-insensitively against EnumValues first, and
+// Synonyms second.  Unknown values are returned as they are.
+func NormalizeValue(field, value string) string {
+	if field == "WhiteBalanceMode" {
+		return NormalizeWhiteBalanceMode(value)
+	}
+
+	if field == "FilmSimulation" {
+		return NormalizeFilmSimulation(value)
+	}
+
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+
+	// Black and white recipes without a filter tend to leave it out, and
+	// recipes older than a setting don't mention it
+	if (field == "MonochromeFilter" || FieldGenerations[field] != "") && value == "" {
+		return "Off"
+	}
+
+	if field == "DynamicRange" {
+		// "DR400", "DR-Auto", "400%"
+		lower = strings.TrimPrefix(lower, "dr")
+		lower = strings.Trim(lower, " -%")
+	}
+
+	for _, known := range EnumValues[field] {
+		if strings.ToLower(known) == lower {
+			return known
+		}
+	}
+
+	aliases := Synonyms
+	if field == "GrainEffectRoughness" || field == "GrainEffectSize" {
+		aliases = maps.Clone(Synonyms)
+		maps.Copy(aliases, GrainEffectAliases)
+	}
+
+	if canonical, ok := aliases[lower]; ok {
+		for _, known := range EnumValues[field] {
+			if known == canonical {
+				return canonical
+			}
+		}
+	}
+
+	if field != "DynamicRange" {
+		if closest, ok := closestName(simplifyName(value), enumNames(field, aliases)); ok {
+			return closest
+		}
+	}
+
+	return value
+}
+
+// NormalizeRecipe returns a copy of r with all enum values in their canonical
+// spelling, so that "weak", "WEAK" and "Weak" compare equal.  The color filter
+// of a film simulation such as "Acros Yellow Filter" moves to
+// MonochromeFilter.
+func NormalizeRecipe(r Recipe) Recipe {
+	r = splitMonochromeFilter(r)
+	v := reflect.ValueOf(&r).Elem()
+
+	for field := range EnumValues {
+		f := v.FieldByName(field)
+		f.SetString(NormalizeValue(field, f.String()))
+	}
+
+	return r
+}
+
+// splitMonochromeFilter moves the color filter of the film simulation of r,
+// if it has one, to MonochromeFilter.  A filter the recipe sets on its own
+// wins.
+func splitMonochromeFilter(r Recipe) Recipe {
+	simulation, filter := SplitMonochromeFilter(r.FilmSimulation)
+	if filter == "" {
+		return r
+	}
+
+	r.FilmSimulation = simulation
+	if NormalizeValue("MonochromeFilter", r.MonochromeFilter) == "Off" || r.IsUnset("MonochromeFilter") {
+		r.MonochromeFilter = filter
+	}
+
+	return r.withSet("MonochromeFilter")
+}
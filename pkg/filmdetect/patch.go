@@ -0,0 +1,68 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"strings"
+)
+
+// PatchOperation is an operation of a JSON Patch (RFC 6902) on a recipe file.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// Patch returns the changes that turn the recipe file of the candidate into
+// the settings of the input, as JSON Patch operations.  Settings the input
+// has and the candidate leaves out aren't in it, as they weren't compared.
+func (d Difference) Patch() []PatchOperation {
+	patch := []PatchOperation{}
+
+	for _, field := range d.mismatches {
+		path, ok := patchPath(d.Candidate, field.Field)
+		if !ok {
+			continue
+		}
+
+		patch = append(patch, PatchOperation{Op: "replace", Path: path, Value: field.Input})
+	}
+
+	return patch
+}
+
+// patchPath returns the JSON Pointer of a setting in a recipe file: a key of
+// the recipe, or of its settings for dialects other than FujifilmDialect.
+func patchPath(r Recipe, field string) (string, bool) {
+	prefix := "/"
+	if r.DialectName() != FujifilmDialect {
+		prefix = "/settings/"
+	}
+
+	for _, f := range r.dialect().Fields() {
+		if f.Name == field {
+			return prefix + escapePointer(f.Key), true
+		}
+	}
+
+	return "", false
+}
+
+// escapePointer escapes a key for a JSON Pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,159 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+)
+
+// HasExtension reports whether path ends in one of exts, ignoring case, so
+// that IMG_0001.JPG and recipe.JSON from a Windows machine are picked up.
+func HasExtension(path string, exts ...string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// heifBrands are the brands of the ftyp box HEIF files start with.
+var heifBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"}
+
+// ImageExtension returns the extension an image file of contents should
+// have: ".hif" for HEIF, and ".jpg" for anything else.  exiftool goes by the
+// contents, but complains about a file of the wrong extension.
+func ImageExtension(contents []byte) string {
+	if len(contents) >= 12 && string(contents[4:8]) == "ftyp" {
+		for _, brand := range heifBrands {
+			if string(contents[8:12]) == brand {
+				return ".hif"
+			}
+		}
+	}
+
+	return ".jpg"
+}
+
+// SamePath reports whether two cleaned, absolute paths name the same file.
+// Windows paths are case-insensitive, and the same with or without the \\?\
+// prefix of long paths.
+func SamePath(a, b string) bool {
+	return samePath(a, b, runtime.GOOS == "windows")
+}
+
+func samePath(a, b string, windows bool) bool {
+	if windows {
+		return strings.EqualFold(withoutLongPathPrefix(a), withoutLongPathPrefix(b))
+	}
+	return a == b
+}
+
+// RecipePath turns a path found inside a recipe file, which may have been
+// written on another system, into one for this system.  UNC paths stay UNC
+// paths, and long paths lose their \\?\ prefix.
+func RecipePath(path string) string {
+	return filepath.FromSlash(strings.ReplaceAll(withoutLongPathPrefix(path), `\`, "/"))
+}
+
+// The prefixes of Windows paths passed on to the file system as they are,
+// which lets them be longer than 260 characters
+const (
+	longPathPrefix    = `\\?\`
+	longUNCPathPrefix = `\\?\UNC\`
+)
+
+// withoutLongPathPrefix returns a Windows path without its long path prefix:
+// \\?\C:\Photos as C:\Photos, and \\?\UNC\server\share as \\server\share.
+func withoutLongPathPrefix(path string) string {
+	if len(path) >= len(longUNCPathPrefix) && strings.EqualFold(path[:len(longUNCPathPrefix)], longUNCPathPrefix) {
+		return `\\` + path[len(longUNCPathPrefix):]
+	}
+	return strings.TrimPrefix(path, longPathPrefix)
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// decodeText returns the contents of a text file as UTF-8 without a byte
+// order mark.  Notepad adds one when saving, and may save as UTF-16.
+func decodeText(b []byte) []byte {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return b[len(bomUTF8):]
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return decodeUTF16(b[len(bomUTF16LE):], false)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return decodeUTF16(b[len(bomUTF16BE):], true)
+	}
+	return b
+}
+
+// encodeText turns UTF-8 text back into the encoding of original, the
+// contents of the text file decodeText decoded it from, byte order mark
+// included.
+func encodeText(b, original []byte) []byte {
+	switch {
+	case bytes.HasPrefix(original, bomUTF8):
+		return append(bytes.Clone(bomUTF8), b...)
+	case bytes.HasPrefix(original, bomUTF16LE):
+		return encodeUTF16(b, false)
+	case bytes.HasPrefix(original, bomUTF16BE):
+		return encodeUTF16(b, true)
+	}
+	return b
+}
+
+// encodeUTF16 encodes UTF-8 text as UTF-16 with a byte order mark.
+func encodeUTF16(b []byte, bigEndian bool) []byte {
+	units := utf16.Encode([]rune(string(b)))
+
+	encoded := make([]byte, 0, 2+2*len(units))
+	if bigEndian {
+		encoded = append(encoded, bomUTF16BE...)
+	} else {
+		encoded = append(encoded, bomUTF16LE...)
+	}
+	for _, unit := range units {
+		if bigEndian {
+			encoded = append(encoded, byte(unit>>8), byte(unit))
+		} else {
+			encoded = append(encoded, byte(unit), byte(unit>>8))
+		}
+	}
+	return encoded
+}
+
+func decodeUTF16(b []byte, bigEndian bool) []byte {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			units[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
@@ -0,0 +1,124 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasExtension(t *testing.T) {
+	tests := []struct {
+		path string
+		exts []string
+		want bool
+	}{
+		{"DSCF0001.jpg", []string{".jpg"}, true},
+		{"DSCF0001.JPG", []string{".jpg"}, true},
+		{"DSCF0001.HIF", ImageExtensions, true},
+		{`C:\Recipes\Kodachrome.JSON`, []string{".json"}, true},
+		{"DSCF0001.jpg.xmp", []string{".jpg"}, false},
+		{"DSCF0001.RAF", ImageExtensions, false},
+		{"jpg", []string{".jpg"}, false},
+		{"DSCF0001.jpg", nil, false},
+	}
+
+	for _, test := range tests {
+		if got := HasExtension(test.path, test.exts...); got != test.want {
+			t.Errorf("HasExtension(%q, %q) = %v, expected %v", test.path, test.exts, got, test.want)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	const text = `{"name": "Kodachrome 64 – Rückblick 📷"}`
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"UTF-8", []byte(text)},
+		{"UTF-8 with BOM", append([]byte{0xef, 0xbb, 0xbf}, text...)},
+		{"UTF-16 LE", encodeUTF16([]byte(text), false)},
+		{"UTF-16 BE", encodeUTF16([]byte(text), true)},
+	}
+
+	for _, test := range tests {
+		if got := string(decodeText(test.input)); got != text {
+			t.Errorf("%s: decodeText gave %q, expected %q", test.name, got, text)
+		}
+		if got := encodeText(decodeText(test.input), test.input); !bytes.Equal(got, test.input) {
+			t.Errorf("%s: encodeText gave % x, expected % x", test.name, got, test.input)
+		}
+	}
+
+	if got, want := encodeUTF16([]byte("{é📷"), false), []byte{0xff, 0xfe, '{', 0, 0xe9, 0, 0x3d, 0xd8, 0xf7, 0xdc}; !bytes.Equal(got, want) {
+		t.Errorf("encodeUTF16 gave % x, expected % x", got, want)
+	}
+	if got, want := encodeUTF16([]byte("{é📷"), true), []byte{0xfe, 0xff, 0, '{', 0, 0xe9, 0xd8, 0x3d, 0xdc, 0xf7}; !bytes.Equal(got, want) {
+		t.Errorf("encodeUTF16 gave % x, expected % x", got, want)
+	}
+}
+
+func TestRecipePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"base.json", "base.json"},
+		{"../shared/base.json", "../shared/base.json"},
+		{`..\shared\base.json`, "../shared/base.json"},
+		{`C:\Recipes\base.json`, "C:/Recipes/base.json"},
+		{`\\?\C:\Recipes\base.json`, "C:/Recipes/base.json"},
+		{`\\nas\photos\recipes\base.json`, "//nas/photos/recipes/base.json"},
+		{`\\?\UNC\nas\photos\recipes\base.json`, "//nas/photos/recipes/base.json"},
+		{`\\?\unc\nas\photos\base.json`, "//nas/photos/base.json"},
+	}
+
+	for _, test := range tests {
+		if got, want := RecipePath(test.path), filepath.FromSlash(test.want); got != want {
+			t.Errorf("RecipePath(%q) = %q, expected %q", test.path, got, want)
+		}
+	}
+}
+
+func TestSamePath(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		windows bool
+		want    bool
+	}{
+		{"/photos/recipes/a.json", "/photos/recipes/a.json", false, true},
+		{"/photos/recipes/a.json", "/photos/Recipes/a.json", false, false},
+		{`C:\Recipes\a.json`, `c:\recipes\A.JSON`, true, true},
+		{`C:\Recipes\a.json`, `C:\Recipes\b.json`, true, false},
+		{`\\?\C:\Recipes\a.json`, `C:\Recipes\a.json`, true, true},
+		{`\\?\UNC\nas\photos\a.json`, `\\nas\photos\a.json`, true, true},
+		{`\\?\UNC\nas\photos\a.json`, `\\nas\photos\b.json`, true, false},
+	}
+
+	for _, test := range tests {
+		if got := samePath(test.a, test.b, test.windows); got != test.want {
+			t.Errorf("samePath(%q, %q, windows=%v) = %v, expected %v", test.a, test.b, test.windows, got, test.want)
+		}
+	}
+
+	if !SamePath("/photos/a.json", "/photos/a.json") {
+		t.Error("SamePath is false for equal paths")
+	}
+}
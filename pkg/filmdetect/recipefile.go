@@ -0,0 +1,328 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// recipeFile is the on-disk form of a recipe.  On top of the Recipe fields
+// it says how the file is to be read.
+type recipeFile struct {
+	Recipe
+	// See RecipeSchemaVersion; older files are upgraded by migrateRecipe
+	SchemaVersion int `json:"schema_version"`
+	// Path of a recipe file this one is based on, relative to this one
+	Extends string `json:"extends"`
+	// What a step of the white balance shift is in this file: 1 for camera
+	// units (-9..9), ExifWhiteBalanceScale for the units of EXIF (-180..180).
+	// Guessed from the values when not given.
+	WhiteBalanceShiftScale int `json:"wb_shift_scale"`
+	// The URL of RecipeSchema, which editors use to validate the file
+	Schema string `json:"$schema"`
+}
+
+// RecipeSchema is the JSON Schema of recipe files.
+//
+//go:embed recipe.schema.json
+var RecipeSchema []byte
+
+// decodeRecipe parses the contents of a recipe file.  If the recipe extends
+// another one, resolve is called to load the base, and the fields of this
+// recipe are applied on top of it.
+func decodeRecipe(b []byte, resolve func(extends string) (Recipe, error)) (Recipe, error) {
+	b, err := migrateRecipe(decodeText(b))
+	if err != nil {
+		return Recipe{}, err
+	}
+
+	own := recipeFile{}
+	err = decodeStrict(b, &own)
+	if err != nil {
+		return own.Recipe, err
+	}
+
+	base := Recipe{}
+	if own.Extends != "" {
+		if resolve == nil {
+			return base, fmt.Errorf("Recipe extends '%s', but it isn't read from a file", own.Extends)
+		}
+
+		base, err = resolve(own.Extends)
+		if err != nil {
+			return base, err
+		}
+	}
+
+	file := recipeFile{Recipe: base}
+	err = json.Unmarshal(b, &file)
+	if err != nil {
+		return file.Recipe, err
+	}
+
+	recipe := file.Recipe
+
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return recipe, err
+	}
+
+	// A setting is unset if neither this file nor the recipes it extends
+	// set it
+	if own.Extends == "" {
+		recipe.Unset = unsetFields(keys)
+	} else {
+		recipe = recipe.withSet(slices.DeleteFunc(ScoringFields(), func(field string) bool {
+			return slices.Contains(unsetFields(keys), field)
+		})...)
+	}
+
+	// "Acros Yellow Filter" sets the filter too
+	recipe = splitMonochromeFilter(recipe)
+
+	if err := checkDialect(&recipe); err != nil {
+		return recipe, err
+	}
+
+	if err := scaleWhiteBalanceShift(keys, own, &recipe); err != nil {
+		return recipe, err
+	}
+
+	for _, variant := range recipe.Variants {
+		if _, err := variant.apply(recipe); err != nil {
+			return recipe, err
+		}
+	}
+
+	return recipe, nil
+}
+
+// decodeStrict unmarshals b into v like json.Unmarshal, but rejects keys that
+// v doesn't have, so that typos in recipe files don't go unnoticed.
+func decodeStrict(b []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	key, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return err
+	}
+	key = strings.Trim(key, `"`)
+
+	for _, known := range recipeKeys() {
+		if strings.HasPrefix(known, key) || strings.HasPrefix(key, known) {
+			return fmt.Errorf("Unknown key '%s', did you mean '%s'?", key, known)
+		}
+	}
+
+	return fmt.Errorf("Unknown key '%s'", key)
+}
+
+// recipeKeys returns the keys a recipe file may have.
+func recipeKeys() []string {
+	var keys []string
+
+	t := reflect.TypeOf(recipeFile{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			for j := 0; j < field.Type.NumField(); j++ {
+				if key := strings.Split(field.Type.Field(j).Tag.Get("json"), ",")[0]; key != "-" {
+					keys = append(keys, key)
+				}
+			}
+			continue
+		}
+		if key := strings.Split(field.Tag.Get("json"), ",")[0]; key != "-" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// scaleWhiteBalanceShift converts the white balance shift this file sets to
+// camera units.  Values inherited from a base recipe are already converted.
+func scaleWhiteBalanceShift(keys map[string]json.RawMessage, own recipeFile, recipe *Recipe) error {
+	shifts := map[string]*int{}
+	if hasKey(keys, "white_balance_r") {
+		shifts["white_balance_r"] = &recipe.WhiteBalanceRed
+	}
+	if hasKey(keys, "white_balance_b") {
+		shifts["white_balance_b"] = &recipe.WhiteBalanceBlue
+	}
+
+	scale := own.WhiteBalanceShiftScale
+	if scale < 0 {
+		return fmt.Errorf("Unexpected wb_shift_scale: %d", scale)
+	}
+	if scale == 0 {
+		scale = 1
+		for _, shift := range shifts {
+			if *shift < IntRanges["WhiteBalanceRed"][0] || *shift > IntRanges["WhiteBalanceRed"][1] {
+				scale = ExifWhiteBalanceScale
+			}
+		}
+	}
+
+	for key, shift := range shifts {
+		if *shift%scale != 0 {
+			return fmt.Errorf("%s: %d isn't a multiple of the white balance shift scale %d", key, *shift, scale)
+		}
+		*shift /= scale
+	}
+
+	return nil
+}
+
+// parseRecipeFile reads a recipe file and the chain of recipes it extends.
+// chain holds the files that are already being read, to detect cycles.
+func parseRecipeFile(filename string, chain []string) (Recipe, error) {
+	recipes, err := parseRecipesFile(filename, chain)
+	if err != nil {
+		return Recipe{}, err
+	}
+
+	if len(recipes) != 1 {
+		return Recipe{}, fmt.Errorf("%s: Expected a single recipe, found %d", filename, len(recipes))
+	}
+
+	return recipes[0], nil
+}
+
+// parseRecipesFile reads a file of one recipe, or of a JSON array of them,
+// and the chains of recipes they extend.
+func parseRecipesFile(filename string, chain []string) ([]Recipe, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seen := range chain {
+		if SamePath(seen, abs) {
+			return nil, fmt.Errorf("Recipe inheritance cycle: %s", strings.Join(append(chain, abs), " -> "))
+		}
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	resolve := func(extends string) (Recipe, error) {
+		base := RecipePath(extends)
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(abs), base)
+		}
+		return parseRecipeFile(base, append(chain, abs))
+	}
+
+	recipes, err := decodeRecipes(contents, resolve)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return recipes, nil
+}
+
+// decodeRecipes parses the contents of a file of one recipe, or of a JSON
+// array of them.
+func decodeRecipes(b []byte, resolve func(extends string) (Recipe, error)) ([]Recipe, error) {
+	b = decodeText(b)
+	if !isJSONArray(b) {
+		recipe, err := decodeRecipe(b, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return []Recipe{recipe}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, err
+	}
+
+	var recipes []Recipe
+	for i, item := range items {
+		recipe, err := decodeRecipe(item, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("recipe %d: %v", i+1, err)
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes, nil
+}
+
+// isJSONArray reports whether b holds a JSON array rather than an object.
+func isJSONArray(b []byte) bool {
+	trimmed := bytes.TrimSpace(b)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// ParseGrainEffect splits a combined grain effect such as "Strong, Large",
+// "Weak/Small" or "Off" into its roughness and size.
+func ParseGrainEffect(input string) (string, string, error) {
+	roughness := ""
+	size := ""
+
+	words := regexp.MustCompile(`[^A-Za-z]+`).Split(strings.TrimSpace(input), -1)
+
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+
+		// "Strong" and "Large" as well as "rough" or "big"
+		switch NormalizeValue("GrainEffectRoughness", word) {
+		case "Off":
+			roughness = "Off"
+			size = "Off"
+			continue
+		case "Weak", "Strong":
+			roughness = NormalizeValue("GrainEffectRoughness", word)
+			continue
+		}
+
+		switch NormalizeValue("GrainEffectSize", word) {
+		case "Small", "Large":
+			size = NormalizeValue("GrainEffectSize", word)
+		default:
+			return "", "", fmt.Errorf("Parsing grain effect failed: Unexpected value: '%s'", input)
+		}
+	}
+
+	if roughness == "" || size == "" {
+		return "", "", fmt.Errorf("Parsing grain effect failed: Expected roughness and size: '%s'", input)
+	}
+
+	return roughness, size, nil
+}
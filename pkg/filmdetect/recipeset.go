@@ -0,0 +1,300 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RecipeSet is an in-memory collection of recipes, indexed by their full
+// name (see Recipe.FullName).  Services can load their recipes into a
+// RecipeSet once, instead of reading the simulation directory for every
+// detection.  A RecipeSet isn't safe for concurrent modification.
+//
+// Recipes are also indexed by film simulation and dynamic range, which lets
+// detection skip the recipes that can't be a close match.
+type RecipeSet struct {
+	recipes      []Recipe
+	byName       map[string]int
+	bySimulation map[string][]int
+	bySimAndDR   map[string][]int
+	prepared     *preparedRecipes
+}
+
+func NewRecipeSet(recipes []Recipe) *RecipeSet {
+	set := &RecipeSet{
+		byName:       map[string]int{},
+		bySimulation: map[string][]int{},
+		bySimAndDR:   map[string][]int{},
+		prepared:     newPreparedRecipes(nil),
+	}
+
+	for _, recipe := range recipes {
+		set.Add(recipe)
+	}
+
+	return set
+}
+
+// LoadRecipeSet reads the recipes of the simulation directories into a new
+// RecipeSet.
+func LoadRecipeSet(simulationDirs []string) (*RecipeSet, error) {
+	recipes, err := GetRecipesFromDirs(simulationDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRecipeSet(recipes), nil
+}
+
+func simulationKey(r Recipe) string {
+	if r.DialectName() != FujifilmDialect {
+		return r.DialectName() + "\x00" + strings.ToLower(r.look())
+	}
+
+	simulation, _ := SplitMonochromeFilter(r.FilmSimulation)
+	return simulation
+}
+
+func simAndDRKey(r Recipe) string {
+	return simulationKey(r) + "\x00" + NormalizeValue("DynamicRange", r.DynamicRange)
+}
+
+// Add adds a recipe to the set, replacing any recipe of the same full name.
+func (s *RecipeSet) Add(recipe Recipe) {
+	if i, ok := s.byName[recipe.FullName()]; ok {
+		s.recipes[i] = recipe
+		s.reindex()
+		return
+	}
+
+	s.recipes = append(s.recipes, recipe)
+	s.index(len(s.recipes) - 1)
+	s.prepared = newPreparedRecipes(s.recipes)
+}
+
+func (s *RecipeSet) index(i int) {
+	recipe := s.recipes[i]
+	s.byName[recipe.FullName()] = i
+
+	// A variant can use another film simulation or dynamic range
+	forms := []Recipe{recipe}
+	for _, variant := range recipe.Variants {
+		if form, err := variant.apply(recipe); err == nil {
+			forms = append(forms, form)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, form := range forms {
+		if key := simulationKey(form); !seen[key] {
+			seen[key] = true
+			s.bySimulation[key] = append(s.bySimulation[key], i)
+		}
+		// A recipe that leaves out the dynamic range, or leaves it to the
+		// camera, goes with any
+		keys := []string{simAndDRKey(form)}
+		if form.IsUnset("DynamicRange") || NormalizeValue("DynamicRange", form.DynamicRange) == AutoDynamicRange {
+			keys = nil
+			for _, dr := range EnumValues["DynamicRange"] {
+				form.DynamicRange = dr
+				keys = append(keys, simAndDRKey(form))
+			}
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				s.bySimAndDR[key] = append(s.bySimAndDR[key], i)
+			}
+		}
+	}
+}
+
+func (s *RecipeSet) reindex() {
+	s.byName = map[string]int{}
+	s.bySimulation = map[string][]int{}
+	s.bySimAndDR = map[string][]int{}
+
+	for i := range s.recipes {
+		s.index(i)
+	}
+	s.prepared = newPreparedRecipes(s.recipes)
+}
+
+// Remove removes the recipe of the given full name, and reports whether it
+// was in the set.
+func (s *RecipeSet) Remove(name string) bool {
+	i, ok := s.byName[name]
+	if !ok {
+		return false
+	}
+
+	s.recipes = append(s.recipes[:i], s.recipes[i+1:]...)
+	s.reindex()
+
+	return true
+}
+
+func (s *RecipeSet) ByName(name string) (Recipe, bool) {
+	i, ok := s.byName[name]
+	if !ok {
+		return Recipe{}, false
+	}
+
+	return s.recipes[i], true
+}
+
+// Filter returns a new set with the recipes for which keep returns true.
+func (s *RecipeSet) Filter(keep func(Recipe) bool) *RecipeSet {
+	filtered := NewRecipeSet(nil)
+
+	for _, recipe := range s.recipes {
+		if keep(recipe) {
+			filtered.Add(recipe)
+		}
+	}
+
+	return filtered
+}
+
+// Recipes returns the recipes of the set, in the order they were added.
+func (s *RecipeSet) Recipes() []Recipe {
+	recipes := make([]Recipe, len(s.recipes))
+	copy(recipes, s.recipes)
+	return recipes
+}
+
+func (s *RecipeSet) Len() int {
+	return len(s.recipes)
+}
+
+// Candidates returns the recipes worth comparing to image: the ones with the
+// same film simulation and dynamic range, or failing that, the same film
+// simulation.  When no recipe shares the film simulation, all recipes are
+// candidates.
+func (s *RecipeSet) Candidates(image Recipe) []Recipe {
+	return pick(s.recipes, s.candidateIndexes(image))
+}
+
+// candidateIndexes returns the indexes of the Candidates of image, or nil
+// for all recipes.
+func (s *RecipeSet) candidateIndexes(image Recipe) []int {
+	indexes := s.bySimAndDR[simAndDRKey(image)]
+	if len(indexes) == 0 {
+		indexes = s.bySimulation[simulationKey(image)]
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	return indexes
+}
+
+// pick returns the recipes at indexes, or all of them for nil.
+func pick(recipes []Recipe, indexes []int) []Recipe {
+	if indexes == nil {
+		return recipes
+	}
+
+	picked := make([]Recipe, 0, len(indexes))
+	for _, i := range indexes {
+		picked = append(picked, recipes[i])
+	}
+
+	return picked
+}
+
+// preparedRecipes keeps recipes the way they're compared to the images of
+// each camera model, see prepareCandidate, so that they are only prepared
+// once rather than for every image.  It's safe for concurrent use.
+type preparedRecipes struct {
+	recipes  []Recipe
+	mu       sync.Mutex
+	byCamera map[string][]Recipe
+}
+
+func newPreparedRecipes(recipes []Recipe) *preparedRecipes {
+	return &preparedRecipes{recipes: recipes, byCamera: map[string][]Recipe{}}
+}
+
+// forCamera returns the recipes prepared for camera, in the same order.
+func (p *preparedRecipes) forCamera(camera string) []Recipe {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prepared, ok := p.byCamera[camera]
+	if !ok {
+		prepared = make([]Recipe, len(p.recipes))
+		for i, recipe := range p.recipes {
+			prepared[i] = prepareCandidate(recipe, camera)
+		}
+		p.byCamera[camera] = prepared
+	}
+
+	return prepared
+}
+
+func DetectFromRecipeSet(set *RecipeSet, image Recipe) ([]Difference, bool, error) {
+	return DetectFromRecipeSetWithOptions(set, image, Options{})
+}
+
+// DetectFromRecipeSetWithOptions only compares image to the Candidates of the
+// set, which is much faster for large sets.
+func DetectFromRecipeSetWithOptions(set *RecipeSet, image Recipe, opts Options) ([]Difference, bool, error) {
+	// The overrides can change which recipes are candidates
+	overridden, err := opts.override(image)
+	if err != nil {
+		return []Difference{}, false, err
+	}
+
+	candidates := pick(set.prepared.forCamera(opts.Camera), set.candidateIndexes(overridden))
+	return detectFromRecipes(candidates, image, opts, true)
+}
+
+// RecipesHash returns a hash of the contents of recipes, which changes
+// whenever a recipe is added, removed or edited, but not when they are read
+// in another order.  Results of detection stored along with it can tell that
+// they are stale.
+func RecipesHash(recipes []Recipe) (string, error) {
+	var encoded []string
+	for _, recipe := range recipes {
+		b, err := json.Marshal(recipe)
+		if err != nil {
+			return "", err
+		}
+		encoded = append(encoded, string(b))
+	}
+	sort.Strings(encoded)
+
+	hash := sha256.New()
+	for _, e := range encoded {
+		hash.Write([]byte(e))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Hash is the RecipesHash of the recipes of the set.
+func (s *RecipeSet) Hash() (string, error) {
+	return RecipesHash(s.recipes)
+}
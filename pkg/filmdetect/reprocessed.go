@@ -0,0 +1,81 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import "strings"
+
+// ReprocessedTagVariants are tags that hold a setting in some images instead
+// of the tag filmdetect reads it from, e.g. in JPEGs converted from RAW, or
+// as older exiftool versions name them.  A variant is only used when the
+// usual tag is missing.
+var ReprocessedTagVariants = map[string][]string{
+	"GrainEffectRoughness": {"GrainEffect"},
+}
+
+// RAWConverters are found in the Software tag of JPEGs converted from RAW on
+// a computer, by the name of the converter.
+var RAWConverters = map[string]string{
+	"X RAW STUDIO":       "X RAW Studio",
+	"RAW FILE CONVERTER": "RAW File Converter",
+}
+
+// withTagVariants returns fields with the ReprocessedTagVariants of missing
+// tags under the usual name.  fields itself isn't changed.
+func withTagVariants(fields map[string]any) map[string]any {
+	var merged map[string]any
+
+	for tag, variants := range ReprocessedTagVariants {
+		if fields[tag] != nil {
+			continue
+		}
+
+		for _, variant := range variants {
+			value := fields[variant]
+			if value == nil {
+				continue
+			}
+
+			if merged == nil {
+				merged = make(map[string]any, len(fields))
+				for k, v := range fields {
+					merged[k] = v
+				}
+			}
+			merged[tag] = value
+			break
+		}
+	}
+
+	if merged == nil {
+		return fields
+	}
+	return merged
+}
+
+// RAWConverter returns the name of the converter an image was converted from
+// RAW with, as its Software tag tells, or "" for images straight from the
+// camera.
+func RAWConverter(software string) string {
+	upper := strings.ToUpper(software)
+	for marker, name := range RAWConverters {
+		if strings.Contains(upper, marker) {
+			return name
+		}
+	}
+
+	return ""
+}
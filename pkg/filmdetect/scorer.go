@@ -0,0 +1,424 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FieldDiff is a recipe setting as compared between the input and a
+// candidate.
+type FieldDiff struct {
+	Field     string      `json:"field"`
+	Input     interface{} `json:"input"`
+	Candidate interface{} `json:"candidate"`
+	Matched   bool        `json:"matched"`
+}
+
+// MarshalJSON adds the label of the setting and its values as FormatValue
+// formats them to the raw values.
+func (f FieldDiff) MarshalJSON() ([]byte, error) {
+	type plain FieldDiff
+	return json.Marshal(struct {
+		plain
+		Label         string `json:"label"`
+		InputText     string `json:"input_text"`
+		CandidateText string `json:"candidate_text"`
+	}{plain(f), FieldLabel(f.Field), FormatValue(f.Field, f.Input), FormatValue(f.Field, f.Candidate)})
+}
+
+// Scorer rates how close a candidate is to the input.  Higher scores are
+// better, and a candidate without any differing fields is a perfect match.
+// Both recipes are normalized before they're passed to Score.
+type Scorer interface {
+	Score(input, candidate Recipe) (float64, []FieldDiff)
+}
+
+// DefaultScorer is used when Options don't name a Scorer.
+var DefaultScorer Scorer = WeightedScorer{}
+
+// CountScorer gives a point for every field that is the same in both recipes.
+type CountScorer struct{}
+
+func (CountScorer) Score(input, candidate Recipe) (float64, []FieldDiff) {
+	diffs := CompareRecipes(input, candidate)
+	return float64(len(candidate.dialect().Fields()) - len(diffs)), diffs
+}
+
+// FieldWeights is how much each setting counts towards the score given by
+// WeightedScorer, as the compare tags of Recipe say.  Settings that aren't
+// listed weigh what their dialect says, or 1.
+var FieldWeights = func() map[string]float64 {
+	weights := map[string]float64{}
+	for name, comparison := range fieldComparisons {
+		if comparison.Weight != 0 {
+			weights[name] = comparison.Weight
+		}
+	}
+
+	return weights
+}()
+
+// Settings weighing at least this much are critical: a candidate that differs
+// in one of them is unlikely to be the recipe that was used.
+const CriticalWeight = 2
+
+func FieldWeight(field string) float64 {
+	if weight, ok := FieldWeights[field]; ok {
+		return weight
+	}
+	if f, ok := dialectField(field); ok && f.Weight != 0 {
+		return f.Weight
+	}
+
+	return 1
+}
+
+func IsCriticalField(field string) bool {
+	if field == WhiteBalanceShiftField {
+		return IsCriticalField("WhiteBalanceRed") || IsCriticalField("WhiteBalanceBlue")
+	}
+
+	return FieldWeight(field) >= CriticalWeight
+}
+
+// WeightedScorer takes the weight of every differing setting off the highest
+// possible score.  It uses FieldWeights unless given its own Weights.  The
+// white balance shift costs its distance on the R/B grid instead, see
+// whiteBalanceShiftPenalty.
+type WeightedScorer struct {
+	Weights map[string]float64
+	// Scores the white balance shift as one setting rather than by
+	// distance, weighing as much as the red and blue shifts on average.  It
+	// matches when the shifts are no further apart on the R/B grid than
+	// this, e.g. 1.5 for one off in both.  Zero scores by distance.
+	WhiteBalanceShiftThreshold float64
+}
+
+func (s WeightedScorer) weight(field string) float64 {
+	weight := 1.0
+	if s.Weights == nil {
+		weight = FieldWeight(field)
+	} else if w, ok := s.Weights[field]; ok {
+		weight = w
+	}
+
+	// The shifts share the weight of one setting when scored as one
+	if s.WhiteBalanceShiftThreshold > 0 && isWhiteBalanceShiftField(field) {
+		weight /= 2
+	}
+
+	return weight
+}
+
+// MaxScore is the score of a perfect match.
+func (s WeightedScorer) MaxScore() float64 {
+	return s.maxScore(ScoringFields())
+}
+
+func (s WeightedScorer) maxScore(fields []string) float64 {
+	score := 0.0
+	for _, field := range fields {
+		score += s.weight(field)
+	}
+
+	return score
+}
+
+func (s WeightedScorer) Score(input, candidate Recipe) (float64, []FieldDiff) {
+	diffs := CompareRecipes(input, candidate)
+
+	var fields []string
+	for _, field := range candidate.dialect().Fields() {
+		fields = append(fields, field.Name)
+	}
+
+	score := s.maxScore(fields)
+	for _, diff := range diffs {
+		if !isWhiteBalanceShiftField(diff.Field) {
+			score -= s.weight(diff.Field)
+		}
+	}
+
+	penalty := s.whiteBalanceShiftPenalty(diffs)
+	if penalty == 0 {
+		// Close enough shifts match
+		diffs = slices.DeleteFunc(diffs, func(diff FieldDiff) bool { return isWhiteBalanceShiftField(diff.Field) })
+	}
+	score -= penalty
+
+	return score, diffs
+}
+
+// whiteBalanceShiftPenalty is what a differing white balance shift costs: its
+// distance on the R/B grid, each step weighing as much as the red and blue
+// shifts do on average, but all of it no more than both of them.  A shift
+// that's one off in both costs less than two settings, and one that's far
+// off in either costs more than one.  With a WhiteBalanceShiftThreshold, it
+// costs the weight of one setting when it's further off than that, and
+// nothing otherwise.
+func (s WeightedScorer) whiteBalanceShiftPenalty(diffs []FieldDiff) float64 {
+	input, candidate := whiteBalanceShifts(diffs)
+	distance := input.Distance(candidate)
+	if distance == 0 {
+		return 0
+	}
+
+	both := s.weight("WhiteBalanceRed") + s.weight("WhiteBalanceBlue")
+	if s.WhiteBalanceShiftThreshold > 0 {
+		if distance <= s.WhiteBalanceShiftThreshold {
+			return 0
+		}
+		return both
+	}
+
+	return math.Min(distance*both/2, both)
+}
+
+// fieldComparison is how a Recipe field is compared, as its compare struct
+// tag says, e.g. `compare:"weight=3,tolerance=1"`:
+//
+//   - weight: how much the field counts towards the score, 1 if not given
+//   - tolerance: how far apart numbers may be and still match
+//   - monochrome: only compared for black and white film simulations
+//   - "-": not compared at all
+type fieldComparison struct {
+	Skip       bool
+	Weight     float64
+	Tolerance  int
+	Monochrome bool
+}
+
+// fieldComparisons are the comparisons of the Recipe fields with a compare
+// tag.  A tag that can't be parsed is a mistake in Recipe, so it panics.
+var fieldComparisons = func() map[string]fieldComparison {
+	comparisons := map[string]fieldComparison{}
+
+	t := reflect.TypeOf(Recipe{})
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("compare")
+		if !ok {
+			continue
+		}
+
+		comparison, err := parseComparison(tag)
+		if err != nil {
+			panic(fmt.Sprintf("Recipe.%s: %v", t.Field(i).Name, err))
+		}
+		comparisons[t.Field(i).Name] = comparison
+	}
+
+	return comparisons
+}()
+
+func parseComparison(tag string) (fieldComparison, error) {
+	var comparison fieldComparison
+	if tag == "-" {
+		comparison.Skip = true
+		return comparison, nil
+	}
+
+	for _, option := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+
+		var err error
+		switch key {
+		case "weight":
+			comparison.Weight, err = strconv.ParseFloat(value, 64)
+		case "tolerance":
+			comparison.Tolerance, err = strconv.Atoi(value)
+		case "monochrome":
+			comparison.Monochrome = true
+		default:
+			return comparison, fmt.Errorf("Unknown compare option '%s'", key)
+		}
+		if err != nil {
+			return comparison, fmt.Errorf("Invalid compare option '%s': %v", option, err)
+		}
+	}
+
+	return comparison, nil
+}
+
+// isMetaField reports whether a Recipe field is left out of scoring.
+func isMetaField(field string) bool {
+	return fieldComparisons[field].Skip
+}
+
+// matches reports whether the value of a Recipe field in an image matches
+// the value in a recipe.
+func matches(field string, input, candidate any) bool {
+	return input == candidate || withinTolerance(field, input, candidate) || autoDynamicRange(field, input, candidate)
+}
+
+// autoDynamicRange reports whether a recipe leaves the dynamic range to the
+// camera, which records the range it chose rather than "Auto".
+func autoDynamicRange(field string, input, candidate any) bool {
+	return field == "DynamicRange" && candidate == AutoDynamicRange && input != AutoDynamicRange
+}
+
+// withinTolerance reports whether two unequal values of a Recipe field still
+// match, being numbers no further apart than its tolerance.
+func withinTolerance(field string, input, candidate any) bool {
+	tolerance := fieldComparisons[field].Tolerance
+	if tolerance == 0 {
+		return false
+	}
+
+	a, aOk := input.(int)
+	b, bOk := candidate.(int)
+	return aOk && bOk && a-b <= tolerance && b-a <= tolerance
+}
+
+// MetaFields returns the names of the Recipe fields that describe the
+// recipe, such as Name, Author and Url.
+func MetaFields() []string {
+	var fields []string
+
+	t := reflect.TypeOf(Recipe{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("filmdetect") == "meta" {
+			fields = append(fields, t.Field(i).Name)
+		}
+	}
+
+	return fields
+}
+
+// RecipeMeta returns the meta fields of a recipe that are set, by their JSON
+// names.
+func RecipeMeta(r Recipe) map[string]any {
+	meta := map[string]any{}
+
+	v := reflect.ValueOf(r)
+	for _, field := range MetaFields() {
+		value := v.FieldByName(field)
+		if value.IsZero() {
+			continue
+		}
+
+		structField, _ := v.Type().FieldByName(field)
+		name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		meta[name] = value.Interface()
+	}
+
+	return meta
+}
+
+// ScoringFields returns the names of the Recipe fields that are compared.
+func ScoringFields() []string {
+	var fields []string
+
+	t := reflect.TypeOf(Recipe{})
+	for i := 0; i < t.NumField(); i++ {
+		if !isMetaField(t.Field(i).Name) {
+			fields = append(fields, t.Field(i).Name)
+		}
+	}
+
+	return fields
+}
+
+// CompareRecipes returns the settings that differ between two recipes.  The
+// monochrome settings are only compared when either recipe is black and
+// white, and settings the candidate leaves out aren't compared at all.
+func CompareRecipes(input, candidate Recipe) []FieldDiff {
+	result := []FieldDiff{}
+	for _, field := range CompareAllFields(input, candidate) {
+		if !field.Matched {
+			result = append(result, field)
+		}
+	}
+
+	return result
+}
+
+// CompareAllFields returns every setting compared by CompareRecipes, whether
+// it differs or not.  Settings the candidate leaves out aren't compared.
+// Recipes of other dialects than FujifilmDialect are compared by theirs, and
+// recipes of different dialects only differ in the dialect.
+func CompareAllFields(input, candidate Recipe) []FieldDiff {
+	if input.DialectName() != candidate.DialectName() {
+		return []FieldDiff{{Field: "Dialect", Input: input.DialectName(), Candidate: candidate.DialectName()}}
+	}
+
+	return candidate.dialect().Compare(input, candidate)
+}
+
+// Options tune detection.  The zero value gives the default behavior.
+type Options struct {
+	// Rates candidates; DefaultScorer if nil
+	Scorer Scorer
+	// The camera model of the image, which picks the recipe variants to
+	// compare with
+	Camera string
+	// Called as detection progresses; may be nil.  It's called from the
+	// goroutine doing the detection, and holds it up until it returns.
+	Events func(Event)
+	// Settings to compare instead of the ones read from the image, e.g.
+	// "DynamicRange": "400" for an edited export that lost the tag.  Keys
+	// are anything RecipeFieldName accepts, and values are parsed like
+	// SetField parses them.
+	Overrides map[string]string
+	// Read images of any camera, see Extractor.Force
+	Force bool
+	// Compare the settings that can be read when some can't, see
+	// Extractor.Lenient
+	Lenient bool
+	// Return this many of the closest candidates, rather than the perfect
+	// match or the ones sharing the top score
+	Top int
+}
+
+// extract reads the settings of an image like Extract, forced or lenient if
+// the options say so.
+func (o Options) extract(filename string) (ExtractionResult, error) {
+	e, err := NewExtractor()
+	if err != nil {
+		return ExtractionResult{}, err
+	}
+	defer e.Close()
+	e.Force = o.Force
+	e.Lenient = o.Lenient
+
+	return e.Extract(filename)
+}
+
+// override returns the settings of an image with the Overrides applied.
+func (o Options) override(image Recipe) (Recipe, error) {
+	for field, value := range o.Overrides {
+		if err := SetField(&image, field, value); err != nil {
+			return image, err
+		}
+	}
+
+	return image, nil
+}
+
+func (o Options) scorer() Scorer {
+	if o.Scorer == nil {
+		return DefaultScorer
+	}
+
+	return o.Scorer
+}
@@ -0,0 +1,240 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// scoringRecipe is a color recipe with every setting set.
+var scoringRecipe = Recipe{
+	FilmSimulation:       "Classic Chrome",
+	GrainEffectRoughness: "Weak",
+	GrainEffectSize:      "Small",
+	ColorChromeEffect:    "Strong",
+	ColorChromeFXBlue:    "Off",
+	SmoothSkinEffect:     "Off",
+	WhiteBalanceMode:     "Daylight",
+	WhiteBalanceRed:      2,
+	WhiteBalanceBlue:     -5,
+	DynamicRange:         "DR200",
+	DRangePriority:       "Off",
+	Highlights:           -1,
+	Shadows:              1,
+	Color:                2,
+	Sharpness:            -2,
+	NoiseReduction:       -4,
+	Clarity:              -2,
+}
+
+// withSettings returns scoringRecipe changed by change.
+func withSettings(change func(r *Recipe)) Recipe {
+	r := scoringRecipe
+	change(&r)
+	return r
+}
+
+func mismatchNames(d Difference) []string {
+	var names []string
+	for _, field := range d.Mismatches() {
+		names = append(names, field.Field)
+	}
+	return names
+}
+
+func TestWeightedScorer(t *testing.T) {
+	threshold := WeightedScorer{WhiteBalanceShiftThreshold: 1.5}
+
+	tests := []struct {
+		name      string
+		scorer    WeightedScorer
+		input     Recipe
+		candidate Recipe
+		// Taken off the MaxScore of the scorer
+		penalty    float64
+		mismatches []string
+	}{
+		{
+			name:      "same",
+			input:     scoringRecipe,
+			candidate: scoringRecipe,
+		},
+		{
+			name:       "film simulation",
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.FilmSimulation = "Classic Negative" }),
+			penalty:    3,
+			mismatches: []string{"FilmSimulation"},
+		},
+		{
+			name:       "critical before minor",
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.Color = 4; r.DynamicRange = "DR400" }),
+			penalty:    3,
+			mismatches: []string{"DynamicRange", "Color"},
+		},
+		{
+			name:      "auto dynamic range",
+			input:     withSettings(func(r *Recipe) { r.DynamicRange = "DR400" }),
+			candidate: withSettings(func(r *Recipe) { r.DynamicRange = AutoDynamicRange }),
+		},
+		{
+			name:       "auto dynamic range of the image",
+			input:      withSettings(func(r *Recipe) { r.DynamicRange = AutoDynamicRange }),
+			candidate:  scoringRecipe,
+			penalty:    2,
+			mismatches: []string{"DynamicRange"},
+		},
+		{
+			name:       "shift one off",
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.WhiteBalanceRed = 3 }),
+			penalty:    2,
+			mismatches: []string{"WhiteBalanceRed"},
+		},
+		{
+			name:       "shift one off in both",
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.WhiteBalanceRed = 3; r.WhiteBalanceBlue = -4 }),
+			penalty:    2 * math.Sqrt2,
+			mismatches: []string{"WhiteBalanceRed", "WhiteBalanceBlue"},
+		},
+		{
+			name:       "shift far off",
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.WhiteBalanceRed = -7 }),
+			penalty:    4,
+			mismatches: []string{"WhiteBalanceRed"},
+		},
+		{
+			name:      "shift within the threshold",
+			scorer:    threshold,
+			input:     scoringRecipe,
+			candidate: withSettings(func(r *Recipe) { r.WhiteBalanceRed = 3; r.WhiteBalanceBlue = -4 }),
+		},
+		{
+			name:       "shift beyond the threshold",
+			scorer:     threshold,
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.WhiteBalanceRed = 4 }),
+			penalty:    2,
+			mismatches: []string{"WhiteBalanceRed"},
+		},
+		{
+			name:      "unset in the candidate",
+			input:     scoringRecipe,
+			candidate: withSettings(func(r *Recipe) { r.Clarity = 3; r.Unset = []string{"Clarity"} }),
+		},
+		{
+			name:      "unset in the image",
+			input:     withSettings(func(r *Recipe) { r.Sharpness = 0; r.Unset = []string{"Sharpness"} }),
+			candidate: scoringRecipe,
+		},
+		{
+			name:       "unset shift",
+			input:      scoringRecipe,
+			candidate:  withSettings(func(r *Recipe) { r.WhiteBalanceRed = 0; r.WhiteBalanceBlue = -3; r.Unset = []string{"WhiteBalanceRed"} }),
+			penalty:    4,
+			mismatches: []string{"WhiteBalanceBlue"},
+		},
+		{
+			name:      "monochrome settings of a color recipe",
+			input:     scoringRecipe,
+			candidate: withSettings(func(r *Recipe) { r.ToningWarmCool = 3 }),
+		},
+	}
+
+	for _, test := range tests {
+		d := DifferenceWithScorer(test.input, test.candidate, test.scorer)
+
+		want := test.scorer.MaxScore() - test.penalty
+		if math.Abs(d.Score()-want) > 1e-9 {
+			t.Errorf("%s: scored %v, expected %v", test.name, d.Score(), want)
+		}
+		if got := mismatchNames(d); !slices.Equal(got, test.mismatches) {
+			t.Errorf("%s: mismatches are %v, expected %v", test.name, got, test.mismatches)
+		}
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	comparison := fieldComparisons["Highlights"]
+	defer func() { fieldComparisons["Highlights"] = comparison }()
+
+	tagged, err := parseComparison("tolerance=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldComparisons["Highlights"] = tagged
+
+	tests := []struct {
+		highlights int
+		matched    bool
+	}{
+		{-1, true},
+		{0, true},
+		{-2, true},
+		{1, false},
+		{-3, false},
+	}
+
+	for _, test := range tests {
+		candidate := withSettings(func(r *Recipe) { r.Highlights = test.highlights })
+		d := DifferenceFromRecipes(scoringRecipe, candidate)
+
+		matched := !slices.Contains(mismatchNames(d), "Highlights")
+		if matched != test.matched {
+			t.Errorf("Highlights %d against -1 matched: %v, expected %v", test.highlights, matched, test.matched)
+		}
+
+		want := WeightedScorer{}.MaxScore()
+		if !test.matched {
+			want--
+		}
+		if d.Score() != want {
+			t.Errorf("Highlights %d against -1 scored %v, expected %v", test.highlights, d.Score(), want)
+		}
+	}
+}
+
+func TestParseComparison(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want fieldComparison
+		err  bool
+	}{
+		{"-", fieldComparison{Skip: true}, false},
+		{"weight=3", fieldComparison{Weight: 3}, false},
+		{"weight=2, tolerance=1", fieldComparison{Weight: 2, Tolerance: 1}, false},
+		{"monochrome", fieldComparison{Monochrome: true}, false},
+		{"tolerance=one", fieldComparison{}, true},
+		{"fuzzy", fieldComparison{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseComparison(test.tag)
+		if (err != nil) != test.err {
+			t.Errorf("parseComparison(%q) gave error %v", test.tag, err)
+			continue
+		}
+		if err == nil && got != test.want {
+			t.Errorf("parseComparison(%q) gave %+v, expected %+v", test.tag, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrUnsigned is returned when a download that has to be signed isn't.
+var ErrUnsigned = errors.New("Not signed")
+
+// The file extension of minisign signatures, which are downloaded from the
+// URL of the signed file with it appended
+const SignatureExtension = ".minisig"
+
+// PublicKey is a minisign public key that recipes are trusted from.
+type PublicKey struct {
+	ID  [8]byte
+	Key ed25519.PublicKey
+	// Where the key was read from
+	Source string
+}
+
+func (k PublicKey) String() string {
+	return fmt.Sprintf("%X", reverse(k.ID[:]))
+}
+
+// ParsePublicKey reads a key in the format of the .pub files of minisign,
+// with or without the untrusted comment.
+func ParsePublicKey(text []byte) (PublicKey, error) {
+	var key PublicKey
+
+	raw, err := base64.StdEncoding.DecodeString(minisignLine(string(text), 0))
+	if err != nil {
+		return key, fmt.Errorf("Invalid public key: %v", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return key, fmt.Errorf("Invalid public key, expected a minisign Ed25519 key")
+	}
+
+	copy(key.ID[:], raw[2:10])
+	key.Key = ed25519.PublicKey(raw[10:])
+	return key, nil
+}
+
+// ReadPublicKeys reads the public keys of files.
+func ReadPublicKeys(files []string) ([]PublicKey, error) {
+	var keys []PublicKey
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := ParsePublicKey(contents)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		key.Source = file
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// TrustedKeysDir is where the keys trusted by every sync and update live, as
+// minisign .pub files.
+func TrustedKeysDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "filmdetect", "trusted-keys"), nil
+}
+
+// TrustedKeys reads the .pub files of dir.  A missing dir has no keys.
+func TrustedKeys(dir string) ([]PublicKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	return ReadPublicKeys(files)
+}
+
+// VerifySignature checks that signature, the contents of a minisign .minisig
+// file, is a signature of message by one of keys, trusted comment included.
+// Both the signatures of a BLAKE2b hash of the file, which minisign makes by
+// default, and the legacy ones of the whole file are supported.
+func VerifySignature(keys []PublicKey, message, signature []byte) error {
+	text := string(signature)
+
+	raw, err := base64.StdEncoding.DecodeString(minisignLine(text, 0))
+	if err != nil {
+		return fmt.Errorf("Invalid signature: %v", err)
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("Invalid signature")
+	}
+
+	signed := message
+	switch string(raw[:2]) {
+	case "Ed":
+	case "ED":
+		hash := blake2b.Sum512(message)
+		signed = hash[:]
+	default:
+		return fmt.Errorf("Invalid signature, unknown algorithm %q", raw[:2])
+	}
+
+	var id [8]byte
+	copy(id[:], raw[2:10])
+	sig := raw[10:]
+
+	comment, ok := strings.CutPrefix(minisignLine(text, 1), "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("Invalid signature, missing the trusted comment")
+	}
+	global, err := base64.StdEncoding.DecodeString(minisignLine(text, 2))
+	if err != nil {
+		return fmt.Errorf("Invalid signature: %v", err)
+	}
+
+	for _, key := range keys {
+		if key.ID != id {
+			continue
+		}
+
+		if !ed25519.Verify(key.Key, signed, sig) {
+			return fmt.Errorf("Signature by key %s doesn't match", key)
+		}
+		if !ed25519.Verify(key.Key, append(bytes.Clone(sig), comment...), global) {
+			return fmt.Errorf("Trusted comment of the signature by key %s doesn't match", key)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("Signed by key %X, which isn't trusted", reverse(id[:]))
+}
+
+// verifyDownload downloads the signature of body, the download of rawURL,
+// from rawURL + SignatureExtension and checks it against keys.
+func verifyDownload(ctx context.Context, client *http.Client, rawURL string, body []byte, keys []PublicKey) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("%w, no keys are trusted", ErrUnsigned)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL+SignatureExtension, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnsigned
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Downloading the signature failed: %s", resp.Status)
+	}
+
+	signature, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return VerifySignature(keys, body, signature)
+}
+
+// minisignLine returns the nth line of a minisign file, not counting
+// untrusted comments.
+func minisignLine(text string, n int) string {
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		if n == 0 {
+			return line
+		}
+		n--
+	}
+
+	return ""
+}
+
+// reverse returns b back to front, since minisign prints key IDs as
+// little-endian numbers.
+func reverse(b []byte) []byte {
+	reversed := make([]byte, len(b))
+	for i := range b {
+		reversed[len(b)-1-i] = b[i]
+	}
+	return reversed
+}
@@ -0,0 +1,133 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testKey makes a minisign key pair with id.
+func testKey(t *testing.T, id byte) (PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := append([]byte("Ed"), id, 0, 0, 0, 0, 0, 0, 0)
+	key, err := ParsePublicKey([]byte("untrusted comment: test key\n" + base64.StdEncoding.EncodeToString(append(raw, public...)) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, private
+}
+
+// sign makes a minisign signature of message, of its BLAKE2b hash if
+// prehashed, like minisign does without -l.
+func sign(key PublicKey, private ed25519.PrivateKey, message []byte, prehashed bool) []byte {
+	algorithm := "Ed"
+	if prehashed {
+		hash := blake2b.Sum512(message)
+		message = hash[:]
+		algorithm = "ED"
+	}
+
+	sig := ed25519.Sign(private, message)
+	comment := "timestamp:1791000000"
+	global := ed25519.Sign(private, append(append([]byte{}, sig...), comment...))
+
+	raw := append(append([]byte(algorithm), key.ID[:]...), sig...)
+	return []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw), comment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, private := testKey(t, 1)
+	other, otherPrivate := testKey(t, 2)
+	message := []byte(`[{"Name": "Kodachrome 64"}]`)
+
+	for _, prehashed := range []bool{false, true} {
+		signature := sign(key, private, message, prehashed)
+
+		if err := VerifySignature([]PublicKey{other, key}, message, signature); err != nil {
+			t.Errorf("prehashed %v: %v", prehashed, err)
+		}
+		if err := VerifySignature([]PublicKey{key}, []byte(`[]`), signature); err == nil {
+			t.Errorf("prehashed %v: signature of another message verified", prehashed)
+		}
+		if err := VerifySignature([]PublicKey{other}, message, signature); err == nil {
+			t.Errorf("prehashed %v: signature by an untrusted key verified", prehashed)
+		}
+		if err := VerifySignature([]PublicKey{other}, message, sign(other, otherPrivate, message, prehashed)); err != nil {
+			t.Errorf("prehashed %v: %v", prehashed, err)
+		}
+	}
+}
+
+func TestFetchReleaseSignature(t *testing.T) {
+	key, private := testKey(t, 1)
+	manifest := []byte(`{"version": "2026.10", "url": "recipes-2026.10.tar.gz", "sha256": "00"}`)
+
+	signed := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			w.Write(manifest)
+		case "/manifest.json" + SignatureExtension:
+			if !signed {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(sign(key, private, manifest, true))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	manifestURL := server.URL + "/manifest.json"
+
+	release, err := FetchRelease(context.Background(), manifestURL, []PublicKey{key}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := server.URL + "/recipes-2026.10.tar.gz"; release.URL != want {
+		t.Errorf("URL = %q, want %q", release.URL, want)
+	}
+
+	if _, err := FetchRelease(context.Background(), manifestURL, nil, false); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("without trusted keys: err = %v, want ErrUnsigned", err)
+	}
+
+	signed = false
+	if _, err := FetchRelease(context.Background(), manifestURL, []PublicKey{key}, false); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned: err = %v, want ErrUnsigned", err)
+	}
+	if _, err := FetchRelease(context.Background(), manifestURL, nil, true); err != nil {
+		t.Errorf("insecure: %v", err)
+	}
+}
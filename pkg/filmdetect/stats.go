@@ -0,0 +1,216 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The extensions of the image files GetImageFiles picks up: JPEG, and HEIF,
+// which newer bodies save as .HIF and phones as .HEIC.
+var ImageExtensions = []string{".jpg", ".jpeg", ".hif", ".heif", ".heic"}
+
+// GetImageFiles returns the images in dir and all of its subdirectories.
+func GetImageFiles(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if HasExtension(path, ImageExtensions...) {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	sort.Strings(files)
+
+	return files, err
+}
+
+// DetectionRecord is the outcome of running detection on a single image.
+type DetectionRecord struct {
+	Filename     string
+	Extraction   ExtractionResult
+	Differences  []Difference
+	PerfectMatch bool
+	Err          error
+}
+
+// Best returns the closest candidate, if there is one.
+func (r DetectionRecord) Best() (Difference, bool) {
+	if len(r.Differences) == 0 {
+		return Difference{}, false
+	}
+
+	return r.Differences[0], true
+}
+
+// DetectFiles runs detection on every file, sharing one exiftool process.
+// Errors concerning a single file are recorded in its DetectionRecord rather
+// than aborting the whole run.
+func DetectFiles(recipes []Recipe, filenames []string) ([]DetectionRecord, error) {
+	return DetectFilesWithProgress(recipes, filenames, nil)
+}
+
+// DetectFilesWithProgress is DetectFiles, calling progress after each file
+// with the record of that file.
+func DetectFilesWithProgress(recipes []Recipe, filenames []string, progress func(DetectionRecord)) ([]DetectionRecord, error) {
+	opts := Options{}
+	if progress != nil {
+		opts.Events = func(event Event) {
+			if event.Kind == FileDone {
+				progress(*event.Record)
+			}
+		}
+	}
+
+	return DetectFilesWithOptions(recipes, filenames, opts)
+}
+
+// DetectFilesWithOptions is DetectFiles with options.  The camera of every
+// file is the one it was taken with, unless opts name one.  Progress is
+// reported to opts.Events with FileStarted, CandidateCompared and FileDone
+// events.
+func DetectFilesWithOptions(recipes []Recipe, filenames []string, opts Options) ([]DetectionRecord, error) {
+	var records []DetectionRecord
+
+	extractor, err := NewExtractor()
+	if err != nil {
+		return records, err
+	}
+	defer extractor.Close()
+	extractor.Force = opts.Force
+	extractor.Lenient = opts.Lenient
+
+	// Most files are of the same few cameras
+	prepared := newPreparedRecipes(recipes)
+
+	for i, filename := range filenames {
+		fileOpts := opts.forFile(filename)
+		fileOpts.emit(Event{Kind: FileStarted, Index: i + 1, Total: len(filenames)})
+
+		record := DetectionRecord{Filename: filename}
+
+		record.Extraction, record.Err = extractor.Extract(filename)
+		if record.Err == nil {
+			if fileOpts.Camera == "" {
+				fileOpts.Camera = record.Extraction.Model
+			}
+			record.Differences, record.PerfectMatch, record.Err = detectFromRecipes(prepared.forCamera(fileOpts.Camera), record.Extraction.Recipe, fileOpts, true)
+		}
+
+		records = append(records, record)
+
+		fileOpts.emit(Event{Kind: FileDone, Index: i + 1, Total: len(filenames), Record: &record})
+	}
+
+	return records, nil
+}
+
+// Summary aggregates the detection records of a group of images.
+type Summary struct {
+	Images int
+	// Images that were compared to a recipe, whose best scores TotalScore
+	// adds up
+	Scored int
+	// How many times each recipe was the best good match, by its FullName
+	RecipeCounts map[string]int
+	// Images for which no recipe was a good match, or detection failed
+	Unmatched  []string
+	TotalScore float64
+}
+
+// AverageScore is the average best score of the images that were compared
+// to a recipe.  Images for which detection failed don't count.
+func (s Summary) AverageScore() float64 {
+	if s.Scored == 0 {
+		return 0
+	}
+
+	return s.TotalScore / float64(s.Scored)
+}
+
+// Summarize aggregates records into one Summary per group, as named by
+// groupBy.
+func Summarize(records []DetectionRecord, groupBy func(DetectionRecord) string) map[string]*Summary {
+	summaries := map[string]*Summary{}
+
+	for _, record := range records {
+		key := groupBy(record)
+
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &Summary{RecipeCounts: map[string]int{}}
+			summaries[key] = summary
+		}
+
+		summary.Images++
+
+		best, ok := record.Best()
+		if record.Err != nil || !ok || !best.IsGoodMatch() {
+			summary.Unmatched = append(summary.Unmatched, record.Filename)
+		}
+
+		if record.Err != nil || !ok {
+			continue
+		}
+
+		summary.Scored++
+		summary.TotalScore += best.Score()
+
+		if best.IsGoodMatch() {
+			summary.RecipeCounts[best.Candidate.FullName()]++
+		}
+	}
+
+	return summaries
+}
+
+// UnusedRecipes returns the recipes that weren't a good match for any of the
+// records, in their original order.
+func UnusedRecipes(recipes []Recipe, records []DetectionRecord) []Recipe {
+	used := map[string]bool{}
+	for _, record := range records {
+		if record.Err != nil {
+			continue
+		}
+		for _, diff := range record.Differences {
+			if diff.IsGoodMatch() {
+				used[diff.Candidate.FullName()] = true
+			}
+		}
+	}
+
+	var unused []Recipe
+	for _, recipe := range recipes {
+		if !used[recipe.FullName()] {
+			unused = append(unused, recipe)
+		}
+	}
+
+	return unused
+}
@@ -0,0 +1,62 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	input := Recipe{FilmSimulation: "Classic Chrome", DynamicRange: "DR200", Color: 2}
+	near := Recipe{Name: "Kodachrome", Collection: "a", FilmSimulation: "Classic Chrome", DynamicRange: "DR200", Color: 1}
+	same := Recipe{Name: "Kodachrome", Collection: "b", FilmSimulation: "Classic Chrome", DynamicRange: "DR200", Color: 2}
+
+	nearDiff := DifferenceFromRecipes(input, near)
+	sameDiff := DifferenceFromRecipes(input, same)
+
+	records := []DetectionRecord{
+		{Filename: "1.jpg", Differences: []Difference{nearDiff}},
+		{Filename: "2.jpg", Differences: []Difference{sameDiff}},
+		{Filename: "3.jpg", Err: errors.New("Unknown file type")},
+		{Filename: "4.jpg"},
+	}
+
+	summary := Summarize(records, func(DetectionRecord) string { return "" })[""]
+
+	if summary.Images != 4 || summary.Scored != 2 {
+		t.Errorf("Summary counts %d images and %d scored, expected 4 and 2", summary.Images, summary.Scored)
+	}
+
+	// Images that weren't compared don't drag the average down
+	want := (nearDiff.Score() + sameDiff.Score()) / 2
+	if got := summary.AverageScore(); math.Abs(got-want) > 1e-9 {
+		t.Errorf("AverageScore gave %v, expected %v", got, want)
+	}
+
+	// Recipes of the same name in different collections are counted apart
+	for _, name := range []string{"a/Kodachrome", "b/Kodachrome"} {
+		if summary.RecipeCounts[name] != 1 {
+			t.Errorf("%s was counted %d times, expected once", name, summary.RecipeCounts[name])
+		}
+	}
+
+	if len(summary.Unmatched) != 2 {
+		t.Errorf("Unmatched are %v, expected 3.jpg and 4.jpg", summary.Unmatched)
+	}
+}
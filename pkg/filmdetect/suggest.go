@@ -0,0 +1,58 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SuggestRecipe turns the settings read from an image into a new recipe,
+// named after its film simulation and the day the image was taken, or the
+// image file when the date is unknown.  Settings the camera doesn't have are
+// left out, so that the recipe matches newer cameras too.
+func SuggestRecipe(extraction ExtractionResult, filename string) Recipe {
+	recipe := extraction.Recipe
+	recipe.Collection = ""
+
+	base := filepath.Base(filename)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	if extraction.CaptureTime.IsZero() {
+		recipe.Name = fmt.Sprintf("%s %s", recipe.look(), base)
+	} else {
+		recipe.Name = fmt.Sprintf("%s %s", recipe.look(), extraction.CaptureTime.Format("2006-01-02"))
+		recipe.Created = extraction.CaptureTime.Format("2006-01-02")
+	}
+	recipe.Notes = fmt.Sprintf("Settings of %s", filepath.Base(filename))
+
+	if recipe.DialectName() != FujifilmDialect {
+		return recipe
+	}
+
+	recipe.Unset = nil
+	if extraction.Model != "" {
+		for _, field := range ScoringFields() {
+			if !HasField(extraction.Model, field) {
+				recipe.Unset = append(recipe.Unset, field)
+			}
+		}
+	}
+
+	return recipe
+}
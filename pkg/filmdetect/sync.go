@@ -0,0 +1,203 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A Fetcher downloads recipes from somewhere other than the simulation dir.
+type Fetcher interface {
+	Fetch(ctx context.Context) ([]Recipe, error)
+}
+
+// URLFetcher downloads a JSON array of recipes, in the same format as
+// recipe files.  The array has to be signed by one of Keys, with the
+// signature next to it at URL + SignatureExtension, unless Insecure is set.
+type URLFetcher struct {
+	URL      string
+	Client   *http.Client
+	Keys     []PublicKey
+	Insecure bool
+}
+
+func (f URLFetcher) Fetch(ctx context.Context) ([]Recipe, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Downloading %s failed: %s", f.URL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.Insecure {
+		if err := verifyDownload(ctx, client, f.URL, body, f.Keys); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.URL, err)
+		}
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(decodeText(body), &items); err != nil {
+		return nil, fmt.Errorf("%s: %v", f.URL, err)
+	}
+
+	var recipes []Recipe
+	for i, item := range items {
+		recipe, err := GetRecipeFromJson(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: recipe %d: %v", f.URL, i+1, err)
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes, nil
+}
+
+// Source is a published collection of recipes that can be synced into a
+// simulation dir.  There are no well-known sources, since none of the
+// collections publishes a machine-readable dump of its recipes yet.
+type Source struct {
+	// Credited on recipes that don't name their own author and URL
+	Author string
+	Url    string
+	// Where a machine-readable dump of the recipes can be downloaded
+	DumpURL string
+	// The dump has to be signed by one of Keys, unless Insecure is set
+	Keys     []PublicKey
+	Insecure bool
+}
+
+// Fetch downloads the dump of the source, and credits the source on recipes
+// that don't name their own author and URL.
+func (s Source) Fetch(ctx context.Context) ([]Recipe, error) {
+	if s.DumpURL == "" {
+		return nil, fmt.Errorf("Source has no download URL")
+	}
+
+	recipes, err := URLFetcher{URL: s.DumpURL, Keys: s.Keys, Insecure: s.Insecure}.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range recipes {
+		if recipes[i].Author == "" {
+			recipes[i].Author = s.Author
+		}
+		if recipes[i].Url == "" {
+			recipes[i].Url = s.Url
+		}
+	}
+
+	return recipes, nil
+}
+
+// RecipeFilename turns the name of a recipe into a file name.  A name without
+// any ASCII letters or digits is named after its hash instead.
+func RecipeFilename(name string) string {
+	slug := regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "-")
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		sum := sha256.Sum256([]byte(name))
+		slug = "recipe-" + hex.EncodeToString(sum[:6])
+	}
+
+	return slug + ".json"
+}
+
+// WriteRecipeFile saves a recipe in the format read by ParseRecipeFile.  The
+// collection isn't written, since it comes from the directory of the file.
+func WriteRecipeFile(filename string, recipe Recipe) error {
+	recipe.Collection = ""
+
+	contents, err := EncodeRecipeFile(recipe)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, contents, 0644)
+}
+
+// SyncRecipes writes the recipes fetched by fetcher to dir, one file per
+// recipe, replacing the files of earlier syncs.  It returns the files written.
+func SyncRecipes(ctx context.Context, fetcher Fetcher, dir string) ([]string, error) {
+	recipes, err := fetcher.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return WriteRecipeFiles(recipes, dir)
+}
+
+// WriteRecipeFiles writes recipes to dir, one file per recipe named after it,
+// replacing files of the same name.  It returns the files written.  Nothing
+// is written if two recipes would get the same file name.
+func WriteRecipeFiles(recipes []Recipe, dir string) ([]string, error) {
+	var files []string
+	names := map[string]string{}
+	for _, recipe := range recipes {
+		if recipe.Name == "" {
+			return nil, fmt.Errorf("Can't write a recipe without a name")
+		}
+
+		filename := RecipeFilename(recipe.Name)
+		if other, ok := names[filename]; ok {
+			return nil, fmt.Errorf("Recipes '%s' and '%s' would both be written to %s", other, recipe.Name, filename)
+		}
+		names[filename] = recipe.Name
+
+		files = append(files, filepath.Join(dir, filename))
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	for i, recipe := range recipes {
+		if err := WriteRecipeFile(files[i], recipe); err != nil {
+			return files[:i], err
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,79 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecipeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Kodachrome 64", "kodachrome-64.json"},
+		{"  Classic Negative! ", "classic-negative.json"},
+		{"Café Crème", "caf-cr-me.json"},
+	}
+
+	for _, test := range tests {
+		if got := RecipeFilename(test.name); got != test.want {
+			t.Errorf("RecipeFilename(%q) gave %q, expected %q", test.name, got, test.want)
+		}
+	}
+
+	// Names without ASCII letters or digits are named after their hash
+	hashed := regexp.MustCompile(`^recipe-[0-9a-f]{12}\.json$`)
+	for _, name := range []string{"夜の街", "!!!"} {
+		if got := RecipeFilename(name); !hashed.MatchString(got) {
+			t.Errorf("RecipeFilename(%q) gave %q, expected a hash", name, got)
+		}
+	}
+	if RecipeFilename("夜の街") == RecipeFilename("朝の街") {
+		t.Error("RecipeFilename gave two names the same hash")
+	}
+}
+
+func TestWriteRecipeFilesDuplicates(t *testing.T) {
+	dir := t.TempDir()
+
+	recipes := []Recipe{
+		{Name: "Portra 400", FilmSimulation: "Classic Negative"},
+		{Name: "Portra-400", FilmSimulation: "Classic Chrome"},
+	}
+
+	_, err := WriteRecipeFiles(recipes, dir)
+	if err == nil || !strings.Contains(err.Error(), "portra-400.json") {
+		t.Fatalf("WriteRecipeFiles gave %v, expected an error naming portra-400.json", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("WriteRecipeFiles wrote %d files, expected none", len(entries))
+	}
+
+	files, err := WriteRecipeFiles(recipes[:1], dir)
+	if err != nil || len(files) != 1 {
+		t.Errorf("WriteRecipeFiles gave %v, %v, expected one file", files, err)
+	}
+}
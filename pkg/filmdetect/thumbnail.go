@@ -0,0 +1,39 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// ReadThumbnail returns the JPEG preview the camera embedded in an image.  It
+// returns no bytes when the image has no preview.  HEIF files some phones
+// make only have a larger preview image, which is returned instead.
+func ReadThumbnail(filename string) ([]byte, error) {
+	for _, tag := range []string{"-ThumbnailImage", "-PreviewImage"} {
+		out, err := exec.Command("exiftool", "-b", tag, filename).Output()
+		if err != nil {
+			return nil, fmt.Errorf("Reading the thumbnail of %s failed: %v", filename, err)
+		}
+		if len(out) > 0 {
+			return out, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,260 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The environment variable `filmdetect update` reads the release manifest URL
+// from, unless one is passed with --url.
+const UpdateURLEnv = "FILMDETECT_UPDATE_URL"
+
+// The file in the database dir that records the installed release
+const installedFile = "installed.json"
+
+// DatabaseRelease describes a published release of the recipe database, as
+// read from its manifest:
+//
+//	{"version": "2026.10", "url": "recipes-2026.10.tar.gz", "sha256": "..."}
+//
+// URL is the bundle of recipes, laid out like a simulation dir.  A relative
+// URL is resolved against the manifest.  The manifest is signed with
+// minisign, with the signature next to it at its URL + SignatureExtension,
+// and the checksum of the bundle in it vouches for the bundle.
+type DatabaseRelease struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	// The bundle in the database dir, once installed
+	File string `json:"file,omitempty"`
+}
+
+// DatabaseDir is where `filmdetect update` installs the recipe database.
+func DatabaseDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "filmdetect", "recipes"), nil
+}
+
+// FetchRelease downloads the release manifest at manifestURL, which has to be
+// signed by one of keys, unless insecure is set.
+func FetchRelease(ctx context.Context, manifestURL string, keys []PublicKey, insecure bool) (DatabaseRelease, error) {
+	var release DatabaseRelease
+
+	body, err := download(ctx, manifestURL)
+	if err != nil {
+		return release, err
+	}
+
+	if !insecure {
+		if err := verifyDownload(ctx, http.DefaultClient, manifestURL, body, keys); err != nil {
+			return release, fmt.Errorf("%s: %w", manifestURL, err)
+		}
+	}
+
+	if err := json.Unmarshal(body, &release); err != nil {
+		return release, fmt.Errorf("%s: %v", manifestURL, err)
+	}
+	if release.Version == "" || release.URL == "" || release.SHA256 == "" {
+		return release, fmt.Errorf("%s: Manifest needs a version, url and sha256", manifestURL)
+	}
+
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return release, err
+	}
+	ref, err := url.Parse(release.URL)
+	if err != nil {
+		return release, fmt.Errorf("%s: %v", manifestURL, err)
+	}
+	release.URL = base.ResolveReference(ref).String()
+
+	return release, nil
+}
+
+// InstalledRelease returns the release installed into dir, if any.
+func InstalledRelease(dir string) (DatabaseRelease, bool, error) {
+	var release DatabaseRelease
+
+	contents, err := os.ReadFile(filepath.Join(dir, installedFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return release, false, nil
+	}
+	if err != nil {
+		return release, false, err
+	}
+
+	if err := json.Unmarshal(contents, &release); err != nil {
+		return release, false, fmt.Errorf("%s: %v", filepath.Join(dir, installedFile), err)
+	}
+
+	return release, true, nil
+}
+
+// InstallRelease downloads the bundle of release, checks it against the
+// checksum of the manifest and that its recipes load, and only then replaces
+// the database installed into dir.
+func InstallRelease(ctx context.Context, release DatabaseRelease, dir string) ([]Recipe, error) {
+	body, err := download(ctx, release.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), release.SHA256) {
+		return nil, fmt.Errorf("%s: Checksum mismatch, expected %s, got %s", release.URL, release.SHA256, hex.EncodeToString(sum[:]))
+	}
+
+	name := bundleName(release.URL)
+	if name == "" {
+		return nil, fmt.Errorf("%s: Not a recipe bundle, expected a .zip, .tar, .tar.gz or .tgz file", release.URL)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".download-*-"+name)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	recipes, err := GetRecipesFromArchive(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", release.URL, err)
+	}
+	if len(recipes) == 0 {
+		return nil, fmt.Errorf("%s: Bundle has no recipes", release.URL)
+	}
+
+	previous, installed, err := InstalledRelease(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return nil, err
+	}
+
+	release.File = name
+	contents, err := json.MarshalIndent(release, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, installedFile), append(contents, '\n')); err != nil {
+		return nil, err
+	}
+
+	if installed && previous.File != "" && previous.File != name {
+		os.Remove(filepath.Join(dir, previous.File))
+	}
+
+	return recipes, nil
+}
+
+// DatabaseRecipes returns the recipes of the database installed into dir, or
+// nothing if none is.  Recipes outside a collection are builtin ones.
+func DatabaseRecipes(dir string) ([]Recipe, error) {
+	release, installed, err := InstalledRelease(dir)
+	if err != nil || !installed {
+		return nil, err
+	}
+
+	recipes, err := GetRecipesFromArchive(filepath.Join(dir, release.File))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range recipes {
+		if recipes[i].Collection == "" {
+			recipes[i].Collection = BuiltinCollection
+		}
+	}
+
+	return recipes, nil
+}
+
+// bundleName is the file name the bundle at rawURL is installed as, keeping
+// its archive extension, or "" if it isn't an archive.
+func bundleName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !IsRecipeArchive(u.Path) {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+func download(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Downloading %s failed: %s", rawURL, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func writeFileAtomic(filename string, contents []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,159 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The environment variable that turns on recording detections, like
+// --record-usage
+const RecordUsageEnv = "FILMDETECT_RECORD_USAGE"
+
+// UsageRecord is one detection of a recipe, as kept in the usage file.
+type UsageRecord struct {
+	Time    time.Time `json:"time"`
+	File    string    `json:"file"`
+	Recipe  string    `json:"recipe"`
+	Camera  string    `json:"camera,omitempty"`
+	Perfect bool      `json:"perfect"`
+}
+
+// UsageFile is where detections are recorded, one JSON object per line.
+func UsageFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "filmdetect", "usage.jsonl"), nil
+}
+
+// RecordUsage appends record to the usage file filename.
+func RecordUsage(filename string, record UsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ReadUsage reads the records of the usage file filename.  A missing file
+// has no records.
+func ReadUsage(filename string) ([]UsageRecord, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// RecipeUsage is how often a recipe was detected.
+type RecipeUsage struct {
+	Recipe     string    `json:"recipe"`
+	Detections int       `json:"detections"`
+	Perfect    int       `json:"perfect"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+}
+
+// SummarizeUsage counts the detections of each recipe, per group as named by
+// groupBy, most detected first.
+func SummarizeUsage(records []UsageRecord, groupBy func(UsageRecord) string) map[string][]RecipeUsage {
+	counts := map[string]map[string]*RecipeUsage{}
+
+	for _, record := range records {
+		key := groupBy(record)
+		if counts[key] == nil {
+			counts[key] = map[string]*RecipeUsage{}
+		}
+
+		usage, ok := counts[key][record.Recipe]
+		if !ok {
+			usage = &RecipeUsage{Recipe: record.Recipe, First: record.Time, Last: record.Time}
+			counts[key][record.Recipe] = usage
+		}
+
+		usage.Detections++
+		if record.Perfect {
+			usage.Perfect++
+		}
+		if record.Time.Before(usage.First) {
+			usage.First = record.Time
+		}
+		if record.Time.After(usage.Last) {
+			usage.Last = record.Time
+		}
+	}
+
+	summaries := map[string][]RecipeUsage{}
+	for key, recipes := range counts {
+		var usages []RecipeUsage
+		for _, usage := range recipes {
+			usages = append(usages, *usage)
+		}
+		sort.Slice(usages, func(i, j int) bool {
+			if usages[i].Detections != usages[j].Detections {
+				return usages[i].Detections > usages[j].Detections
+			}
+			return usages[i].Recipe < usages[j].Recipe
+		})
+		summaries[key] = usages
+	}
+
+	return summaries
+}
@@ -0,0 +1,59 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import "slices"
+
+// VideoExtensions are the movie files of Fujifilm cameras, whose maker notes
+// hold the film simulation and the settings that apply to movies.
+var VideoExtensions = []string{".mov"}
+
+// VideoFields are the settings Fujifilm cameras apply to movies.  Grain,
+// Color Chrome, Clarity and the like only exist for stills, so they aren't
+// compared for a movie.
+var VideoFields = []string{
+	"FilmSimulation",
+	"MonochromeFilter",
+	"ToningWarmCool",
+	"ToningMagentaGreen",
+	"WhiteBalanceMode",
+	"WhiteBalanceRed",
+	"WhiteBalanceBlue",
+	"DynamicRange",
+	"Highlights",
+	"Shadows",
+	"Color",
+	"Sharpness",
+	"NoiseReduction",
+}
+
+// IsVideo reports whether filename is a movie, by its extension.
+func IsVideo(filename string) bool {
+	return HasExtension(filename, VideoExtensions...)
+}
+
+// videoRecipe returns the recipe read from a movie with the settings that
+// aren't VideoFields unset.
+func videoRecipe(r Recipe) Recipe {
+	for _, field := range ScoringFields() {
+		if !slices.Contains(VideoFields, field) && !r.IsUnset(field) {
+			r.Unset = append(r.Unset, field)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,276 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"slices"
+	"sort"
+)
+
+// defaultVisualModel is the VisualModel used unless another one is loaded.
+//
+//go:embed visual_model.json
+var defaultVisualModel []byte
+
+// How many pixels along each side of an image VisualFeaturesOf samples at most
+const visualSamples = 256
+
+// VisualFeatures are color statistics of an image, which tell the film
+// simulation families apart somewhat when an image has lost its metadata.
+// All of them are fractions of the full range.
+type VisualFeatures struct {
+	// Mean saturation, as in HSV
+	Saturation float64 `json:"saturation"`
+	// Standard deviation of the luma
+	Contrast float64 `json:"contrast"`
+	// Mean luma
+	Brightness float64 `json:"brightness"`
+	// Mean of red less blue, positive for warm images
+	Warmth float64 `json:"warmth"`
+	// Mean of green less red and blue, positive for green images
+	Tint float64 `json:"tint"`
+}
+
+func (f VisualFeatures) values() []float64 {
+	return []float64{f.Saturation, f.Contrast, f.Brightness, f.Warmth, f.Tint}
+}
+
+func visualFeaturesFrom(values []float64) VisualFeatures {
+	return VisualFeatures{Saturation: values[0], Contrast: values[1], Brightness: values[2], Warmth: values[3], Tint: values[4]}
+}
+
+// VisualFeaturesOf computes the features of img from a grid of its pixels.
+func VisualFeaturesOf(img image.Image) VisualFeatures {
+	bounds := img.Bounds()
+	stepX := max(1, bounds.Dx()/visualSamples)
+	stepY := max(1, bounds.Dy()/visualSamples)
+
+	var n, saturation, luma, lumaSquares, warmth, tint float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r16, g16, b16, _ := img.At(x, y).RGBA()
+			r, g, b := float64(r16)/0xffff, float64(g16)/0xffff, float64(b16)/0xffff
+
+			high, low := max(r, g, b), min(r, g, b)
+			if high > 0 {
+				saturation += (high - low) / high
+			}
+
+			l := 0.299*r + 0.587*g + 0.114*b
+			luma += l
+			lumaSquares += l * l
+			warmth += r - b
+			tint += g - (r+b)/2
+			n++
+		}
+	}
+
+	if n == 0 {
+		return VisualFeatures{}
+	}
+
+	mean := luma / n
+	return VisualFeatures{
+		Saturation: saturation / n,
+		Contrast:   math.Sqrt(max(0, lumaSquares/n-mean*mean)),
+		Brightness: mean,
+		Warmth:     warmth / n,
+		Tint:       tint / n,
+	}
+}
+
+// ReadVisualFeatures decodes a JPEG or PNG image and computes its features.
+func ReadVisualFeatures(filename string) (VisualFeatures, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return VisualFeatures{}, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return VisualFeatures{}, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return VisualFeaturesOf(img), nil
+}
+
+// VisualFamily is a group of film simulations that look alike, with the
+// typical features of their images and how much those vary.
+type VisualFamily struct {
+	Name        string         `json:"name"`
+	Simulations []string       `json:"simulations"`
+	Centroid    VisualFeatures `json:"centroid"`
+	Spread      VisualFeatures `json:"spread"`
+	// How many images the family was trained on, if it was
+	Samples int `json:"samples,omitempty"`
+}
+
+// VisualModel classifies images by their features, picking the families
+// whose centroids are closest, relative to their spread.
+type VisualModel struct {
+	// Where the centroids come from
+	Source   string         `json:"source,omitempty"`
+	Families []VisualFamily `json:"families"`
+}
+
+// VisualGuess is a film simulation family an image may have been shot with.
+type VisualGuess struct {
+	Family      string   `json:"family"`
+	Simulations []string `json:"simulations"`
+	// How likely the family is compared to the others, from 0 to 1
+	Confidence float64 `json:"confidence"`
+	// Whether the centroid of the family was trained on images.  The ones
+	// of the builtin model are set by hand, so its guesses are uncalibrated.
+	Calibrated bool `json:"calibrated"`
+}
+
+// DefaultVisualModel returns the model compiled into filmdetect.  Its
+// centroids are set by hand from the look of each film simulation, not
+// measured, so its guesses are uncalibrated.
+func DefaultVisualModel() VisualModel {
+	var model VisualModel
+	if err := json.Unmarshal(defaultVisualModel, &model); err != nil {
+		panic(fmt.Sprintf("visual_model.json: %v", err))
+	}
+	return model
+}
+
+// ReadVisualModel reads a model saved by `filmdetect train-visual`.
+func ReadVisualModel(filename string) (VisualModel, error) {
+	var model VisualModel
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return model, err
+	}
+	if err := json.Unmarshal(contents, &model); err != nil {
+		return model, fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(model.Families) == 0 {
+		return model, fmt.Errorf("%s: Model has no families", filename)
+	}
+
+	return model, nil
+}
+
+// Classify rates every family of the model for features, most likely first.
+// Confidences are a softmax of the distances to the centroids, so they add up
+// to 1 and only say how much better a family fits than the others.
+func (m VisualModel) Classify(features VisualFeatures) []VisualGuess {
+	guesses := make([]VisualGuess, len(m.Families))
+	likelihoods := make([]float64, len(m.Families))
+	total := 0.0
+
+	for i, family := range m.Families {
+		distance := 0.0
+		spread := family.Spread.values()
+		for j, value := range features.values() {
+			d := (value - family.Centroid.values()[j]) / max(spread[j], 0.01)
+			distance += d * d
+		}
+
+		likelihoods[i] = math.Exp(-distance / 2)
+		total += likelihoods[i]
+		guesses[i] = VisualGuess{Family: family.Name, Simulations: family.Simulations, Calibrated: family.Samples > 0}
+	}
+
+	for i := range guesses {
+		if total > 0 {
+			guesses[i].Confidence = likelihoods[i] / total
+		} else {
+			guesses[i].Confidence = 1 / float64(len(guesses))
+		}
+	}
+
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Confidence > guesses[j].Confidence
+	})
+
+	return guesses
+}
+
+// VisualSample is an image with a known film simulation, for training.
+type VisualSample struct {
+	FilmSimulation string
+	Features       VisualFeatures
+}
+
+// TrainVisualModel fits the families of base to samples: every family with
+// samples gets their mean as its centroid and their standard deviation as its
+// spread.  Families without samples keep the centroids of base.
+func TrainVisualModel(base VisualModel, samples []VisualSample) VisualModel {
+	model := VisualModel{Source: fmt.Sprintf("Trained on %d images", len(samples))}
+
+	for _, family := range base.Families {
+		var values [][]float64
+		for _, sample := range samples {
+			if slices.Contains(family.Simulations, sample.FilmSimulation) {
+				values = append(values, sample.Features.values())
+			}
+		}
+
+		if len(values) > 0 {
+			mean := make([]float64, len(values[0]))
+			spread := make([]float64, len(values[0]))
+			for _, v := range values {
+				for j := range v {
+					mean[j] += v[j] / float64(len(values))
+				}
+			}
+			for _, v := range values {
+				for j := range v {
+					spread[j] += (v[j] - mean[j]) * (v[j] - mean[j]) / float64(len(values))
+				}
+			}
+			for j := range spread {
+				// A family trained on a single image still varies
+				spread[j] = max(math.Sqrt(spread[j]), base.spreadFloor(j))
+			}
+
+			family.Centroid = visualFeaturesFrom(mean)
+			family.Spread = visualFeaturesFrom(spread)
+			family.Samples = len(values)
+		}
+
+		model.Families = append(model.Families, family)
+	}
+
+	return model
+}
+
+// spreadFloor is the smallest spread of a feature among the families of m,
+// below which trained spreads are raised.
+func (m VisualModel) spreadFloor(feature int) float64 {
+	floor := math.Inf(1)
+	for _, family := range m.Families {
+		floor = min(floor, family.Spread.values()[feature])
+	}
+
+	if math.IsInf(floor, 1) {
+		return 0.01
+	}
+	return floor
+}
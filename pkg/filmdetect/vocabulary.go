@@ -0,0 +1,82 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+// EnumValues lists the values exiftool reports for the string fields of
+// Recipe, in their canonical spelling.  Recipes and the settings extracted
+// from an image are both normalized to these before they're compared, see
+// NormalizeValue, which also takes aliases and small typos, but these are
+// the values a recipe file should use.  The first value of each list is the
+// camera default.  Film simulations go by their name on the camera rather
+// than exiftool's FilmMode, see FilmSimulationAliases.
+var EnumValues = map[string][]string{
+	"FilmSimulation": {
+		"Provia",
+		"Velvia",
+		"Astia",
+		"Classic Chrome",
+		"Pro Neg. Hi",
+		"Pro Neg. Std",
+		"Classic Negative",
+		"Nostalgic Neg",
+		"Eterna",
+		"Bleach Bypass",
+		"Reala ACE",
+		"Acros",
+		"None (B&W)",
+		"B&W Sepia",
+	},
+	"GrainEffectSize":      {"Off", "Small", "Large"},
+	"GrainEffectRoughness": {"Off", "Weak", "Strong"},
+	"ColorChromeEffect":    {"Off", "Weak", "Strong"},
+	"ColorChromeFXBlue":    {"Off", "Weak", "Strong"},
+	"SmoothSkinEffect":     {"Off", "Weak", "Strong"},
+	"WhiteBalanceMode": {
+		"Auto",
+		"Auto (white priority)",
+		"Auto (ambiance priority)",
+		"Kelvin",
+		"Daylight",
+		"Cloudy",
+		"Daylight Fluorescent",
+		"Day White Fluorescent",
+		"White Fluorescent",
+		"Incandescent",
+		"Underwater",
+		"Custom",
+		"Custom2",
+		"Custom3",
+	},
+	"DynamicRange":     {"Auto", "100", "200", "400"},
+	"DRangePriority":   {"Off", "Auto", "Weak", "Strong"},
+	"MonochromeFilter": {"Off", "Yellow", "Red", "Green"},
+}
+
+// IntRanges holds the inclusive range the camera accepts for the integer
+// fields of Recipe.
+var IntRanges = map[string][2]int{
+	"WhiteBalanceRed":    {-9, 9},
+	"WhiteBalanceBlue":   {-9, 9},
+	"Highlights":         {-2, 4},
+	"Shadows":            {-2, 4},
+	"Color":              {-4, 4},
+	"Sharpness":          {-4, 4},
+	"NoiseReduction":     {-4, 4},
+	"Clarity":            {-5, 5},
+	"ToningWarmCool":     {-9, 9},
+	"ToningMagentaGreen": {-9, 9},
+}
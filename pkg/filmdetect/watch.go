@@ -0,0 +1,103 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How long WatchDirs waits for more changes before reporting them, since
+// editors write files in several steps
+var WatchDelay = 200 * time.Millisecond
+
+// WatchDirs calls changed whenever a recipe file in dirs or their
+// subdirectories is added, edited or removed, until ctx is done.
+func WatchDirs(ctx context.Context, dirs []string, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range dirs {
+		if err := watchTree(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			Logger.Warn("Watching recipes failed", "err", err)
+		case event := <-watcher.Events:
+			if strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue
+			}
+
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						Logger.Warn("Watching recipes failed", "dir", event.Name, "err", err)
+					}
+					timer = time.After(WatchDelay)
+					continue
+				}
+			}
+
+			// Removing or renaming a directory doesn't give an extension
+			if HasExtension(event.Name, ".json") || IsRecipeArchive(event.Name) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				timer = time.After(WatchDelay)
+			}
+		case <-timer:
+			timer = nil
+			changed()
+		}
+	}
+}
+
+// watchTree watches dir and its subdirectories, skipping hidden ones like
+// GetRecipeFiles does.  If dir is a file, its directory is watched.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return watcher.Add(filepath.Dir(dir))
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(path)
+	})
+}
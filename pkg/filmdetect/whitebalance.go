@@ -0,0 +1,136 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package filmdetect
+
+import (
+	"fmt"
+	"math"
+)
+
+// WhiteBalanceShiftField names the white balance shift as a whole, in place of
+// WhiteBalanceRed and WhiteBalanceBlue, in GroupedMismatches.  Its values are
+// WhiteBalanceShifts.
+const WhiteBalanceShiftField = "WhiteBalanceShift"
+
+// WhiteBalanceShift is a point on the R/B grid of the white balance shift.
+type WhiteBalanceShift struct {
+	Red  int
+	Blue int
+}
+
+// String formats the shift like the camera, e.g. "R+2 B-3".
+func (s WhiteBalanceShift) String() string {
+	return fmt.Sprintf("R%s B%s", FormatValue("WhiteBalanceRed", s.Red), FormatValue("WhiteBalanceBlue", s.Blue))
+}
+
+// Distance returns how far apart two shifts are on the grid.
+func (s WhiteBalanceShift) Distance(other WhiteBalanceShift) float64 {
+	return math.Hypot(float64(s.Red-other.Red), float64(s.Blue-other.Blue))
+}
+
+// WhiteBalanceShift returns the white balance shift of the recipe.
+func (r Recipe) WhiteBalanceShift() WhiteBalanceShift {
+	return WhiteBalanceShift{Red: r.WhiteBalanceRed, Blue: r.WhiteBalanceBlue}
+}
+
+func isWhiteBalanceShiftField(field string) bool {
+	return field == "WhiteBalanceRed" || field == "WhiteBalanceBlue"
+}
+
+// whiteBalanceShifts returns the shifts of the input and the candidate as
+// compared in fields, which needn't include both settings: one that's left
+// out counts as the same in both.
+func whiteBalanceShifts(fields []FieldDiff) (WhiteBalanceShift, WhiteBalanceShift) {
+	var input, candidate WhiteBalanceShift
+	for _, field := range fields {
+		in, _ := field.Input.(int)
+		cand, _ := field.Candidate.(int)
+
+		switch field.Field {
+		case "WhiteBalanceRed":
+			input.Red, candidate.Red = in, cand
+		case "WhiteBalanceBlue":
+			input.Blue, candidate.Blue = in, cand
+		}
+	}
+
+	return input, candidate
+}
+
+// GroupedFields returns the compared settings like Fields, with the white
+// balance shift as a single WhiteBalanceShiftField.
+func (d Difference) GroupedFields() []FieldDiff {
+	var result []FieldDiff
+	grouped := false
+
+	for _, field := range d.fields {
+		if !isWhiteBalanceShiftField(field.Field) {
+			result = append(result, field)
+			continue
+		}
+		if grouped {
+			continue
+		}
+
+		input, candidate := whiteBalanceShifts(d.fields)
+		matched := true
+		for _, f := range d.fields {
+			if isWhiteBalanceShiftField(f.Field) {
+				matched = matched && f.Matched
+			}
+		}
+		result = append(result, FieldDiff{Field: WhiteBalanceShiftField, Input: input, Candidate: candidate, Matched: matched})
+		grouped = true
+	}
+
+	return result
+}
+
+// GroupedMismatches returns the differing settings like Mismatches, with a
+// differing white balance shift as a single WhiteBalanceShiftField.
+func (d Difference) GroupedMismatches() []FieldDiff {
+	var result []FieldDiff
+	for _, field := range d.GroupedFields() {
+		if !field.Matched {
+			result = append(result, field)
+		}
+	}
+
+	return result
+}
+
+// FormatMismatch describes a differing setting, e.g. "Clarity +3 vs -2", or
+// "WB Shift R+2 B-3 vs R+1 B-4, distance 1.4".
+func FormatMismatch(field FieldDiff) string {
+	text := fmt.Sprintf("%s %s vs %s", FieldLabel(field.Field), FormatValue(field.Field, field.Input), FormatValue(field.Field, field.Candidate))
+	if distance, ok := shiftDistance(field); ok {
+		text += fmt.Sprintf(", distance %.1f", distance)
+	}
+
+	return text
+}
+
+// shiftDistance returns the distance of a WhiteBalanceShiftField.
+func shiftDistance(field FieldDiff) (float64, bool) {
+	input, inputOk := field.Input.(WhiteBalanceShift)
+	candidate, candidateOk := field.Candidate.(WhiteBalanceShift)
+	if !inputOk || !candidateOk {
+		return 0, false
+	}
+
+	return input.Distance(candidate), true
+}
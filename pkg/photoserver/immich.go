@@ -0,0 +1,99 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package photoserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// How many photos immich is asked for at a time
+const immichPageSize = 500
+
+// Immich is a client of the immich API, authenticating with an API key.
+// Labels are tags under filmdetect.KeywordPrefix, e.g. "Recipe/Kodachrome 64".
+type Immich struct {
+	api
+}
+
+func NewImmich(baseURL, token string) *Immich {
+	header := http.Header{}
+	header.Set("x-api-key", token)
+
+	return &Immich{api: api{baseURL: baseURL, header: header}}
+}
+
+func (i *Immich) Photos(ctx context.Context) ([]Photo, error) {
+	var photos []Photo
+
+	for page := 1; ; page++ {
+		body := map[string]interface{}{
+			"make": "FUJIFILM",
+			"type": "IMAGE",
+			"page": page,
+			"size": immichPageSize,
+		}
+
+		var result struct {
+			Assets struct {
+				Items []struct {
+					ID               string `json:"id"`
+					OriginalFileName string `json:"originalFileName"`
+				} `json:"items"`
+				NextPage *string `json:"nextPage"`
+			} `json:"assets"`
+		}
+		if err := i.call(ctx, http.MethodPost, "/api/search/metadata", body, &result); err != nil {
+			return nil, err
+		}
+
+		for _, asset := range result.Assets.Items {
+			photos = append(photos, Photo{ID: asset.ID, FileID: asset.ID, Name: asset.OriginalFileName})
+		}
+
+		if result.Assets.NextPage == nil {
+			return photos, nil
+		}
+	}
+}
+
+func (i *Immich) Download(ctx context.Context, photo Photo, w io.Writer) error {
+	return i.download(ctx, "/api/assets/"+url.PathEscape(photo.FileID)+"/original", w)
+}
+
+// AddLabel creates the tag if it doesn't exist yet, and tags the photo.
+func (i *Immich) AddLabel(ctx context.Context, photo Photo, recipeName string) error {
+	label := filmdetect.KeywordPrefix + "/" + recipeName
+
+	var tags []struct {
+		ID string `json:"id"`
+	}
+	if err := i.call(ctx, http.MethodPut, "/api/tags", map[string]interface{}{"tags": []string{label}}, &tags); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("immich didn't create the tag %s", label)
+	}
+
+	body := map[string]interface{}{"ids": []string{photo.ID}}
+	return i.call(ctx, http.MethodPut, "/api/tags/"+url.PathEscape(tags[0].ID)+"/assets", body, nil)
+}
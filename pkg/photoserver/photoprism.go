@@ -0,0 +1,103 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package photoserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// How many photos PhotoPrism is asked for at a time
+const photoPrismPageSize = 500
+
+// PhotoPrism is a client of the PhotoPrism API, authenticating with an app
+// password or access token.
+type PhotoPrism struct {
+	api
+
+	downloadToken string
+}
+
+func NewPhotoPrism(baseURL, token string) *PhotoPrism {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+
+	return &PhotoPrism{api: api{baseURL: baseURL, header: header}}
+}
+
+type photoPrismPhoto struct {
+	UID        string
+	FileName   string
+	Hash       string
+	CameraMake string
+}
+
+func (p *PhotoPrism) Photos(ctx context.Context) ([]Photo, error) {
+	var photos []Photo
+
+	for offset := 0; ; offset += photoPrismPageSize {
+		query := url.Values{}
+		query.Set("count", fmt.Sprintf("%d", photoPrismPageSize))
+		query.Set("offset", fmt.Sprintf("%d", offset))
+		query.Set("merged", "true")
+
+		var page []photoPrismPhoto
+		if err := p.call(ctx, http.MethodGet, "/api/v1/photos?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+
+		for _, photo := range page {
+			if strings.EqualFold(photo.CameraMake, "FUJIFILM") {
+				photos = append(photos, Photo{ID: photo.UID, FileID: photo.Hash, Name: photo.FileName})
+			}
+		}
+
+		if len(page) < photoPrismPageSize {
+			return photos, nil
+		}
+	}
+}
+
+// Download fetches the primary file of a photo.  Downloads need a token of
+// their own, which is asked for once.
+func (p *PhotoPrism) Download(ctx context.Context, photo Photo, w io.Writer) error {
+	if p.downloadToken == "" {
+		var config struct {
+			DownloadToken string `json:"downloadToken"`
+		}
+		if err := p.call(ctx, http.MethodGet, "/api/v1/config", nil, &config); err != nil {
+			return err
+		}
+		p.downloadToken = config.DownloadToken
+	}
+
+	return p.download(ctx, "/api/v1/dl/"+url.PathEscape(photo.FileID)+"?t="+url.QueryEscape(p.downloadToken), w)
+}
+
+func (p *PhotoPrism) AddLabel(ctx context.Context, photo Photo, recipeName string) error {
+	body := map[string]interface{}{
+		"Name":        recipeName,
+		"Uncertainty": 0,
+		"Priority":    10,
+	}
+
+	return p.call(ctx, http.MethodPost, "/api/v1/photos/"+url.PathEscape(photo.ID)+"/label", body, nil)
+}
@@ -0,0 +1,158 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package photoserver talks to self-hosted photo servers, so that their
+// photos can be labeled with the recipe they were shot with.
+package photoserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Photo is an image on a photo server.
+type Photo struct {
+	ID string
+	// The original file of the photo, where the server tells them apart
+	FileID string
+	Name   string
+}
+
+// Client talks to a photo server.
+type Client interface {
+	// Photos lists the photos taken with Fujifilm cameras.
+	Photos(ctx context.Context) ([]Photo, error)
+	// Download writes the original file of a photo to w.
+	Download(ctx context.Context, photo Photo, w io.Writer) error
+	// AddLabel labels a photo with the name of a recipe.  Adding a label it
+	// already has does nothing.
+	AddLabel(ctx context.Context, photo Photo, recipeName string) error
+}
+
+// Servers are the kinds of photo servers known to New, by name.
+var Servers = map[string]func(url, token string) Client{
+	"photoprism": func(url, token string) Client { return NewPhotoPrism(url, token) },
+	"immich":     func(url, token string) Client { return NewImmich(url, token) },
+}
+
+// Names returns the names of Servers.
+func Names() []string {
+	var names []string
+	for name := range Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New returns a client for the kind of server called name, at url,
+// authenticating with token.
+func New(name, url, token string) (Client, error) {
+	newClient, ok := Servers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown photo server '%s', use one of: %s", name, strings.Join(Names(), ", "))
+	}
+
+	return newClient(strings.TrimSuffix(url, "/"), token), nil
+}
+
+// api makes the requests of a client.
+type api struct {
+	baseURL string
+	header  http.Header
+	client  *http.Client
+}
+
+// request sends body, if it isn't nil, as JSON and returns the response.
+// Responses other than 2xx are errors.
+func (a api) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range a.header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	client := a.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s failed: %s", method, a.baseURL+path, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// call sends a request and decodes the JSON response into out, unless it's
+// nil.
+func (a api) call(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := a.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: %v", method, a.baseURL+path, err)
+	}
+
+	return nil
+}
+
+// download copies the response to a GET request to w.
+func (a api) download(ctx context.Context, path string, w io.Writer) error {
+	resp, err := a.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,348 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package scandb keeps the detection results of a photo library in a SQLite
+// database, so that scanning it again only looks at files that changed.
+package scandb
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS results (
+	path         TEXT PRIMARY KEY,
+	size         INTEGER NOT NULL,
+	mod_time     INTEGER NOT NULL,
+	scanned_at   TEXT NOT NULL,
+	camera       TEXT NOT NULL,
+	captured_at  TEXT,
+	lens         TEXT NOT NULL DEFAULT '',
+	iso          INTEGER NOT NULL DEFAULT 0,
+	shutter      TEXT NOT NULL DEFAULT '',
+	aperture     REAL NOT NULL DEFAULT 0,
+	recipes_hash TEXT NOT NULL DEFAULT '',
+	recipe       TEXT NOT NULL,
+	good_match   INTEGER NOT NULL,
+	perfect      INTEGER NOT NULL,
+	score        REAL NOT NULL,
+	confidence   TEXT NOT NULL,
+	error        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_recipe ON results (recipe);
+CREATE INDEX IF NOT EXISTS results_captured_at ON results (captured_at);
+`
+
+// Columns added since the first version, which older databases lack
+var addedColumns = []struct{ name, definition string }{
+	{"lens", "TEXT NOT NULL DEFAULT ''"},
+	{"iso", "INTEGER NOT NULL DEFAULT 0"},
+	{"shutter", "TEXT NOT NULL DEFAULT ''"},
+	{"aperture", "REAL NOT NULL DEFAULT 0"},
+	{"recipes_hash", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// The layout of captured_at, which sorts and compares as text
+const timeLayout = "2006-01-02 15:04:05"
+
+// DB is a database of detection results, one per image file.
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it if it doesn't exist.
+func Open(path string) (*DB, error) {
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return &DB{db: db}, nil
+}
+
+// migrate adds the columns an older database lacks.  The files it has results
+// for are marked as changed, so that the next scan fills them in.
+func migrate(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('results')")
+	if err != nil {
+		return err
+	}
+
+	have := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	added := false
+	for _, column := range addedColumns {
+		if have[column.name] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE results ADD COLUMN " + column.name + " " + column.definition); err != nil {
+			return err
+		}
+		added = true
+	}
+
+	if added {
+		_, err = db.Exec("UPDATE results SET mod_time = 0")
+	}
+
+	return err
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// key is how a file is stored: its absolute path, so results don't depend
+// on the directory the scan ran in.
+func key(path string) (string, error) {
+	return filepath.Abs(path)
+}
+
+// Changed reports whether a file is new, differs in size or modification
+// time from when it was scanned, or was scanned with recipes other than the
+// ones of recipesHash (see filmdetect.RecipesHash).
+func (d *DB) Changed(path, recipesHash string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	k, err := key(path)
+	if err != nil {
+		return false, err
+	}
+
+	var size, modTime int64
+	var hash string
+	err = d.db.QueryRow("SELECT size, mod_time, recipes_hash FROM results WHERE path = ?", k).Scan(&size, &modTime, &hash)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return size != info.Size() || modTime != info.ModTime().UnixNano() || hash != recipesHash, nil
+}
+
+// Save stores the outcome of detection on a file with the recipes of
+// recipesHash, replacing an earlier one.
+func (d *DB) Save(record filmdetect.DetectionRecord, recipesHash string) error {
+	info, err := os.Stat(record.Filename)
+	if err != nil {
+		return err
+	}
+
+	k, err := key(record.Filename)
+	if err != nil {
+		return err
+	}
+
+	var capturedAt interface{}
+	if !record.Extraction.CaptureTime.IsZero() {
+		capturedAt = record.Extraction.CaptureTime.Format(timeLayout)
+	}
+
+	recipe, confidence, errText := "", "", ""
+	goodMatch, score := false, 0.0
+	if best, ok := record.Best(); ok {
+		recipe = best.Candidate.FullName()
+		goodMatch = best.IsGoodMatch()
+		score = best.Score()
+		confidence = best.Confidence.String()
+	}
+	if record.Err != nil {
+		errText = record.Err.Error()
+	}
+
+	_, err = d.db.Exec(`INSERT OR REPLACE INTO results
+		(path, size, mod_time, scanned_at, camera, captured_at, lens, iso, shutter, aperture, recipe, good_match, perfect, score, confidence, error, recipes_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k, info.Size(), info.ModTime().UnixNano(), time.Now().Format(time.RFC3339), record.Extraction.Model, capturedAt,
+		record.Extraction.Lens, record.Extraction.ISO, record.Extraction.ShutterSpeed, record.Extraction.Aperture,
+		recipe, goodMatch, record.PerfectMatch, score, confidence, errText, recipesHash)
+
+	return err
+}
+
+// Prune removes the results of files under dir that aren't in keep, i.e. of
+// images that were deleted since they were scanned.  It returns how many
+// results it removed.
+func (d *DB) Prune(dir string, keep []string) (int, error) {
+	dir, err := key(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := map[string]bool{}
+	for _, path := range keep {
+		k, err := key(path)
+		if err != nil {
+			return 0, err
+		}
+		kept[k] = true
+	}
+
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	rows, err := d.db.Query("SELECT path FROM results WHERE substr(path, 1, ?) = ?", len(prefix), prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var stale []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !kept[path] {
+			stale = append(stale, path)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, path := range stale {
+		if _, err := d.db.Exec("DELETE FROM results WHERE path = ?", path); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(stale), nil
+}
+
+// Result is a stored detection result.
+type Result struct {
+	Path       string    `json:"path"`
+	Camera     string    `json:"camera"`
+	CapturedAt time.Time `json:"captured_at"`
+	Lens       string    `json:"lens"`
+	ISO        int       `json:"iso"`
+	// As exiftool shows it, e.g. "1/250"
+	ShutterSpeed string  `json:"shutter_speed"`
+	Aperture     float64 `json:"aperture"`
+	// The closest recipe, with its collection
+	Recipe     string  `json:"recipe"`
+	GoodMatch  bool    `json:"good_match"`
+	Perfect    bool    `json:"perfect"`
+	Score      float64 `json:"score"`
+	Confidence string  `json:"confidence"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Query selects results.  Zero fields don't restrict the results.
+type Query struct {
+	// The name of the recipe, with or without its collection
+	Recipe string
+	Camera string
+	// Captured at or after Since, and before Until
+	Since time.Time
+	Until time.Time
+	// Only perfect matches, rather than all good matches
+	Perfect bool
+	// Also images that no recipe is a good match for, or that failed
+	Unmatched bool
+}
+
+// Query returns the results matching q, ordered by capture time.
+func (d *DB) Query(q Query) ([]Result, error) {
+	var where []string
+	var args []interface{}
+
+	if q.Recipe != "" {
+		where = append(where, "(recipe = ? OR substr(recipe, -?) = ?)")
+		args = append(args, q.Recipe, len(q.Recipe)+1, "/"+q.Recipe)
+	}
+	if q.Camera != "" {
+		where = append(where, "camera = ? COLLATE NOCASE")
+		args = append(args, q.Camera)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "captured_at >= ?")
+		args = append(args, q.Since.Format(timeLayout))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "captured_at < ?")
+		args = append(args, q.Until.Format(timeLayout))
+	}
+	if q.Perfect {
+		where = append(where, "perfect")
+	} else if !q.Unmatched {
+		where = append(where, "good_match AND error = ''")
+	}
+
+	query := "SELECT path, camera, captured_at, lens, iso, shutter, aperture, recipe, good_match, perfect, score, confidence, error FROM results"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY captured_at, path"
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []Result{}
+	for rows.Next() {
+		var result Result
+		var capturedAt sql.NullString
+		err := rows.Scan(&result.Path, &result.Camera, &capturedAt, &result.Lens, &result.ISO, &result.ShutterSpeed,
+			&result.Aperture, &result.Recipe, &result.GoodMatch, &result.Perfect, &result.Score, &result.Confidence,
+			&result.Error)
+		if err != nil {
+			return nil, err
+		}
+		if capturedAt.Valid {
+			result.CapturedAt, _ = time.Parse(timeLayout, capturedAt.String)
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,230 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// batchResult is the outcome of detection on one image of a batch.
+type batchResult struct {
+	File string `json:"file"`
+	*detection
+	Error string `json:"error,omitempty"`
+}
+
+func newBatchResult(file string, d detection, err error) batchResult {
+	if err != nil {
+		return batchResult{File: file, Error: err.Error()}
+	}
+
+	return batchResult{File: file, detection: &d}
+}
+
+// batchDir returns the absolute path of dir, if it's in one of the BatchDirs
+// of the server.
+func (s *Server) batchDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	for _, allowed := range s.BatchDirs {
+		root, err := filepath.Abs(allowed)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return abs, nil
+		}
+	}
+
+	return "", fmt.Errorf("Directory %s isn't open to batches", dir)
+}
+
+// detectDir runs detection on every image in dir, calling emit with each
+// result as it completes.  It stops when emit fails, e.g. because the client
+// went away.
+func (s *Server) detectDir(dir string, emit func(batchResult) error) error {
+	dir, err := s.batchDir(dir)
+	if err != nil {
+		return err
+	}
+
+	files, err := filmdetect.GetImageFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		var d detection
+		d.Extraction, err = s.detector.Extract(file)
+		if err == nil {
+			d.Matches, d.PerfectMatch, err = s.detector.DetectExtraction(d.Extraction)
+		}
+
+		rel, _ := filepath.Rel(dir, file)
+		if err := emit(newBatchResult(filepath.ToSlash(rel), d, err)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleDetectBatch detects many images in one request, and streams the
+// results back as newline-delimited JSON as each image completes.  The images
+// are either the files of a multipart/form-data upload, or the images in the
+// "dir" of a JSON request, which must be in one of the BatchDirs.
+func (s *Server) handleDetectBatch(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var request struct {
+		Dir string `json:"dir"`
+	}
+	if mediaType != "multipart/form-data" {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := s.batchDir(request.Dir); err != nil {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	controller := http.NewResponseController(w)
+	// Results go out while the upload is still coming in.  HTTP/2 always
+	// allows that, so an error here doesn't matter.
+	controller.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	emit := func(result batchResult) error {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = s.detectUploads(r, controller, emit)
+	} else {
+		err = s.detectDir(request.Dir, emit)
+	}
+
+	// The status is already sent, so the error is the last line
+	if err != nil {
+		encoder.Encode(map[string]string{"error": err.Error()})
+	}
+}
+
+// detectUploads runs detection on every file of a multipart upload as it
+// arrives, without waiting for the rest of the upload.  An upload of hundreds
+// of images takes longer than the read timeout of the server, so each file
+// gets the timeout of its own.
+func (s *Server) detectUploads(r *http.Request, controller *http.ResponseController, emit func(batchResult) error) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	for {
+		// Not every connection supports deadlines, and then there is no
+		// timeout to extend
+		controller.SetReadDeadline(time.Now().Add(readTimeout))
+
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+
+		image, err := io.ReadAll(io.LimitReader(part, MaxImageSize+1))
+		if err != nil {
+			return err
+		}
+
+		var result batchResult
+		if len(image) > MaxImageSize {
+			result = newBatchResult(part.FileName(), detection{}, fmt.Errorf("Image too large"))
+		} else {
+			d, err := s.detect(image)
+			result = newBatchResult(part.FileName(), d, err)
+		}
+
+		if err := emit(result); err != nil {
+			return err
+		}
+	}
+}
+
+// serveGRPCBatch handles DetectBatch, which streams a DetectBatchResult for
+// every image in the directory of the request.
+func (s *Server) serveGRPCBatch(w http.ResponseWriter, dir string) {
+	if _, err := s.batchDir(dir); err != nil {
+		writeStatus(w, codePermissionDenied, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+
+	err := s.detectDir(dir, func(result batchResult) error {
+		response := encodeBatchResult(result)
+
+		header := make([]byte, 5)
+		binary.BigEndian.PutUint32(header[1:], uint32(len(response)))
+		w.Write(header)
+		if _, err := w.Write(response); err != nil {
+			return err
+		}
+		return controller.Flush()
+	})
+	if err != nil {
+		writeStatus(w, codeInternal, err.Error())
+		return
+	}
+
+	writeStatus(w, codeOK, "")
+}
@@ -0,0 +1,66 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBatchUploadOutlastsReadTimeout checks that a multipart batch keeps
+// streaming in past the read timeout of the server, as long as each part
+// arrives in time.
+func TestBatchUploadOutlastsReadTimeout(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+
+	server := httptest.NewUnstartedServer(New(nil))
+	server.Config.ReadTimeout = timeout
+	server.Start()
+	defer server.Close()
+
+	body, upload := io.Pipe()
+	form := multipart.NewWriter(upload)
+	go func() {
+		// Form fields that aren't files are skipped, so no detector is
+		// needed
+		for i := 0; i < 5; i++ {
+			time.Sleep(timeout / 3)
+			form.WriteField("note", "slow")
+		}
+		form.Close()
+		upload.Close()
+	}()
+
+	resp, err := http.Post(server.URL+"/detect/batch", form.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	results, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(results), "error") {
+		t.Errorf("Batch failed: %s %s", resp.Status, results)
+	}
+}
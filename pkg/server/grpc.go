@@ -0,0 +1,147 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// gRPC status codes
+const (
+	codeOK               = 0
+	codeInvalidArgument  = 3
+	codePermissionDenied = 7
+	codeUnimplemented    = 12
+	codeInternal         = 13
+)
+
+const grpcService = "/filmdetect.v1.Filmdetect/"
+
+// serveGRPC handles a unary call of the Filmdetect service.  Each call is a
+// single length-prefixed protocol buffer message in both directions, with
+// the status sent in the trailers.
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc+proto")
+
+	if r.ProtoMajor != 2 {
+		writeStatus(w, codeInternal, "gRPC requires HTTP/2")
+		return
+	}
+
+	request, err := readGRPCMessage(r.Body)
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	fields, err := decodeBytesFields(request)
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	var response []byte
+
+	switch r.URL.Path {
+	case grpcService + "Detect":
+		result, err := s.detect(fields[1])
+		if err != nil {
+			writeStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+		response = encodeDetectResponse(result)
+	case grpcService + "Extract":
+		extraction, err := s.extract(fields[1])
+		if err != nil {
+			writeStatus(w, codeInvalidArgument, err.Error())
+			return
+		}
+		response = encodeExtractResponse(extraction)
+	case grpcService + "DetectBatch":
+		s.serveGRPCBatch(w, string(fields[1]))
+		return
+	case grpcService + "ListRecipes":
+		response = encodeListRecipesResponse(s.listRecipes(string(fields[1])))
+	default:
+		writeStatus(w, codeUnimplemented, fmt.Sprintf("Unknown method %s", r.URL.Path))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(response)))
+	w.Write(header)
+	w.Write(response)
+
+	writeStatus(w, codeOK, "")
+}
+
+// readGRPCMessage reads one length-prefixed message.  Compressed messages
+// aren't supported.
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(body, header)
+	if err != nil {
+		return nil, fmt.Errorf("Reading message failed: %v", err)
+	}
+
+	if header[0] != 0 {
+		return nil, fmt.Errorf("Compressed messages aren't supported")
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxImageSize {
+		return nil, fmt.Errorf("Message too large")
+	}
+
+	msg := make([]byte, length)
+	_, err = io.ReadFull(body, msg)
+	if err != nil {
+		return nil, fmt.Errorf("Reading message failed: %v", err)
+	}
+
+	return msg, nil
+}
+
+// writeStatus sends the status of the call in the trailers.
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", percentEncode(message))
+	}
+}
+
+// percentEncode escapes a status message the way gRPC expects.
+func percentEncode(message string) string {
+	encoded := []byte{}
+
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			encoded = append(encoded, []byte(fmt.Sprintf("%%%02X", c))...)
+			continue
+		}
+		encoded = append(encoded, c)
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,303 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// The tags of an image, as the "jsontags" backend reads them
+const testImage = `{"Make": "FUJIFILM", "Model": "X-T4", "FilmMode": "Classic Chrome",
+"GrainEffectRoughness": "Weak", "GrainEffectSize": "Small", "ColorChromeEffect": "Strong",
+"ColorChromeFXBlue": "Off", "WhiteBalance": "Daylight", "WhiteBalanceFineTune": "Red +40, Blue -100",
+"DevelopmentDynamicRange": 200, "HighlightTone": "-1 (medium soft)", "ShadowTone": "+1 (medium hard)",
+"Saturation": "+2 (high)", "Sharpness": "Soft", "NoiseReduction": "-4 (weakest)", "Clarity": -2,
+"ISO": 640, "ExposureCompensation": "+1/3"}`
+
+const testRecipe = `{"name": "K64", "film_simulation": "Classic Chrome", "grain_effect": "Weak, Small",
+"color_chrome_effect": "Strong", "color_chrome_fx_blue": "Off", "white_balance_mode": "Daylight",
+"white_balance_r": 2, "white_balance_b": -5, "dynamic_range": "DR200", "tone_curve_highlights": -1,
+"tone_curve_shadows": 1, "color": 2, "sharpness": -2, "noise_reduction": -4, "clarity": -2}`
+
+// jsonTags is a metadata backend reading images that are JSON objects of
+// their tags, so that the server can be tested without exiftool.
+type jsonTags struct{}
+
+func (jsonTags) Extract(path string) (map[string]any, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(contents, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func init() {
+	filmdetect.RegisterBackend("jsontags", func() (filmdetect.MetadataBackend, error) {
+		return jsonTags{}, nil
+	})
+}
+
+// grpcClient calls the methods of api/filmdetect.proto with grpc-go.
+type grpcClient struct {
+	conn    *grpc.ClientConn
+	service protoreflect.ServiceDescriptor
+}
+
+// newGRPCClient starts s on unencrypted HTTP/2, the way ListenAndServe does,
+// and connects to it.
+func newGRPCClient(t *testing.T, s *Server) *grpcClient {
+	t.Helper()
+
+	files, err := (&protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"../../api"}},
+	}).Compile(context.Background(), "filmdetect.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := httptest.NewUnstartedServer(s)
+	server.Config.Protocols = &protocols
+	server.Start()
+	t.Cleanup(server.Close)
+
+	conn, err := grpc.NewClient("passthrough:///"+server.Listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &grpcClient{conn: conn, service: files[0].Services().ByName("Filmdetect")}
+}
+
+// request returns an empty request message of a method.
+func (c *grpcClient) request(method string) *dynamicpb.Message {
+	return dynamicpb.NewMessage(c.service.Methods().ByName(protoreflect.Name(method)).Input())
+}
+
+func (c *grpcClient) response(method string) *dynamicpb.Message {
+	return dynamicpb.NewMessage(c.service.Methods().ByName(protoreflect.Name(method)).Output())
+}
+
+func (c *grpcClient) call(method string, request *dynamicpb.Message) (*dynamicpb.Message, error) {
+	response := c.response(method)
+	err := c.conn.Invoke(context.Background(), grpcService+method, request, response)
+	return response, err
+}
+
+// stream calls a server-streaming method, and returns every response.
+func (c *grpcClient) stream(method string, request *dynamicpb.Message) ([]*dynamicpb.Message, error) {
+	desc := &grpc.StreamDesc{StreamName: method, ServerStreams: true}
+	stream, err := c.conn.NewStream(context.Background(), desc, grpcService+method)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var responses []*dynamicpb.Message
+	for {
+		response := c.response(method)
+		err := stream.RecvMsg(response)
+		if errors.Is(err, io.EOF) {
+			return responses, nil
+		}
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, response)
+	}
+}
+
+// get returns the value of a field, named by a path of message fields.
+func get(msg protoreflect.Message, path string) protoreflect.Value {
+	var value protoreflect.Value
+	for _, name := range strings.Split(path, ".") {
+		value = msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(name)))
+		if m, ok := value.Interface().(protoreflect.Message); ok {
+			msg = m
+		}
+	}
+	return value
+}
+
+func set(msg protoreflect.Message, name string, value any) {
+	msg.Set(msg.Descriptor().Fields().ByName(protoreflect.Name(name)), protoreflect.ValueOf(value))
+}
+
+// TestGRPCInterop calls every method of the service with a grpc-go client
+// built from api/filmdetect.proto.
+func TestGRPCInterop(t *testing.T) {
+	backend := filmdetect.DefaultBackend
+	filmdetect.DefaultBackend = "jsontags"
+	defer func() { filmdetect.DefaultBackend = backend }()
+
+	var recipe filmdetect.Recipe
+	if err := json.Unmarshal([]byte(testRecipe), &recipe); err != nil {
+		t.Fatal(err)
+	}
+
+	detector, err := filmdetect.NewDetector(filmdetect.DetectorOptions{
+		Load: func() ([]filmdetect.Recipe, error) { return []filmdetect.Recipe{recipe}, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer detector.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), []byte(testImage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(detector)
+	s.BatchDirs = []string{dir}
+	client := newGRPCClient(t, s)
+
+	t.Run("Detect", func(t *testing.T) {
+		request := client.request("Detect")
+		set(request, "image", []byte(testImage))
+
+		response, err := client.call("Detect", request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := get(response, "extraction.recipe.film_simulation").String(); name != "Classic Chrome" {
+			t.Errorf("Detect read film simulation %q, expected %q", name, "Classic Chrome")
+		}
+		matches := get(response, "matches").List()
+		if matches.Len() != 1 {
+			t.Fatalf("Detect gave %d matches, expected 1", matches.Len())
+		}
+		match := matches.Get(0).Message()
+		if name := get(match, "recipe.name").String(); name != "K64" {
+			t.Errorf("Detect matched %q, expected %q", name, "K64")
+		}
+		if fields := get(match, "fields").List(); fields.Len() == 0 {
+			t.Error("Detect sent no compared fields")
+		}
+	})
+
+	t.Run("DetectWithoutImage", func(t *testing.T) {
+		_, err := client.call("Detect", client.request("Detect"))
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Detect without an image gave %v, expected %v", err, codes.InvalidArgument)
+		}
+	})
+
+	t.Run("Extract", func(t *testing.T) {
+		request := client.request("Extract")
+		set(request, "image", []byte(testImage))
+
+		response, err := client.call("Extract", request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if model := get(response, "extraction.model").String(); model != "X-T4" {
+			t.Errorf("Extract read model %q, expected %q", model, "X-T4")
+		}
+		if iso := get(response, "extraction.iso").Int(); iso != 640 {
+			t.Errorf("Extract read ISO %d, expected 640", iso)
+		}
+	})
+
+	t.Run("ListRecipes", func(t *testing.T) {
+		response, err := client.call("ListRecipes", client.request("ListRecipes"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipes := get(response, "recipes").List()
+		if recipes.Len() != 1 || get(recipes.Get(0).Message(), "name").String() != "K64" {
+			t.Errorf("ListRecipes gave %v, expected K64", recipes)
+		}
+
+		request := client.request("ListRecipes")
+		set(request, "collection", "other")
+		response, err = client.call("ListRecipes", request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recipes := get(response, "recipes").List(); recipes.Len() != 0 {
+			t.Errorf("ListRecipes of another collection gave %d recipes, expected none", recipes.Len())
+		}
+	})
+
+	t.Run("DetectBatch", func(t *testing.T) {
+		request := client.request("DetectBatch")
+		set(request, "dir", dir)
+
+		results, err := client.stream("DetectBatch", request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("DetectBatch gave %d results, expected 1", len(results))
+		}
+		if file := get(results[0], "file").String(); file != "a.jpg" {
+			t.Errorf("DetectBatch gave file %q, expected %q", file, "a.jpg")
+		}
+		if msg := get(results[0], "error").String(); msg != "" {
+			t.Errorf("DetectBatch failed: %s", msg)
+		}
+		if matches := get(results[0], "result.matches").List(); matches.Len() != 1 {
+			t.Errorf("DetectBatch gave %d matches, expected 1", matches.Len())
+		}
+	})
+
+	t.Run("DetectBatchOutsideBatchDirs", func(t *testing.T) {
+		request := client.request("DetectBatch")
+		set(request, "dir", t.TempDir())
+
+		_, err := client.stream("DetectBatch", request)
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("DetectBatch outside the batch directories gave %v, expected %v", err, codes.PermissionDenied)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// The encoders below follow the messages of api/filmdetect.proto, and
+// TestEncodersCoverProto checks that they write every field of them.
+
+func encodeRecipe(r filmdetect.Recipe) []byte {
+	var b protoBuffer
+
+	b.string(1, r.Name)
+	b.string(2, r.Author)
+	b.string(3, r.Url)
+	b.string(4, r.Collection)
+	b.string(5, r.FilmSimulation)
+	b.string(6, r.GrainEffectSize)
+	b.string(7, r.GrainEffectRoughness)
+	b.string(8, r.ColorChromeEffect)
+	b.string(9, r.ColorChromeFXBlue)
+	b.string(10, r.WhiteBalanceMode)
+	b.sint32(11, r.WhiteBalanceRed)
+	b.sint32(12, r.WhiteBalanceBlue)
+	b.string(13, r.DynamicRange)
+	b.sint32(14, r.Highlights)
+	b.sint32(15, r.Shadows)
+	b.sint32(16, r.Color)
+	b.sint32(17, r.Sharpness)
+	b.sint32(18, r.NoiseReduction)
+	b.sint32(19, r.Clarity)
+	b.string(20, r.MonochromeFilter)
+	b.sint32(21, r.ToningWarmCool)
+	b.sint32(22, r.ToningMagentaGreen)
+	b.sint32(23, r.IsoMin)
+	b.sint32(24, r.IsoMax)
+	b.string(25, r.ExposureCompensation)
+	b.string(26, r.Created)
+	b.string(27, r.Updated)
+	b.string(28, r.Notes)
+	for _, tag := range r.Tags {
+		b.message(29, []byte(tag))
+	}
+	b.string(30, r.DRangePriority)
+	b.string(31, r.SmoothSkinEffect)
+	b.string(32, r.Dialect)
+	b.stringMap(33, r.Settings)
+
+	return b
+}
+
+func encodeFieldDiff(f filmdetect.FieldDiff) []byte {
+	var b protoBuffer
+
+	b.string(1, f.Field)
+	b.string(2, fmt.Sprintf("%v", f.Input))
+	b.string(3, fmt.Sprintf("%v", f.Candidate))
+	b.bool(4, filmdetect.IsCriticalField(f.Field))
+	b.bool(5, f.Matched)
+
+	return b
+}
+
+func encodeDifference(d filmdetect.Difference) []byte {
+	var b protoBuffer
+
+	b.message(1, encodeRecipe(d.Candidate))
+	b.double(2, d.Score())
+	for _, field := range d.Fields() {
+		b.message(3, encodeFieldDiff(field))
+	}
+	b.int64(4, int64(d.Confidence))
+
+	return b
+}
+
+func encodeExtraction(e filmdetect.ExtractionResult) []byte {
+	var b protoBuffer
+
+	b.message(1, encodeRecipe(e.Recipe))
+	b.string(2, e.CustomSlot)
+	b.string(3, e.Make)
+	b.string(4, e.Model)
+	if !e.CaptureTime.IsZero() {
+		b.int64(5, e.CaptureTime.Unix())
+	}
+	b.sint32(6, e.ISO)
+	b.double(7, e.ExposureCompensation)
+	b.stringMap(8, e.RawFields)
+	b.string(9, e.Lens)
+	b.string(10, e.ShutterSpeed)
+	b.double(11, e.Aperture)
+	b.string(12, e.RAWConverter)
+	b.bool(13, e.Video)
+
+	return b
+}
+
+func encodeDetectResponse(d detection) []byte {
+	var b protoBuffer
+
+	b.bool(1, d.PerfectMatch)
+	b.message(2, encodeExtraction(d.Extraction))
+	for _, match := range d.Matches {
+		b.message(3, encodeDifference(match))
+	}
+
+	return b
+}
+
+func encodeExtractResponse(e filmdetect.ExtractionResult) []byte {
+	var b protoBuffer
+
+	b.message(1, encodeExtraction(e))
+
+	return b
+}
+
+func encodeListRecipesResponse(recipes []filmdetect.Recipe) []byte {
+	var b protoBuffer
+
+	for _, recipe := range recipes {
+		b.message(1, encodeRecipe(recipe))
+	}
+
+	return b
+}
+
+func encodeBatchResult(r batchResult) []byte {
+	var b protoBuffer
+
+	b.string(1, r.File)
+	if r.detection != nil {
+		b.message(2, encodeDetectResponse(*r.detection))
+	}
+	b.string(3, r.Error)
+
+	return b
+}
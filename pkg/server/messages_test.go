@@ -0,0 +1,247 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+var (
+	protoMessage = regexp.MustCompile(`^message (\w+) \{$`)
+	protoField   = regexp.MustCompile(`^(?:repeated )?(?:map<[^>]+>|[\w.]+) (\w+) = (\d+);`)
+)
+
+// protoFields reads the field numbers of every message of
+// api/filmdetect.proto.
+func protoFields(t *testing.T) map[string][]int {
+	t.Helper()
+
+	contents, err := os.ReadFile("../../api/filmdetect.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := map[string][]int{}
+	message := ""
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if m := protoMessage.FindStringSubmatch(line); m != nil {
+			message = m[1]
+			messages[message] = nil
+			continue
+		}
+		if line == "}" {
+			message = ""
+			continue
+		}
+		if m := protoField.FindStringSubmatch(line); m != nil && message != "" {
+			number, _ := strconv.Atoi(m[2])
+			messages[message] = append(messages[message], number)
+		}
+	}
+
+	return messages
+}
+
+// wireFields returns the field numbers present in an encoded message.
+func wireFields(t *testing.T, msg []byte) []int {
+	t.Helper()
+
+	var fields []int
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			t.Fatal("Malformed message")
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			_, n = binary.Uvarint(msg)
+			msg = msg[n:]
+		case wireFixed64:
+			msg = msg[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			msg = msg[n+int(length):]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+
+		if !slices.Contains(fields, int(key>>3)) {
+			fields = append(fields, int(key>>3))
+		}
+	}
+
+	slices.Sort(fields)
+	return fields
+}
+
+// fill sets every exported field of the struct v points to, so that encoders
+// leave none of them out for being zero.
+func fill(v reflect.Value) {
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString("Provia")
+		case reflect.Int:
+			field.SetInt(1)
+		case reflect.Float64:
+			field.SetFloat(1.5)
+		case reflect.Bool:
+			field.SetBool(true)
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.String {
+				field.Set(reflect.ValueOf([]string{"Provia"}))
+			}
+		case reflect.Map:
+			if field.Type() == reflect.TypeOf(map[string]any{}) {
+				field.Set(reflect.ValueOf(map[string]any{"Key": "Value"}))
+			}
+		case reflect.Struct:
+			if field.Type() == reflect.TypeOf(time.Time{}) {
+				field.Set(reflect.ValueOf(time.Unix(1600000000, 0)))
+			} else {
+				fill(field.Addr())
+			}
+		}
+	}
+}
+
+// TestEncodersCoverProto checks that the hand-written encoders write every
+// field of the messages in api/filmdetect.proto, so that adding a field to
+// the proto without encoding it fails.
+func TestEncodersCoverProto(t *testing.T) {
+	var recipe filmdetect.Recipe
+	fill(reflect.ValueOf(&recipe))
+
+	var extraction filmdetect.ExtractionResult
+	fill(reflect.ValueOf(&extraction))
+
+	candidate := recipe
+	candidate.FilmSimulation = "Velvia"
+	difference := filmdetect.DifferenceWithScorer(recipe, candidate, filmdetect.WeightedScorer{})
+	difference.Confidence = filmdetect.HighConfidence
+
+	d := detection{Extraction: extraction, PerfectMatch: true, Matches: []filmdetect.Difference{difference}}
+
+	encoded := map[string][]byte{
+		"Recipe":              encodeRecipe(recipe),
+		"FieldDiff":           encodeFieldDiff(filmdetect.FieldDiff{Field: "FilmSimulation", Input: "Provia", Candidate: "Velvia", Matched: true}),
+		"Difference":          encodeDifference(difference),
+		"Extraction":          encodeExtraction(extraction),
+		"DetectResponse":      encodeDetectResponse(d),
+		"DetectBatchResult":   encodeBatchResult(batchResult{File: "DSCF0001.JPG", detection: &d, Error: "Failed"}),
+		"ExtractResponse":     encodeExtractResponse(extraction),
+		"ListRecipesResponse": encodeListRecipesResponse([]filmdetect.Recipe{recipe}),
+	}
+
+	// The requests are decoded by decodeBytesFields, and all of them only
+	// have their first field
+	decoded := map[string][]int{
+		"DetectRequest":      {1},
+		"DetectBatchRequest": {1},
+		"ExtractRequest":     {1},
+		"ListRecipesRequest": {1},
+	}
+
+	for message, want := range protoFields(t) {
+		slices.Sort(want)
+
+		got, ok := decoded[message]
+		if msg, isEncoded := encoded[message]; isEncoded {
+			got, ok = wireFields(t, msg), true
+		}
+		if !ok {
+			t.Errorf("%s: No encoder or decoder", message)
+			continue
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: Fields %v are written, but the proto has %v", message, got, want)
+		}
+	}
+}
+
+// embedded returns the values of a length-delimited field of a message,
+// e.g. the elements of a repeated message field.
+func embedded(t *testing.T, msg []byte, field int) [][]byte {
+	t.Helper()
+
+	var values [][]byte
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		msg = msg[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			_, n = binary.Uvarint(msg)
+			msg = msg[n:]
+		case wireFixed64:
+			msg = msg[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			if int(key>>3) == field {
+				values = append(values, msg[n:n+int(length)])
+			}
+			msg = msg[n+int(length):]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+	}
+
+	return values
+}
+
+func TestDifferenceSendsEveryField(t *testing.T) {
+	input := filmdetect.Recipe{FilmSimulation: "Classic Chrome", Sharpness: 1}
+	candidate := filmdetect.Recipe{FilmSimulation: "Classic Chrome", Sharpness: -1}
+	difference := filmdetect.DifferenceWithScorer(input, candidate, filmdetect.WeightedScorer{})
+
+	fields := embedded(t, encodeDifference(difference), 3)
+	matched := 0
+	for _, field := range fields {
+		if slices.Contains(wireFields(t, field), 5) {
+			matched++
+		}
+	}
+
+	want := len(difference.Fields())
+	wantMatched := want - len(difference.Mismatches())
+	if len(fields) != want || matched != wantMatched {
+		t.Errorf("Sent %d fields, %d of them matched, expected %d and %d", len(fields), matched, want, wantMatched)
+	}
+	if wantMatched == 0 || wantMatched == want {
+		t.Errorf("Expected both matching and differing fields, got %d of %d matching", wantMatched, want)
+	}
+}
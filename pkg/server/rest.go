@@ -0,0 +1,78 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// readImage reads the uploaded image from the request body.
+func readImage(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	image, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImageSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	return image, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleDetect(w http.ResponseWriter, r *http.Request) {
+	image, ok := readImage(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.detect(image)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	image, ok := readImage(w, r)
+	if !ok {
+		return
+	}
+
+	extraction, err := s.extract(image)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, extraction)
+}
+
+func (s *Server) handleRecipes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.listRecipes(r.URL.Query().Get("collection")))
+}
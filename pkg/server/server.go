@@ -0,0 +1,149 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package server exposes detection over HTTP, both as a JSON API and as the
+// gRPC service described in api/filmdetect.proto.
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/honza/filmdetect/pkg/filmdetect"
+)
+
+// The largest image the server accepts
+const MaxImageSize = 100 << 20
+
+// How long clients have to send the headers of a request, and all of it.  A
+// request may upload an image of MaxImageSize over a slow connection, and a
+// batch upload gets readTimeout for each of its images.  Responses have no
+// deadline, since batches stream for as long as they take.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 5 * time.Minute
+)
+
+type Server struct {
+	// Directories on the server whose images clients may detect in one
+	// batch, along with their subdirectories.  None when empty.
+	BatchDirs []string
+
+	detector *filmdetect.Detector
+
+	rest *http.ServeMux
+}
+
+// New returns a server answering with detector.  Reloading the recipes of the
+// detector changes the answers of the running server.
+func New(detector *filmdetect.Detector) *Server {
+	s := &Server{detector: detector}
+
+	s.rest = http.NewServeMux()
+	s.rest.HandleFunc("POST /detect", s.handleDetect)
+	s.rest.HandleFunc("POST /detect/batch", s.handleDetectBatch)
+	s.rest.HandleFunc("POST /extract", s.handleExtract)
+	s.rest.HandleFunc("GET /recipes", s.handleRecipes)
+
+	return s
+}
+
+// ServeHTTP dispatches gRPC calls to the gRPC service, and everything else to
+// the JSON API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		s.serveGRPC(w, r)
+		return
+	}
+
+	s.rest.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on addr over HTTP/1.1 and unencrypted HTTP/2, which
+// is what gRPC clients speak.
+func (s *Server) ListenAndServe(addr string) error {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		Protocols:         &protocols,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+	}
+
+	return srv.ListenAndServe()
+}
+
+// extract reads the settings of an uploaded image.  exiftool needs a file,
+// so the image is written to a temporary one first.
+func (s *Server) extract(image []byte) (filmdetect.ExtractionResult, error) {
+	if len(image) == 0 {
+		return filmdetect.ExtractionResult{}, fmt.Errorf("No image given")
+	}
+
+	f, err := os.CreateTemp("", "filmdetect-*"+filmdetect.ImageExtension(image))
+	if err != nil {
+		return filmdetect.ExtractionResult{}, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(image)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return filmdetect.ExtractionResult{}, err
+	}
+
+	return s.detector.Extract(f.Name())
+}
+
+type detection struct {
+	Extraction   filmdetect.ExtractionResult `json:"extraction"`
+	PerfectMatch bool                        `json:"perfect_match"`
+	Matches      []filmdetect.Difference     `json:"matches"`
+}
+
+func (s *Server) detect(image []byte) (detection, error) {
+	extraction, err := s.extract(image)
+	if err != nil {
+		return detection{}, err
+	}
+
+	diffs, perfect, err := s.detector.DetectExtraction(extraction)
+	if err != nil {
+		return detection{}, err
+	}
+
+	return detection{Extraction: extraction, PerfectMatch: perfect, Matches: diffs}, nil
+}
+
+func (s *Server) listRecipes(collection string) []filmdetect.Recipe {
+	recipes := s.detector.Recipes()
+	if collection == "" {
+		return recipes.Recipes()
+	}
+
+	return recipes.Filter(func(r filmdetect.Recipe) bool {
+		return r.Collection == collection
+	}).Recipes()
+}
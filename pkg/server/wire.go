@@ -0,0 +1,161 @@
+// filmdetect
+// Copyright (C) 2021 Honza Pokorny <honza@pokorny.ca>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoBuffer encodes protocol buffer messages.  Like proto3, it leaves out
+// scalar fields that have their zero value.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(v uint64) {
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	b.message(field, v)
+}
+
+func (b *protoBuffer) string(field int, v string) {
+	b.bytes(field, []byte(v))
+}
+
+// message writes an embedded message, even when it's empty.
+func (b *protoBuffer) message(field int, v []byte) {
+	b.tag(field, wireBytes)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuffer) bool(field int, v bool) {
+	if !v {
+		return
+	}
+	b.tag(field, wireVarint)
+	b.varint(1)
+}
+
+func (b *protoBuffer) int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	b.varint(uint64(v))
+}
+
+// sint32 writes a zigzag encoded integer, which keeps small negative numbers
+// small.
+func (b *protoBuffer) sint32(field int, v int) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	b.varint(uint64((int64(v) << 1) ^ (int64(v) >> 63)))
+}
+
+func (b *protoBuffer) double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireFixed64)
+	*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(v))
+}
+
+// stringMap writes a map<string, string> field, whose entries are messages
+// of a key and a value, with the values formatted as text.  The entries are
+// sorted by key, to keep responses stable.
+func (b *protoBuffer) stringMap(field int, m map[string]any) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		var entry protoBuffer
+		entry.string(1, key)
+		entry.string(2, fmt.Sprintf("%v", m[key]))
+		b.message(field, entry)
+	}
+}
+
+// decodeBytesFields returns the length-delimited fields of a message by field
+// number, which is all the requests of the service are made of.  Other fields
+// are skipped.
+func decodeBytesFields(msg []byte) (map[int][]byte, error) {
+	fields := map[int][]byte{}
+
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, fmt.Errorf("Malformed message")
+		}
+		msg = msg[n:]
+
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case wireVarint:
+			_, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, fmt.Errorf("Malformed message")
+			}
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return nil, fmt.Errorf("Malformed message")
+			}
+			msg = msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return nil, fmt.Errorf("Malformed message")
+			}
+			msg = msg[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return nil, fmt.Errorf("Malformed message")
+			}
+			fields[field] = msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+		default:
+			return nil, fmt.Errorf("Unsupported wire type %d", key&7)
+		}
+	}
+
+	return fields, nil
+}